@@ -3,19 +3,29 @@ package blockchain
 import (
 	"bytes"
 	"crypto/sha256"
-	"encoding/gob"
-	"log"
+	"errors"
+
+	"github.com/shortdaddy0711/golang-blockchain/params"
+	"github.com/shortdaddy0711/golang-blockchain/script"
 )
 
+// BlockVersion is the version written into the header of new blocks
+const BlockVersion = 1
+
 // "bytes"
 // "crypto/sha256"
 
 // Block structure
 type Block struct {
+	Version      int
+	Timestamp    int64
 	Hash         []byte
 	Transactions []*Transaction
 	PrevHash     []byte
+	MerkleRoot   []byte
+	Bits         uint32
 	Nonce        int
+	Height       int
 }
 
 // // DeriveHash method for Block structure
@@ -25,22 +35,37 @@ type Block struct {
 // 	b.Hash = hash[:]
 // }
 
-// HashTransactions method for Block struct to hash the transaction
+// HashTransactions method for Block struct that returns the merkle root of the transactions
 func (b *Block) HashTransactions() []byte {
+	return b.merkleTree().Root()
+}
+
+// MerkleProof method that returns the inclusion proof of a transaction in the block
+func (b *Block) MerkleProof(txID []byte) ([]MerkleProofNode, error) {
+	for index, tx := range b.Transactions {
+		if bytes.Equal(tx.ID, txID) {
+			return b.merkleTree().Proof(index), nil
+		}
+	}
+
+	return nil, errors.New("Transaction is not in the block")
+}
+
+func (b *Block) merkleTree() *MerkleTree {
 	var txHashes [][]byte
-	var txHash [32]byte
 
 	for _, tx := range b.Transactions {
 		txHashes = append(txHashes, tx.ID)
 	}
-	txHash = sha256.Sum256(bytes.Join(txHashes, []byte{}))
 
-	return txHash[:]
+	return NewMerkleTree(txHashes)
 }
 
-// CreateBlock function to generate new block
-func CreateBlock(txs []*Transaction, prevHash []byte) *Block {
-	block := &Block{[]byte{}, txs, prevHash, 0}
+// CreateBlock function to generate new block with the timestamp that meets
+// the target given in bits
+func CreateBlock(txs []*Transaction, prevHash []byte, height int, bits uint32, timestamp int64) *Block {
+	block := &Block{BlockVersion, timestamp, []byte{}, txs, prevHash, nil, bits, 0, height}
+	block.MerkleRoot = block.HashTransactions()
 	pow := NewProof(block)
 	nonce, hash := pow.Run()
 
@@ -50,38 +75,36 @@ func CreateBlock(txs []*Transaction, prevHash []byte) *Block {
 	return block
 }
 
-// Genesis function to generate the Genesis block
-func Genesis(coinbase *Transaction) *Block {
-	return CreateBlock([]*Transaction{coinbase}, []byte{})
-}
-
-// Serialize method for Block
-func (b *Block) Serialize() []byte {
-	var res bytes.Buffer
-	encoder := gob.NewEncoder(&res)
-
-	err := encoder.Encode(b)
+// Genesis function that returns the fixed genesis block of a network, its
+// coinbase pays the subsidy to GenesisPubKeyHash and GenesisNonce meets the target
+func Genesis(p *params.ChainParams) *Block {
+	txin := TxInput{[]byte{}, -1, coinbaseScript(0, []byte(p.GenesisData)), MaxSequence}
+	txout := TxOutput{p.BlockSubsidy(0), script.PayToPubKeyHash(p.GenesisPubKeyHash)}
+	coinbase := &Transaction{nil, []TxInput{txin}, []TxOutput{txout}, 0}
+	coinbase.ID = coinbase.Hash()
 
-	Handle(err)
+	block := &Block{BlockVersion, p.GenesisTime, []byte{}, []*Transaction{coinbase}, []byte{}, nil,
+		BigToCompact(p.GenesisTarget), p.GenesisNonce, 0}
+	block.MerkleRoot = block.HashTransactions()
+	block.Hash = block.HeaderHash()
 
-	return res.Bytes()
+	return block
 }
 
-// Deserialize function
-func Deserialize(data []byte) *Block {
-	var block Block
-
-	decoder := gob.NewDecoder(bytes.NewReader(data))
-	err := decoder.Decode(&block)
+// HeaderHash method that returns the proof of work hash of the header
+func (b *Block) HeaderHash() []byte {
+	hash := sha256.Sum256(NewProof(b).InitData(b.Nonce))
 
-	Handle(err)
+	return hash[:]
+}
 
-	return &block
+// Serialize method for Block, see EncodingVersion for the format
+func (b *Block) Serialize() []byte {
+	return encodeBlock(b)
 }
 
-// Handle function for handling error
-func Handle(err error) {
-	if err != nil {
-		log.Panic(err)
-	}
-}
\ No newline at end of file
+// DeserializeBlock function to decode a block that may come from an untrusted
+// source, the hash is computed from the header
+func DeserializeBlock(data []byte) (*Block, error) {
+	return decodeBlock(data)
+}
@@ -2,27 +2,48 @@ package blockchain
 
 import (
 	"bytes"
-	"crypto/ecdsa"
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"log"
+	"math/big"
 	"os"
-	"runtime"
+	"path/filepath"
 
 	badger "github.com/dgraph-io/badger/v2"
+	"github.com/shortdaddy0711/golang-blockchain/config"
+	"github.com/shortdaddy0711/golang-blockchain/params"
+	"github.com/shortdaddy0711/golang-blockchain/signer"
 )
 
-const (
-	dbPath = "./tmp/blocks"
-	dbFile = "./tmp/blocks/MANIFEST"
-	genesisData = "First Transaction from Genesis"
+var (
+	magicKey = []byte("magic")
+	// blockPrefix keeps the blocks apart from the other records, a raw hash
+	// as key could start with the prefix of another record kind
+	blockPrefix = []byte("block-")
+)
+
+var (
+	// ErrNoBlockChain error when the node has no blockchain yet
+	ErrNoBlockChain = errors.New("No existing blockchain found, create one")
+	// ErrBlockChainExists error when a blockchain is created over an existing one
+	ErrBlockChainExists = errors.New("Blockchain already exists")
+	// ErrBlockNotFound error when no block is stored under a hash
+	ErrBlockNotFound = errors.New("Block is not found")
+	// ErrTxNotFound error when no block on the main chain has the transaction
+	ErrTxNotFound = errors.New("Transaction does not exist")
+	// ErrWrongNetwork error when the database holds the chain of another network
+	ErrWrongNetwork = errors.New("Blockchain belongs to another network")
+	// ErrWrongGenesis error when a chain does not start from the genesis block of its network
+	ErrWrongGenesis = errors.New("Blockchain does not start from the genesis block of its network")
 )
 
 // BlockChain structure
 type BlockChain struct {
 	LastHash []byte
 	Database *badger.DB
+	Params   *params.ChainParams
+	// TxIndex tells whether the transaction index is kept, see ReindexTransactions
+	TxIndex bool
 	// Blocks []*Block
 }
 
@@ -32,107 +53,165 @@ type BlockChainIterator struct {
 	Database    *badger.DB
 }
 
+func blockKey(blockHash []byte) []byte {
+	return append(append([]byte{}, blockPrefix...), blockHash...)
+}
+
 // DBexists function to check db exists or not
-func DBexists() bool {
-	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
+func DBexists(path string) bool {
+	if _, err := os.Stat(filepath.Join(path, "MANIFEST")); os.IsNotExist(err) {
 		return false
 	}
 	return true
 }
 
 // ContinueBlockChain function to add new block to existing blockchain
-func ContinueBlockChain(address string) *BlockChain {
-	if DBexists() == false {
-		fmt.Println("No existing blockchain found, create one!")
-		runtime.Goexit()
+func ContinueBlockChain(cfg *config.Config) (*BlockChain, error) {
+	path := cfg.BlocksPath()
+	if DBexists(path) == false {
+		return nil, ErrNoBlockChain
 	}
 
 	var lastHash []byte
+	txIndex := false
 
-	opts := badger.DefaultOptions(dbPath)
+	opts := badger.DefaultOptions(path)
 
 	db, err := badger.Open(opts)
-	Handle(err)
+	if err != nil {
+		return nil, err
+	}
 
-	err = db.Update(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte("lh")) // retrieve last block of the blockchain
-		Handle(err)
+	err = db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(magicKey)
+		if err == badger.ErrKeyNotFound {
+			return fmt.Errorf("%w: %s has no network magic, create the chain again", ErrWrongNetwork, path)
+		}
+		if err != nil {
+			return err
+		}
+		magic, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(magic, cfg.Params.Magic[:]) {
+			return fmt.Errorf("%w: %s is not a %s chain", ErrWrongNetwork, path, cfg.Params.Name)
+		}
+
+		if _, err := txn.Get(txIndexKey); err == nil {
+			txIndex = true
+		} else if err != badger.ErrKeyNotFound {
+			return err
+		}
+
+		item, err = txn.Get([]byte("lh")) // retrieve last block of the blockchain
+		if err != nil {
+			return err
+		}
 		lastHash, err = item.ValueCopy(nil)
 
 		return err
 	})
-	Handle(err)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	chain := BlockChain{lastHash, db, cfg.Params, txIndex}
 
-	chain := BlockChain{lastHash, db}
-	return &chain
+	// data directories of older versions are not converted, see EncodingVersion,
+	// the oldest stored blocks without blockPrefix
+	if _, err := chain.GetBlock(lastHash); err != nil {
+		db.Close()
+		if errors.Is(err, ErrUnknownEncoding) || errors.Is(err, ErrBlockNotFound) {
+			return nil, fmt.Errorf("%w: %s was stored by an older version, remove it and create the chain again", err, path)
+		}
+		return nil, err
+	}
+	genesisHash, err := chain.GetBlockHash(0)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if !bytes.Equal(genesisHash, cfg.Params.GenesisHash) {
+		db.Close()
+		return nil, fmt.Errorf("%w: %s starts from %x, not %x", ErrWrongGenesis, path, genesisHash, cfg.Params.GenesisHash)
+	}
+
+	return &chain, nil
 }
 
-// InitBlockChain function to init blockchain with Genesis block
-func InitBlockChain(address string) *BlockChain {
+// InitBlockChain function to init blockchain with the Genesis block of the network
+func InitBlockChain(cfg *config.Config) (*BlockChain, error) {
+	path := cfg.BlocksPath()
 	var lastHash []byte
 
-	if DBexists() {
-		fmt.Println("Blockchain already exists")
-		runtime.Goexit()
+	if DBexists(path) {
+		return nil, ErrBlockChainExists
 	}
 
-	opts := badger.DefaultOptions(dbPath)
+	opts := badger.DefaultOptions(path)
 
 	db, err := badger.Open(opts)
-	Handle(err)
+	if err != nil {
+		return nil, err
+	}
 
 	err = db.Update(func(txn *badger.Txn) error {
-		cbtx := CoinbaseTx(address, genesisData)
-		genesis := Genesis(cbtx)
+		genesis := Genesis(cfg.Params)
 		fmt.Println("Genesis created")
-		err = txn.Set(genesis.Hash, genesis.Serialize())
-		Handle(err)
-		err = txn.Set([]byte("lh"), genesis.Hash) // save last hash to db
+		if err := txn.Set(magicKey, cfg.Params.Magic[:]); err != nil {
+			return err
+		}
+		if err := txn.Set(blockKey(genesis.Hash), genesis.Serialize()); err != nil {
+			return err
+		}
+		if err := txn.Set(chainWorkKey(genesis.Hash), CalcWork(genesis.Bits).Bytes()); err != nil {
+			return err
+		}
+		if err := txn.Set(heightKey(genesis.Height), genesis.Hash); err != nil {
+			return err
+		}
+		err := txn.Set([]byte("lh"), genesis.Hash) // save last hash to db
 
 		lastHash = genesis.Hash // save last hash to memory
 
 		return err
 	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
 
-	Handle(err)
-
-	blockchain := BlockChain{lastHash, db}
-	return &blockchain
+	blockchain := BlockChain{lastHash, db, cfg.Params, false}
+	return &blockchain, nil
 }
 
-// AddBlock method for BlockChain structure
-func (bc *BlockChain) AddBlock(transactions []*Transaction) *Block {
-	var lastHash []byte
-
-	for _, tx := range transactions {
-		if bc.VerifyTransaction(tx) != true {
-			log.Panic("Invalid Transaction")
-		}
+// AddBlock method for BlockChain structure to mine a block on the tip,
+// the UTXO set is updated with the new block
+func (bc *BlockChain) AddBlock(transactions []*Transaction) (*Block, error) {
+	lastBlock, err := bc.GetBlock(bc.LastHash)
+	if err != nil {
+		return nil, err
 	}
 
-	err := bc.Database.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte("lh"))
-		Handle(err)
-		lastHash, err = item.ValueCopy(nil)
-
-		return err
-	})
-	Handle(err)
-
-	newBlock := CreateBlock(transactions, lastHash)
+	bits, err := bc.CalcNextBits(&lastBlock)
+	if err != nil {
+		return nil, err
+	}
 
-	err = bc.Database.Update(func(txn *badger.Txn) error {
-		err := txn.Set(newBlock.Hash, newBlock.Serialize())
-		Handle(err)
-		err = txn.Set([]byte("lh"), newBlock.Hash)
+	timestamp, err := bc.NextBlockTime(&lastBlock)
+	if err != nil {
+		return nil, err
+	}
 
-		bc.LastHash = newBlock.Hash
+	newBlock := CreateBlock(transactions, lastBlock.Hash, lastBlock.Height+1, bits, timestamp)
 
-		return err
-	})
-	Handle(err)
+	if _, err := bc.ImportBlock(newBlock); err != nil {
+		return nil, err
+	}
 
-	return newBlock
+	return newBlock, nil
 }
 
 // Iterator method for blockchain structure to return
@@ -144,39 +223,207 @@ func (bc *BlockChain) Iterator() *BlockChainIterator {
 }
 
 // Next method for BlockChainIterator structure
-func (iterator *BlockChainIterator) Next() *Block {
+func (iterator *BlockChainIterator) Next() (*Block, error) {
 	var block *Block
-	var encodedBlock []byte
 
 	err := iterator.Database.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(iterator.CurrentHash)
-		Handle(err)
-		err = item.Value(func(val []byte) error {
-			encodedBlock = val
-			return nil
-		})
-		block = Deserialize(encodedBlock)
+		item, err := txn.Get(blockKey(iterator.CurrentHash))
+		if err != nil {
+			return err
+		}
+		encodedBlock, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		block, err = DeserializeBlock(encodedBlock)
 
 		return err
 	})
-	Handle(err)
+	if err != nil {
+		return nil, err
+	}
 
 	iterator.CurrentHash = block.PrevHash
 
-	return block
+	return block, nil
 }
 
+// ImportBlock method to store a block received from another node, a block
+// needs a valid header to be stored and becomes part of the main chain when
+// its branch has more cumulative work than the current tip
+func (bc *BlockChain) ImportBlock(block *Block) (*ChainUpdate, error) {
+	stored, err := bc.HasBlock(block.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if stored {
+		return bc.reconsiderBlock(block)
+	}
 
+	if err := bc.CheckBlockHeader(block); err != nil {
+		return nil, err
+	}
+
+	parentWork, err := bc.ChainWork(block.PrevHash)
+	if err != nil {
+		return nil, err
+	}
+	work := new(big.Int).Add(parentWork, CalcWork(block.Bits))
+
+	tipWork, err := bc.ChainWork(bc.LastHash)
+	if err != nil {
+		return nil, err
+	}
+
+	extendsTip := bytes.Equal(block.PrevHash, bc.LastHash)
+	if extendsTip {
+		// a block on the tip is checked before anything is written
+		if err := bc.ValidateBlock(block); err != nil {
+			return nil, err
+		}
+	}
+
+	err = bc.Database.Update(func(txn *badger.Txn) error {
+		if err := txn.Set(blockKey(block.Hash), block.Serialize()); err != nil {
+			return err
+		}
+		return txn.Set(chainWorkKey(block.Hash), work.Bytes())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if work.Cmp(tipWork) <= 0 {
+		fmt.Printf("Block %x is stored on a side branch\n", block.Hash)
+		return &ChainUpdate{}, nil
+	}
+
+	if extendsTip {
+		if err := bc.applyBlock(block); err != nil {
+			return nil, err
+		}
+		return &ChainUpdate{Connected: []*Block{block}}, nil
+	}
+
+	return bc.reorganize(block)
+}
+
+// reconsiderBlock switches to a stored side branch block, for example one
+// taken off by a rollback, when it has more work than the current tip
+func (bc *BlockChain) reconsiderBlock(block *Block) (*ChainUpdate, error) {
+	work, err := bc.ChainWork(block.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	tipWork, err := bc.ChainWork(bc.LastHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if work.Cmp(tipWork) <= 0 {
+		return &ChainUpdate{}, nil
+	}
+
+	return bc.reorganize(block)
+}
+
+// HasBlock method to check whether a block is already stored
+func (bc *BlockChain) HasBlock(blockHash []byte) (bool, error) {
+	found := false
+
+	err := bc.Database.View(func(txn *badger.Txn) error {
+		if _, err := txn.Get(blockKey(blockHash)); err == nil {
+			found = true
+		} else if err != badger.ErrKeyNotFound {
+			return err
+		}
+		return nil
+	})
+
+	return found, err
+}
+
+// GetBlock method to find a block by its hash
+func (bc *BlockChain) GetBlock(blockHash []byte) (Block, error) {
+	var block Block
+
+	err := bc.Database.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(blockKey(blockHash))
+		if err == badger.ErrKeyNotFound {
+			return ErrBlockNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		blockData, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		decoded, err := DeserializeBlock(blockData)
+		if err != nil {
+			return err
+		}
+		block = *decoded
+
+		return nil
+	})
+
+	return block, err
+}
+
+// GetBlockHashes method that returns the hashes of the chain from genesis to tip
+func (bc *BlockChain) GetBlockHashes() ([][]byte, error) {
+	var blocks [][]byte
+
+	iterator, err := bc.ForwardIterator(0)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		block, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if block == nil {
+			break
+		}
+
+		blocks = append(blocks, block.Hash)
+	}
+
+	return blocks, nil
+}
+
+// GetBestHeight method that returns the height of the tip, genesis is 0
+func (bc *BlockChain) GetBestHeight() (int, error) {
+	lastBlock, err := bc.GetBlock(bc.LastHash)
+	if err != nil {
+		return 0, err
+	}
+
+	return lastBlock.Height, nil
+}
 
 // FindUTXO method
-func (bc *BlockChain) FindUTXO() map[string]TxOutputs {
+func (bc *BlockChain) FindUTXO() (map[string]TxOutputs, error) {
 	UTXO := make(map[string]TxOutputs)
 	spentTXOs := make(map[string][]int)
 
 	iterator := bc.Iterator()
 
 	for {
-		block := iterator.Next()
+		block, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		coinTime, err := bc.coinTime(block)
+		if err != nil {
+			return nil, err
+		}
 
 		for _, tx := range block.Transactions {
 			txID := hex.EncodeToString(tx.ID)
@@ -191,7 +438,10 @@ func (bc *BlockChain) FindUTXO() map[string]TxOutputs {
 					}
 				}
 				outs := UTXO[txID]
-				outs.Outputs = append(outs.Outputs, out)
+				if outs.Outputs == nil {
+					outs = TxOutputs{make(map[int]TxOutput), block.Height, coinTime}
+				}
+				outs.Outputs[outIdx] = out
 				UTXO[txID] = outs
 			}
 			if tx.IsCoinbase() == false {
@@ -205,17 +455,23 @@ func (bc *BlockChain) FindUTXO() map[string]TxOutputs {
 			break
 		}
 	}
-	return UTXO
+	return UTXO, nil
 }
 
-
-
-// FindTransaction method
+// FindTransaction method to find a transaction of the main chain, through the
+// transaction index when it is kept and by walking the chain otherwise
 func (bc *BlockChain) FindTransaction(ID []byte) (Transaction, error) {
+	if bc.TxIndex {
+		return bc.findIndexedTransaction(ID)
+	}
+
 	iterator := bc.Iterator()
 
 	for {
-		block := iterator.Next()
+		block, err := iterator.Next()
+		if err != nil {
+			return Transaction{}, err
+		}
 
 		for _, tx := range block.Transactions {
 			if bytes.Compare(tx.ID, ID) == 0 {
@@ -227,31 +483,44 @@ func (bc *BlockChain) FindTransaction(ID []byte) (Transaction, error) {
 			break
 		}
 	}
-	return Transaction{}, errors.New("Transaction does not exist")
+	return Transaction{}, fmt.Errorf("%w: %x", ErrTxNotFound, ID)
 }
 
-// SignTransaction method
-func (bc *BlockChain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey) {
+// SignTransaction method to sign the inputs of tx spending outputs of pubKey
+// with the key s holds
+func (bc *BlockChain) SignTransaction(tx *Transaction, s signer.Signer, pubKey []byte) error {
 	prevTXs := make(map[string]Transaction)
 
 	for _, in := range tx.Inputs {
 		prevTX, err := bc.FindTransaction(in.ID)
-		Handle(err)
+		if err != nil {
+			return err
+		}
 		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
 	}
 
-	tx.Sign(privKey, prevTXs)
+	return tx.Sign(s, pubKey, prevTXs)
 }
 
-// VerifyTransaction method
-func (bc *BlockChain) VerifyTransaction(tx *Transaction) bool {
+// VerifyTransaction method, an input whose transaction is not on the chain
+// makes the transaction invalid rather than the call fail
+func (bc *BlockChain) VerifyTransaction(tx *Transaction) (bool, error) {
+	if tx.IsCoinbase() {
+		return true, nil
+	}
+
 	prevTXs := make(map[string]Transaction)
 
 	for _, in := range tx.Inputs {
 		prevTX, err := bc.FindTransaction(in.ID)
-		Handle(err)
+		if errors.Is(err, ErrTxNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
 		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
 	}
 
-	return tx.Verify(prevTXs)
+	return tx.Verify(prevTXs), nil
 }
\ No newline at end of file
@@ -0,0 +1,134 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"testing"
+
+	badger "github.com/dgraph-io/badger/v2"
+	"github.com/shortdaddy0711/golang-blockchain/config"
+	"github.com/shortdaddy0711/golang-blockchain/params"
+)
+
+// newTestConfig returns a regtest config whose data lives in a directory
+// removed after the test
+func newTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	return &config.Config{DataDir: t.TempDir(), Params: &params.RegTest}
+}
+
+// newTestChain creates a regtest chain holding only the genesis block
+func newTestChain(t *testing.T, cfg *config.Config) *BlockChain {
+	t.Helper()
+
+	chain, err := InitBlockChain(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { chain.Database.Close() })
+
+	UTXOSet := UTXOSet{chain}
+	if err := UTXOSet.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+
+	return chain
+}
+
+func TestGenesisBlocks(t *testing.T) {
+	for name, p := range params.Networks {
+		genesis := Genesis(p)
+
+		if !bytes.Equal(genesis.Hash, p.GenesisHash) {
+			t.Errorf("%s genesis hashes to %x, want %x", name, genesis.Hash, p.GenesisHash)
+		}
+		if !NewProof(genesis).Validate() {
+			t.Errorf("%s genesis does not meet its target", name)
+		}
+	}
+}
+
+func TestInitBlockChainStartsFromGenesis(t *testing.T) {
+	cfg := newTestConfig(t)
+	chain := newTestChain(t, cfg)
+
+	if !bytes.Equal(chain.LastHash, params.RegTest.GenesisHash) {
+		t.Fatalf("tip is %x, want the genesis %x", chain.LastHash, params.RegTest.GenesisHash)
+	}
+	if _, err := InitBlockChain(cfg); !errors.Is(err, ErrBlockChainExists) {
+		t.Fatalf("creating the chain twice returned %v", err)
+	}
+}
+
+func TestContinueBlockChainChecksGenesis(t *testing.T) {
+	cfg := newTestConfig(t)
+	chain, err := InitBlockChain(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.Database.Close()
+
+	other := params.RegTest
+	other.GenesisHash = params.TestNet.GenesisHash
+	_, err = ContinueBlockChain(&config.Config{DataDir: cfg.DataDir, Params: &other})
+	if !errors.Is(err, ErrWrongGenesis) {
+		t.Fatalf("opening a chain of another genesis returned %v", err)
+	}
+
+	_, err = ContinueBlockChain(&config.Config{DataDir: cfg.DataDir, Params: &params.TestNet})
+	if !errors.Is(err, ErrWrongNetwork) {
+		t.Fatalf("opening a chain of another network returned %v", err)
+	}
+
+	chain, err = ContinueBlockChain(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.Database.Close()
+}
+
+func TestContinueBlockChainWithoutMagic(t *testing.T) {
+	cfg := newTestConfig(t)
+	chain, err := InitBlockChain(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = chain.Database.Update(func(txn *badger.Txn) error {
+		return txn.Delete(magicKey)
+	})
+	chain.Database.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ContinueBlockChain(cfg); !errors.Is(err, ErrWrongNetwork) {
+		t.Fatalf("opening a chain without magic returned %v", err)
+	}
+}
+
+func TestContinueBlockChainOfOlderVersion(t *testing.T) {
+	cfg := newTestConfig(t)
+	chain, err := InitBlockChain(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// older versions stored the blocks as gob
+	var gobBlock bytes.Buffer
+	if err := gob.NewEncoder(&gobBlock).Encode(Genesis(cfg.Params)); err != nil {
+		t.Fatal(err)
+	}
+	err = chain.Database.Update(func(txn *badger.Txn) error {
+		return txn.Set(blockKey(chain.LastHash), gobBlock.Bytes())
+	})
+	chain.Database.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ContinueBlockChain(cfg); !errors.Is(err, ErrUnknownEncoding) {
+		t.Fatalf("opening a chain of an older version returned %v", err)
+	}
+}
@@ -0,0 +1,371 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Blocks, transactions and the records of the UTXO set are stored, sent and
+// hashed in the binary format below, so any language can decode them and
+// compute the same ids. Every record starts with the byte EncodingVersion.
+// Integers are little endian, u32 and i32 take 4 bytes, i64 takes 8 bytes and
+// negative numbers are two's complement. bytes is a u32 length followed by
+// that many bytes. A list is a u32 count followed by its items.
+//
+//	transaction: version, list of inputs, list of outputs, u32 lock time
+//	input:       bytes id of the spent transaction, i32 output index (-1 in a
+//	             coinbase), bytes unlocking script, u32 sequence. The unlocking
+//	             script of a coinbase starts with the i64 height of its block
+//	output:      i64 value, bytes locking script
+//	block:       version, i32 block version, i64 timestamp, bytes previous hash,
+//	             bytes merkle root, u32 bits, i64 nonce, i64 height, list of
+//	             bytes that each hold an encoded transaction
+//	utxo record: version, i64 height, i64 timestamp, list of unspent outputs
+//	             as u32 index and output, in increasing order of index
+//	undo record: version, list of spent outputs as bytes transaction id,
+//	             u32 index, output, i64 height, i64 timestamp
+//	tx location: version, bytes block hash, u32 position in the block
+//
+// Ids are not part of the encoding. The id of a transaction is the SHA-256 of
+// the encoded transaction and the hash of a block is its proof of work hash.
+//
+// Older versions stored gob and are not converted, their data directories
+// have to be removed and the chain created or synced again.
+const EncodingVersion = 1
+
+var (
+	// ErrMalformedData error when serialized data does not follow the encoding
+	ErrMalformedData = errors.New("Serialized data is malformed")
+	// ErrUnknownEncoding error when serialized data starts with an unknown version
+	ErrUnknownEncoding = errors.New("Serialized data has an unknown encoding version")
+)
+
+// Encoder structure that appends the fields of a record in the format above,
+// other packages use it to encode their own records the same way
+type Encoder struct {
+	data []byte
+}
+
+// NewEncoder function that starts a record with EncodingVersion
+func NewEncoder() *Encoder {
+	return &Encoder{[]byte{EncodingVersion}}
+}
+
+// Data method that returns the record encoded so far
+func (e *Encoder) Data() []byte {
+	return e.data
+}
+
+// Uint32 method to append a u32
+func (e *Encoder) Uint32(n uint32) {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], n)
+	e.data = append(e.data, buf[:]...)
+}
+
+// Int64 method to append an i64
+func (e *Encoder) Int64(n int64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(n))
+	e.data = append(e.data, buf[:]...)
+}
+
+// Bytes method to append bytes, the length goes first
+func (e *Encoder) Bytes(data []byte) {
+	e.Uint32(uint32(len(data)))
+	e.data = append(e.data, data...)
+}
+
+func (e *Encoder) output(out TxOutput) {
+	e.Int64(int64(out.Value))
+	e.Bytes(out.ScriptPubKey)
+}
+
+// Decoder structure that reads the fields of a record, after the first error
+// every read returns zero and the error is kept for Finish
+type Decoder struct {
+	data []byte
+	err  error
+}
+
+// NewDecoder function to read a record, it must start with EncodingVersion
+func NewDecoder(data []byte) *Decoder {
+	d := &Decoder{data: data}
+	if len(data) == 0 {
+		d.err = fmt.Errorf("%w: empty record", ErrMalformedData)
+	} else if data[0] != EncodingVersion {
+		d.err = fmt.Errorf("%w: %d", ErrUnknownEncoding, data[0])
+	} else {
+		d.data = data[1:]
+	}
+
+	return d
+}
+
+func (d *Decoder) next(size uint64) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if size > uint64(len(d.data)) {
+		d.err = fmt.Errorf("%w: %d bytes needed, %d left", ErrMalformedData, size, len(d.data))
+		return nil
+	}
+
+	field := d.data[:size]
+	d.data = d.data[size:]
+
+	return field
+}
+
+// Uint32 method to read a u32
+func (d *Decoder) Uint32() uint32 {
+	field := d.next(4)
+	if field == nil {
+		return 0
+	}
+
+	return binary.LittleEndian.Uint32(field)
+}
+
+// Int64 method to read an i64
+func (d *Decoder) Int64() int64 {
+	field := d.next(8)
+	if field == nil {
+		return 0
+	}
+
+	return int64(binary.LittleEndian.Uint64(field))
+}
+
+// Bytes method to read bytes, empty bytes are read as nil
+func (d *Decoder) Bytes() []byte {
+	field := d.next(uint64(d.Uint32()))
+	if len(field) == 0 {
+		return nil
+	}
+
+	return append([]byte{}, field...)
+}
+
+// Count method to read the length of a list whose items take at least minSize
+// bytes, so a forged count cannot make the decoder allocate more than the data allows
+func (d *Decoder) Count(minSize int) int {
+	n := d.Uint32()
+	if d.err == nil && uint64(n)*uint64(minSize) > uint64(len(d.data)) {
+		d.err = fmt.Errorf("%w: %d items do not fit in %d bytes", ErrMalformedData, n, len(d.data))
+		return 0
+	}
+
+	return int(n)
+}
+
+func (d *Decoder) output() TxOutput {
+	return TxOutput{int(d.Int64()), d.Bytes()}
+}
+
+// Finish method that returns the first error, or an error when bytes are left over
+func (d *Decoder) Finish() error {
+	if d.err == nil && len(d.data) > 0 {
+		return fmt.Errorf("%w: %d bytes left over", ErrMalformedData, len(d.data))
+	}
+
+	return d.err
+}
+
+// the smallest encoded input, output and transaction
+const (
+	minInputSize       = 4 + 4 + 4 + 4
+	minOutputSize      = 8 + 4
+	minTransactionSize = 1 + 4 + 4 + 4
+)
+
+// encodeTransaction writes everything but the id
+func encodeTransaction(tx *Transaction) []byte {
+	e := NewEncoder()
+
+	e.Uint32(uint32(len(tx.Inputs)))
+	for _, in := range tx.Inputs {
+		e.Bytes(in.ID)
+		e.Uint32(uint32(int32(in.Out)))
+		e.Bytes(in.ScriptSig)
+		e.Uint32(in.Sequence)
+	}
+
+	e.Uint32(uint32(len(tx.Outputs)))
+	for _, out := range tx.Outputs {
+		e.output(out)
+	}
+
+	e.Uint32(tx.LockTime)
+
+	return e.Data()
+}
+
+func decodeTransaction(data []byte) (Transaction, error) {
+	var tx Transaction
+	d := NewDecoder(data)
+
+	inputs := d.Count(minInputSize)
+	for i := 0; i < inputs; i++ {
+		tx.Inputs = append(tx.Inputs, TxInput{d.Bytes(), int(int32(d.Uint32())), d.Bytes(), d.Uint32()})
+	}
+
+	outputs := d.Count(minOutputSize)
+	for i := 0; i < outputs; i++ {
+		tx.Outputs = append(tx.Outputs, d.output())
+	}
+
+	tx.LockTime = d.Uint32()
+
+	if err := d.Finish(); err != nil {
+		return Transaction{}, err
+	}
+	tx.ID = tx.Hash()
+
+	return tx, nil
+}
+
+// encodeBlock writes everything but the hash
+func encodeBlock(b *Block) []byte {
+	e := NewEncoder()
+
+	e.Uint32(uint32(int32(b.Version)))
+	e.Int64(b.Timestamp)
+	e.Bytes(b.PrevHash)
+	e.Bytes(b.MerkleRoot)
+	e.Uint32(b.Bits)
+	e.Int64(int64(b.Nonce))
+	e.Int64(int64(b.Height))
+
+	e.Uint32(uint32(len(b.Transactions)))
+	for _, tx := range b.Transactions {
+		e.Bytes(encodeTransaction(tx))
+	}
+
+	return e.Data()
+}
+
+func decodeBlock(data []byte) (*Block, error) {
+	var block Block
+	d := NewDecoder(data)
+
+	block.Version = int(int32(d.Uint32()))
+	block.Timestamp = d.Int64()
+	block.PrevHash = d.Bytes()
+	block.MerkleRoot = d.Bytes()
+	block.Bits = d.Uint32()
+	block.Nonce = int(d.Int64())
+	block.Height = int(d.Int64())
+
+	txs := d.Count(4 + minTransactionSize)
+	for i := 0; i < txs && d.err == nil; i++ {
+		tx, err := decodeTransaction(d.Bytes())
+		if err != nil && d.err == nil {
+			d.err = err
+		}
+		block.Transactions = append(block.Transactions, &tx)
+	}
+
+	if err := d.Finish(); err != nil {
+		return nil, err
+	}
+	block.Hash = block.HeaderHash()
+
+	return &block, nil
+}
+
+func encodeOutputs(outs TxOutputs) []byte {
+	e := NewEncoder()
+
+	e.Int64(int64(outs.Height))
+	e.Int64(outs.Time)
+
+	var indexes []int
+	for index := range outs.Outputs {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	e.Uint32(uint32(len(indexes)))
+	for _, index := range indexes {
+		e.Uint32(uint32(index))
+		e.output(outs.Outputs[index])
+	}
+
+	return e.Data()
+}
+
+func decodeOutputs(data []byte) (TxOutputs, error) {
+	d := NewDecoder(data)
+	outs := TxOutputs{make(map[int]TxOutput), int(d.Int64()), d.Int64()}
+
+	count := d.Count(4 + minOutputSize)
+	last := -1
+	for i := 0; i < count; i++ {
+		index := int(d.Uint32())
+		if index <= last && d.err == nil {
+			d.err = fmt.Errorf("%w: output indexes out of order", ErrMalformedData)
+		}
+		last = index
+		outs.Outputs[index] = d.output()
+	}
+
+	if err := d.Finish(); err != nil {
+		return TxOutputs{}, err
+	}
+
+	return outs, nil
+}
+
+func encodeUndo(undo BlockUndo) []byte {
+	e := NewEncoder()
+
+	e.Uint32(uint32(len(undo.Spent)))
+	for _, spent := range undo.Spent {
+		e.Bytes(spent.TxID)
+		e.Uint32(uint32(spent.Index))
+		e.output(spent.Output)
+		e.Int64(int64(spent.Height))
+		e.Int64(spent.Time)
+	}
+
+	return e.Data()
+}
+
+func decodeUndo(data []byte) (BlockUndo, error) {
+	var undo BlockUndo
+	d := NewDecoder(data)
+
+	count := d.Count(4 + 4 + minOutputSize + 8 + 8)
+	for i := 0; i < count; i++ {
+		undo.Spent = append(undo.Spent, SpentOutput{d.Bytes(), int(d.Uint32()), d.output(), int(d.Int64()), d.Int64()})
+	}
+
+	if err := d.Finish(); err != nil {
+		return BlockUndo{}, err
+	}
+
+	return undo, nil
+}
+
+func encodeTxLocation(loc TxLocation) []byte {
+	e := NewEncoder()
+
+	e.Bytes(loc.BlockHash)
+	e.Uint32(uint32(loc.Position))
+
+	return e.Data()
+}
+
+func decodeTxLocation(data []byte) (TxLocation, error) {
+	d := NewDecoder(data)
+	loc := TxLocation{d.Bytes(), int(d.Uint32())}
+
+	if err := d.Finish(); err != nil {
+		return TxLocation{}, err
+	}
+
+	return loc, nil
+}
@@ -0,0 +1,184 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testTransaction is a transaction whose encoding and id are worked out by
+// hand from the format described at EncodingVersion
+func testTransaction() *Transaction {
+	tx := &Transaction{
+		Inputs:   []TxInput{{[]byte{0xaa, 0xbb}, 1, []byte{0x51}, MaxSequence - 1}},
+		Outputs:  []TxOutput{{5, []byte{0x51}}},
+		LockTime: 7,
+	}
+	tx.ID = tx.Hash()
+
+	return tx
+}
+
+func TestTransactionEncoding(t *testing.T) {
+	tx := testTransaction()
+
+	encoded := hex.EncodeToString(tx.Serialize())
+	want := "01" + // version
+		"01000000" + "02000000aabb" + "01000000" + "0100000051" + "feffffff" + // one input
+		"01000000" + "0500000000000000" + "0100000051" + // one output
+		"07000000" // lock time
+	if encoded != want {
+		t.Fatalf("transaction encodes to %s, want %s", encoded, want)
+	}
+
+	// the id is the hash of the whole encoding, unlocking script included
+	if id := hex.EncodeToString(tx.ID); id != "98a23918749aba7faa1697970b73cf18d067fa62f9f3e1d09c94ec1a9d45b99f" {
+		t.Fatalf("transaction id is %s", id)
+	}
+	signed := *tx
+	signed.Inputs = []TxInput{tx.Inputs[0]}
+	signed.Inputs[0].ScriptSig = []byte{0x52}
+	if reflect.DeepEqual(signed.Hash(), tx.ID) {
+		t.Fatal("the unlocking script does not change the transaction id")
+	}
+
+	decoded, err := DeserializeTransaction(tx.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, tx) {
+		t.Fatalf("transaction decodes to %v, want %v", decoded, tx)
+	}
+}
+
+func TestCoinbaseEncoding(t *testing.T) {
+	w := newTestWallet(t)
+	coinbase, err := CoinbaseTx(w.address, "data", 5, 3, newTestConfig(t).Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the empty id of the spent transaction decodes as nil, so compare encodings
+	decoded, err := DeserializeTransaction(coinbase.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.IsCoinbase() || !bytes.Equal(decoded.ID, coinbase.ID) ||
+		!bytes.Equal(decoded.Serialize(), coinbase.Serialize()) {
+		t.Fatalf("coinbase decodes to %v, want %v", decoded, coinbase)
+	}
+}
+
+func TestRecordRoundTrips(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+	alice, bob := newTestWallet(t), newTestWallet(t)
+
+	mine(t, chain, alice.address)
+	block := newBlock(t, chain, alice.address, send(t, chain, alice, bob.address, 10, 1))
+
+	decoded, err := DeserializeBlock(block.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.Hash, block.Hash) || !bytes.Equal(decoded.Serialize(), block.Serialize()) {
+		t.Fatalf("block %x decodes to %x", block.Hash, decoded.Hash)
+	}
+	for i, tx := range block.Transactions {
+		if !bytes.Equal(decoded.Transactions[i].ID, tx.ID) {
+			t.Errorf("transaction %d decodes with id %x, want %x", i, decoded.Transactions[i].ID, tx.ID)
+		}
+	}
+
+	outs := TxOutputs{map[int]TxOutput{0: {1, []byte{1}}, 2: {0, nil}, 7: {-3, []byte{7, 7}}}, 12, -5}
+	decodedOuts, err := DeserializeOutputs(outs.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decodedOuts, outs) {
+		t.Fatalf("outputs decode to %v, want %v", decodedOuts, outs)
+	}
+
+	undo := BlockUndo{[]SpentOutput{
+		{[]byte{1, 2}, 3, TxOutput{4, []byte{5}}, 6, 7},
+		{[]byte{8}, 0, TxOutput{9, nil}, 0, 10},
+	}}
+	decodedUndo, err := DeserializeUndo(undo.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decodedUndo, undo) {
+		t.Fatalf("undo data decodes to %v, want %v", decodedUndo, undo)
+	}
+
+	loc := TxLocation{block.Hash, 1}
+	decodedLoc, err := DeserializeTxLocation(loc.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decodedLoc, loc) {
+		t.Fatalf("transaction location decodes to %v, want %v", decodedLoc, loc)
+	}
+}
+
+func TestDecodeRejectsMalformedData(t *testing.T) {
+	tx := testTransaction().Serialize()
+	outs := TxOutputs{map[int]TxOutput{0: {1, nil}, 1: {2, nil}}, 1, 2}.Serialize()
+
+	decoders := map[string]func([]byte) error{
+		"transaction": func(data []byte) error { _, err := DeserializeTransaction(data); return err },
+		"block":       func(data []byte) error { _, err := DeserializeBlock(data); return err },
+		"outputs":     func(data []byte) error { _, err := DeserializeOutputs(data); return err },
+		"undo":        func(data []byte) error { _, err := DeserializeUndo(data); return err },
+		"location":    func(data []byte) error { _, err := DeserializeTxLocation(data); return err },
+	}
+	for name, decode := range decoders {
+		if err := decode(nil); !errors.Is(err, ErrMalformedData) {
+			t.Errorf("%s: decoding nothing returned %v", name, err)
+		}
+		if err := decode([]byte{EncodingVersion + 1, 0, 0, 0, 0}); !errors.Is(err, ErrUnknownEncoding) {
+			t.Errorf("%s: decoding another version returned %v", name, err)
+		}
+	}
+
+	for size := 1; size < len(tx); size++ {
+		if _, err := DeserializeTransaction(tx[:size]); !errors.Is(err, ErrMalformedData) {
+			t.Fatalf("transaction cut to %d bytes returned %v", size, err)
+		}
+	}
+
+	// a block header of zeros announcing four billion transactions
+	hugeBlock := append(make([]byte, 1+4+8+4+4+4+8+8), 0xff, 0xff, 0xff, 0xff)
+	hugeBlock[0] = EncodingVersion
+
+	tests := []struct {
+		name   string
+		decode func([]byte) error
+		data   []byte
+	}{
+		{"trailing byte", decoders["transaction"], append(append([]byte{}, tx...), 0)},
+		// four billion inputs announced by a record of a few bytes
+		{"huge input count", decoders["transaction"], []byte{EncodingVersion, 0xff, 0xff, 0xff, 0xff}},
+		{"huge bytes length", decoders["location"], []byte{EncodingVersion, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}},
+		{"huge transaction count", decoders["block"], hugeBlock},
+		{"outputs out of order", decoders["outputs"], swapOutputs(outs)},
+	}
+
+	for _, test := range tests {
+		if err := test.decode(test.data); !errors.Is(err, ErrMalformedData) {
+			t.Errorf("%s: decoding returned %v", test.name, err)
+		}
+	}
+}
+
+// swapOutputs swaps the indexes of the two outputs of an encoded record
+func swapOutputs(data []byte) []byte {
+	swapped := append([]byte{}, data...)
+	// version, height, time and count come before the first index
+	first := 1 + 8 + 8 + 4
+	second := first + 4 + 8 + 4
+	swapped[first], swapped[second] = swapped[second], swapped[first]
+
+	return swapped
+}
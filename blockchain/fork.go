@@ -0,0 +1,236 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+
+	badger "github.com/dgraph-io/badger/v2"
+)
+
+var chainWorkPrefix = []byte("cw-")
+
+// ChainUpdate structure that lists the blocks a call removed from the main
+// chain, tip first, and the blocks it added to it, oldest first
+type ChainUpdate struct {
+	Disconnected []*Block
+	Connected    []*Block
+}
+
+// CalcWork function that returns the expected number of hashes needed to
+// meet the target in bits, 2^256 / (target + 1)
+func CalcWork(bits uint32) *big.Int {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+
+	denominator := new(big.Int).Add(target, big.NewInt(1))
+	work := new(big.Int).Lsh(big.NewInt(1), 256)
+
+	return work.Div(work, denominator)
+}
+
+func chainWorkKey(blockHash []byte) []byte {
+	return append(append([]byte{}, chainWorkPrefix...), blockHash...)
+}
+
+// ChainWork method that returns the total work of the chain ending at the
+// given block
+func (bc *BlockChain) ChainWork(blockHash []byte) (*big.Int, error) {
+	var work *big.Int
+
+	err := bc.Database.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(chainWorkKey(blockHash))
+		if err == badger.ErrKeyNotFound {
+			return fmt.Errorf("%w: %x", ErrBlockNotFound, blockHash)
+		}
+		if err != nil {
+			return err
+		}
+
+		value, err := item.ValueCopy(nil)
+		work = new(big.Int).SetBytes(value)
+
+		return err
+	})
+
+	return work, err
+}
+
+func setTip(txn *badger.Txn, blockHash []byte) error {
+	return txn.Set([]byte("lh"), blockHash)
+}
+
+// connectBlock makes a block that extends the tip the new tip and moves
+// the UTXO set along with it
+func (bc *BlockChain) connectBlock(block *Block) error {
+	if err := bc.ValidateBlock(block); err != nil {
+		return err
+	}
+
+	return bc.applyBlock(block)
+}
+
+// applyBlock moves the tip, the UTXO set, the height index and the
+// transaction index to an already validated block, all in one database
+// transaction so a failure leaves them at the old tip
+func (bc *BlockChain) applyBlock(block *Block) error {
+	UTXOSet := UTXOSet{bc}
+
+	err := bc.Database.Update(func(txn *badger.Txn) error {
+		if err := UTXOSet.Update(txn, block); err != nil {
+			return err
+		}
+		if err := putHeight(txn, block); err != nil {
+			return err
+		}
+		if bc.TxIndex {
+			if err := indexBlock(txn, block); err != nil {
+				return err
+			}
+		}
+		return setTip(txn, block.Hash)
+	})
+	if err != nil {
+		return err
+	}
+	bc.LastHash = block.Hash
+
+	return nil
+}
+
+// findFork walks the current chain and the branch ending at block back to
+// the block they share, it returns the main chain blocks above the fork,
+// tip first, and the branch blocks above the fork, oldest first
+func (bc *BlockChain) findFork(block *Block) ([]*Block, []*Block, error) {
+	var detach, attach []*Block
+
+	tip, err := bc.GetBlock(bc.LastHash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	main := &tip
+	branch := block
+
+	step := func(b *Block) (*Block, error) {
+		parent, err := bc.GetBlock(b.PrevHash)
+		return &parent, err
+	}
+
+	for !bytes.Equal(main.Hash, branch.Hash) {
+		if main.Height >= branch.Height {
+			detach = append(detach, main)
+			if main, err = step(main); err != nil {
+				return nil, nil, err
+			}
+		} else {
+			attach = append([]*Block{branch}, attach...)
+			if branch, err = step(branch); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return detach, attach, nil
+}
+
+// disconnectBlock takes the tip block off the main chain, its parent becomes
+// the tip, the UTXO set is rolled back with the block's undo data and the
+// block leaves the height and transaction indexes, all in one database transaction
+func (bc *BlockChain) disconnectBlock(block *Block) error {
+	if !bytes.Equal(block.Hash, bc.LastHash) {
+		return fmt.Errorf("Block %x is not the tip", block.Hash)
+	}
+
+	UTXOSet := UTXOSet{bc}
+
+	err := bc.Database.Update(func(txn *badger.Txn) error {
+		if err := UTXOSet.Revert(txn, block); err != nil {
+			return err
+		}
+		if err := deleteHeight(txn, block); err != nil {
+			return err
+		}
+		if bc.TxIndex {
+			if err := unindexBlock(txn, block); err != nil {
+				return err
+			}
+		}
+		return setTip(txn, block.PrevHash)
+	})
+	if err != nil {
+		return err
+	}
+	bc.LastHash = block.PrevHash
+
+	return nil
+}
+
+// DisconnectTip method to take the tip block off the main chain, the block
+// stays stored so a heavier branch through it can bring it back
+func (bc *BlockChain) DisconnectTip() (*Block, error) {
+	tip, err := bc.GetBlock(bc.LastHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tip.PrevHash) == 0 {
+		return nil, errors.New("Cannot disconnect the genesis block")
+	}
+
+	return &tip, bc.disconnectBlock(&tip)
+}
+
+// reorganize switches the main chain to the branch ending at block, when a
+// branch block turns out to be invalid the previous chain is restored
+func (bc *BlockChain) reorganize(block *Block) (*ChainUpdate, error) {
+	detach, attach, err := bc.findFork(block)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Reorganizing: %d blocks out, %d blocks in\n", len(detach), len(attach))
+
+	for _, b := range detach {
+		if err := bc.disconnectBlock(b); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, b := range attach {
+		if err := bc.connectBlock(b); err != nil {
+			// forget the invalid part of the branch and go back to the old chain
+			for j := i - 1; j >= 0; j-- {
+				if undoErr := bc.disconnectBlock(attach[j]); undoErr != nil {
+					return nil, undoErr
+				}
+			}
+			for _, invalid := range attach[i:] {
+				if deleteErr := bc.deleteBlock(invalid.Hash); deleteErr != nil {
+					return nil, deleteErr
+				}
+			}
+			for j := len(detach) - 1; j >= 0; j-- {
+				if redoErr := bc.applyBlock(detach[j]); redoErr != nil {
+					return nil, redoErr
+				}
+			}
+
+			return nil, err
+		}
+	}
+
+	return &ChainUpdate{detach, attach}, nil
+}
+
+func (bc *BlockChain) deleteBlock(blockHash []byte) error {
+	return bc.Database.Update(func(txn *badger.Txn) error {
+		if err := txn.Delete(blockKey(blockHash)); err != nil {
+			return err
+		}
+		return txn.Delete(chainWorkKey(blockHash))
+	})
+}
@@ -0,0 +1,189 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	badger "github.com/dgraph-io/badger/v2"
+)
+
+// utxoSnapshot returns every record of the UTXO set by key
+func utxoSnapshot(t *testing.T, chain *BlockChain) map[string]string {
+	t.Helper()
+
+	snapshot := make(map[string]string)
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(utxoPrefix); it.ValidForPrefix(utxoPrefix); it.Next() {
+			v, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			snapshot[string(it.Item().KeyCopy(nil))] = string(v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return snapshot
+}
+
+// checkUTXOSet fails the test when the UTXO set differs from the one built
+// from scratch for the main chain
+func checkUTXOSet(t *testing.T, chain *BlockChain) {
+	t.Helper()
+
+	kept := utxoSnapshot(t, chain)
+	if err := (&UTXOSet{chain}).Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt := utxoSnapshot(t, chain); !reflect.DeepEqual(kept, rebuilt) {
+		t.Fatalf("UTXO set has %d records, rebuilding it gives %d that differ", len(kept), len(rebuilt))
+	}
+}
+
+// newBlockOn builds a block of only a coinbase on parent, which does not
+// have to be the tip
+func newBlockOn(t *testing.T, chain *BlockChain, parent *Block, miner string) *Block {
+	t.Helper()
+
+	bits, err := chain.CalcNextBits(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timestamp, err := chain.NextBlockTime(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase, err := CoinbaseTx(miner, "", parent.Height+1, 0, chain.Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return CreateBlock([]*Transaction{coinbase}, parent.Hash, parent.Height+1, bits, timestamp)
+}
+
+func hashes(blocks []*Block) [][]byte {
+	var result [][]byte
+	for _, block := range blocks {
+		result = append(result, block.Hash)
+	}
+
+	return result
+}
+
+func TestReorganizeToHeavierBranch(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+	alice, bob, other := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+
+	fork := mine(t, chain, alice.address)
+	mainBlock := mine(t, chain, bob.address, send(t, chain, alice, bob.address, 40, 1))
+
+	side1 := newBlockOn(t, chain, fork, other.address)
+	update, err := chain.ImportBlock(side1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(update.Connected) != 0 || !bytes.Equal(chain.LastHash, mainBlock.Hash) {
+		t.Fatal("a branch of equal work replaced the main chain")
+	}
+
+	side2 := newBlockOn(t, chain, side1, other.address)
+	update, err = chain.ImportBlock(side2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(chain.LastHash, side2.Hash) {
+		t.Fatalf("tip is %x, want the heavier branch %x", chain.LastHash, side2.Hash)
+	}
+	if !reflect.DeepEqual(hashes(update.Disconnected), hashes([]*Block{mainBlock})) {
+		t.Errorf("disconnected %x", hashes(update.Disconnected))
+	}
+	if !reflect.DeepEqual(hashes(update.Connected), hashes([]*Block{side1, side2})) {
+		t.Errorf("connected %x", hashes(update.Connected))
+	}
+
+	// the spend of the old branch is undone
+	if got := balance(t, chain, bob.address); got != 0 {
+		t.Errorf("bob has %d after the reorganization, want 0", got)
+	}
+	if got := balance(t, chain, alice.address); got != chain.Params.BlockSubsidy(1) {
+		t.Errorf("alice has %d after the reorganization, want %d", got, chain.Params.BlockSubsidy(1))
+	}
+	for height, block := range []*Block{side1, side2} {
+		indexed, err := chain.GetBlockHash(fork.Height + 1 + height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(indexed, block.Hash) {
+			t.Errorf("height %d is indexed as %x, want %x", block.Height, indexed, block.Hash)
+		}
+	}
+	checkUTXOSet(t, chain)
+}
+
+func TestReorganizeToInvalidBranch(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+	alice, bob, other := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+
+	fork := mine(t, chain, alice.address)
+	mainBlock := mine(t, chain, bob.address, send(t, chain, alice, bob.address, 40, 1))
+	before := utxoSnapshot(t, chain)
+
+	side1 := newBlockOn(t, chain, fork, other.address)
+	if _, err := chain.ImportBlock(side1); err != nil {
+		t.Fatal(err)
+	}
+
+	// the header is fine, the coinbase only fails once the block is connected
+	side2 := newBlockOn(t, chain, side1, other.address)
+	side2.Transactions[0].Outputs[0].Value++
+	rehash(side2.Transactions[0])
+	remine(side2)
+
+	if _, err := chain.ImportBlock(side2); !errors.Is(err, ErrBadCoinbaseAmount) {
+		t.Fatalf("importing the invalid branch returned %v", err)
+	}
+
+	if !bytes.Equal(chain.LastHash, mainBlock.Hash) {
+		t.Fatalf("tip is %x, want the old tip %x", chain.LastHash, mainBlock.Hash)
+	}
+	if after := utxoSnapshot(t, chain); !reflect.DeepEqual(before, after) {
+		t.Fatal("UTXO set is not restored after the invalid branch")
+	}
+	if stored, err := chain.HasBlock(side2.Hash); err != nil || stored {
+		t.Fatalf("invalid block is still stored: %v", err)
+	}
+	checkUTXOSet(t, chain)
+}
+
+func TestChainWork(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+	miner := newTestWallet(t)
+
+	genesisWork, err := chain.ChainWork(chain.LastHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := mine(t, chain, miner.address)
+
+	work, err := chain.ChainWork(block.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := genesisWork.Add(genesisWork, CalcWork(block.Bits))
+	if work.Cmp(want) != 0 {
+		t.Fatalf("chain work is %v, want %v", work, want)
+	}
+
+	if _, err := chain.ChainWork(bytes.Repeat([]byte{5}, 32)); !errors.Is(err, ErrBlockNotFound) {
+		t.Fatalf("chain work of an unknown block returned %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	badger "github.com/dgraph-io/badger/v2"
+)
+
+// heightPrefix keys the hash of the main chain block at every height, the
+// height is big endian so the keys sort in chain order
+var heightPrefix = []byte("height-")
+
+// BlockChainForwardIterator structure to walk the main chain from a height up
+// to the tip it had when the iterator was made
+type BlockChainForwardIterator struct {
+	NextHeight int
+	BestHeight int
+	chain      *BlockChain
+}
+
+func heightKey(height int) []byte {
+	key := make([]byte, len(heightPrefix)+8)
+	copy(key, heightPrefix)
+	binary.BigEndian.PutUint64(key[len(heightPrefix):], uint64(height))
+
+	return key
+}
+
+// GetBlockHash method that returns the hash of the main chain block at height
+func (bc *BlockChain) GetBlockHash(height int) ([]byte, error) {
+	var blockHash []byte
+
+	err := bc.Database.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(heightKey(height))
+		if err == badger.ErrKeyNotFound {
+			return fmt.Errorf("%w: no block at height %d", ErrBlockNotFound, height)
+		}
+		if err != nil {
+			return err
+		}
+		blockHash, err = item.ValueCopy(nil)
+
+		return err
+	})
+
+	return blockHash, err
+}
+
+// GetBlockByHeight method to find the main chain block at height
+func (bc *BlockChain) GetBlockByHeight(height int) (Block, error) {
+	if height < 0 {
+		return Block{}, fmt.Errorf("%w: no block at height %d", ErrBlockNotFound, height)
+	}
+
+	blockHash, err := bc.GetBlockHash(height)
+	if err != nil {
+		return Block{}, err
+	}
+
+	return bc.GetBlock(blockHash)
+}
+
+// ForwardIterator method that returns an iterator from the block at height
+// towards the tip
+func (bc *BlockChain) ForwardIterator(height int) (*BlockChainForwardIterator, error) {
+	bestHeight, err := bc.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlockChainForwardIterator{height, bestHeight, bc}, nil
+}
+
+// Next method for BlockChainForwardIterator structure, the block is nil once
+// the iterator went past the tip
+func (iterator *BlockChainForwardIterator) Next() (*Block, error) {
+	if iterator.NextHeight > iterator.BestHeight {
+		return nil, nil
+	}
+
+	block, err := iterator.chain.GetBlockByHeight(iterator.NextHeight)
+	if err != nil {
+		return nil, err
+	}
+	iterator.NextHeight++
+
+	return &block, nil
+}
+
+func putHeight(txn *badger.Txn, block *Block) error {
+	return txn.Set(heightKey(block.Height), block.Hash)
+}
+
+func deleteHeight(txn *badger.Txn, block *Block) error {
+	return txn.Delete(heightKey(block.Height))
+}
@@ -0,0 +1,64 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestHeightIndex(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+	miner := newTestWallet(t)
+
+	genesis, err := chain.GetBlock(chain.LastHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := []*Block{&genesis}
+	for i := 0; i < 3; i++ {
+		blocks = append(blocks, mine(t, chain, miner.address))
+	}
+
+	for height, want := range blocks {
+		block, err := chain.GetBlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(block.Hash, want.Hash) || block.Height != height {
+			t.Errorf("height %d gives block %x at height %d, want %x", height, block.Hash, block.Height, want.Hash)
+		}
+	}
+	for _, height := range []int{-1, len(blocks)} {
+		if _, err := chain.GetBlockByHeight(height); !errors.Is(err, ErrBlockNotFound) {
+			t.Errorf("GetBlockByHeight(%d) returned %v", height, err)
+		}
+	}
+
+	iterator, err := chain.ForwardIterator(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for height := 1; ; height++ {
+		block, err := iterator.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block == nil {
+			if height != len(blocks) {
+				t.Fatalf("iterator stopped at height %d, want %d", height, len(blocks))
+			}
+			break
+		}
+		if !bytes.Equal(block.Hash, blocks[height].Hash) {
+			t.Fatalf("iterator gives %x at height %d, want %x", block.Hash, height, blocks[height].Hash)
+		}
+	}
+
+	// a block taken off the main chain leaves the index
+	if _, err := chain.DisconnectTip(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.GetBlockHash(len(blocks) - 1); !errors.Is(err, ErrBlockNotFound) {
+		t.Fatalf("height of a disconnected block returned %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package blockchain
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// Timelocks work as in Bitcoin. LockTime keeps a transaction out of the chain
+// until a height, or a unix time when it is at least LockTimeThreshold, unless
+// every input has MaxSequence. An input whose Sequence does not have
+// SequenceDisableFlag set waits for its low 16 bits in blocks, or in units of
+// 512 seconds with SequenceTypeFlag, after the block of the output it spends.
+// Times are compared with the median time of the last blocks, not the block
+// timestamp a miner picks
+const (
+	// LockTimeThreshold is the first LockTime that is a unix time instead of a height
+	LockTimeThreshold = 500000000
+	// MaxSequence is the sequence of an input that is final
+	MaxSequence uint32 = 0xffffffff
+	// SequenceDisableFlag turns the relative timelock of an input off
+	SequenceDisableFlag uint32 = 1 << 31
+	// SequenceTypeFlag makes the relative timelock of an input count time instead of blocks
+	SequenceTypeFlag uint32 = 1 << 22
+	// SequenceMask is the part of a sequence that holds the relative timelock
+	SequenceMask uint32 = 0x0000ffff
+	// SequenceGranularity is the power of two of the seconds in a unit of a relative timelock
+	SequenceGranularity = 9
+
+	// medianTimeBlocks is the number of blocks the median time past is taken over
+	medianTimeBlocks = 11
+)
+
+var (
+	// ErrNonFinalTx error when the lock time of a transaction has not passed yet
+	ErrNonFinalTx = errors.New("Transaction is not final")
+	// ErrSequenceLocked error when an input is still locked by its relative timelock
+	ErrSequenceLocked = errors.New("Transaction input is still locked by its sequence")
+)
+
+// IsFinal method that tells whether a transaction may be in the block at
+// height with the median time past medianTime
+func (tx *Transaction) IsFinal(height int, medianTime int64) bool {
+	if tx.LockTime == 0 {
+		return true
+	}
+
+	if tx.LockTime < LockTimeThreshold {
+		if int64(tx.LockTime) < int64(height) {
+			return true
+		}
+	} else if int64(tx.LockTime) < medianTime {
+		return true
+	}
+
+	for _, in := range tx.Inputs {
+		if in.Sequence != MaxSequence {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sequenceLocked tells whether an input still waits for its relative timelock
+// in the block at height with the median time past medianTime, outs is the
+// unspent entry of the transaction the input spends and its Time is from coinTime
+func sequenceLocked(in TxInput, outs TxOutputs, height int, medianTime int64) bool {
+	if in.Sequence&SequenceDisableFlag != 0 {
+		return false
+	}
+
+	value := int64(in.Sequence & SequenceMask)
+	if in.Sequence&SequenceTypeFlag != 0 {
+		return medianTime < outs.Time+value<<SequenceGranularity
+	}
+
+	return int64(height) < int64(outs.Height)+value
+}
+
+// MedianTimePast method that returns the median timestamp of a block and the
+// blocks before it
+func (bc *BlockChain) MedianTimePast(block *Block) (int64, error) {
+	var timestamps []int64
+
+	for i := 0; i < medianTimeBlocks; i++ {
+		timestamps = append(timestamps, block.Timestamp)
+		if len(block.PrevHash) == 0 {
+			break
+		}
+
+		parent, err := bc.GetBlock(block.PrevHash)
+		if err != nil {
+			return 0, err
+		}
+		block = &parent
+	}
+
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	return timestamps[len(timestamps)/2], nil
+}
+
+// NextBlockTime method that returns the timestamp for a block on parent, the
+// current time unless it is not after the median time past of parent
+func (bc *BlockChain) NextBlockTime(parent *Block) (int64, error) {
+	medianTime, err := bc.MedianTimePast(parent)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().Unix()
+	if now <= medianTime {
+		return medianTime + 1, nil
+	}
+
+	return now, nil
+}
+
+// coinTime method that returns the time the relative timelocks of the outputs
+// of a block count from, the median time past of its parent as in BIP68 so a
+// miner cannot shorten them with the timestamp it picks. The genesis block has
+// no parent and uses its own timestamp
+func (bc *BlockChain) coinTime(block *Block) (int64, error) {
+	if len(block.PrevHash) == 0 {
+		return block.Timestamp, nil
+	}
+
+	parent, err := bc.GetBlock(block.PrevHash)
+	if err != nil {
+		return 0, err
+	}
+
+	return bc.MedianTimePast(&parent)
+}
+
+// CheckLockTime method for the script engine, the transaction must be locked
+// at least until lockTime, counted the same way
+func (c txChecker) CheckLockTime(lockTime int64) bool {
+	txLockTime := int64(c.tx.LockTime)
+	if (txLockTime < LockTimeThreshold) != (lockTime < LockTimeThreshold) {
+		return false
+	}
+	if lockTime > txLockTime {
+		return false
+	}
+
+	// a final input would switch the lock time of the transaction off
+	return c.tx.Inputs[c.inID].Sequence != MaxSequence
+}
+
+// CheckSequence method for the script engine, the input must be locked at
+// least for sequence, counted the same way
+func (c txChecker) CheckSequence(sequence int64) bool {
+	if uint32(sequence)&SequenceDisableFlag != 0 {
+		return true
+	}
+
+	txSequence := c.tx.Inputs[c.inID].Sequence
+	if txSequence&SequenceDisableFlag != 0 {
+		return false
+	}
+	if (txSequence&SequenceTypeFlag != 0) != (uint32(sequence)&SequenceTypeFlag != 0) {
+		return false
+	}
+
+	return uint32(sequence)&SequenceMask <= txSequence&SequenceMask
+}
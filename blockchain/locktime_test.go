@@ -0,0 +1,246 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shortdaddy0711/golang-blockchain/signer"
+)
+
+func TestIsFinal(t *testing.T) {
+	const height, medianTime = 100, LockTimeThreshold + 1000
+
+	tests := []struct {
+		name      string
+		lockTime  uint32
+		sequences []uint32
+		final     bool
+	}{
+		{"no lock time", 0, []uint32{0}, true},
+		{"height passed", height - 1, []uint32{0}, true},
+		{"height reached", height, []uint32{0}, false},
+		{"height ahead", height + 1, []uint32{MaxSequence - 1}, false},
+		{"time passed", medianTime - 1, []uint32{0}, true},
+		{"time reached", medianTime, []uint32{0}, false},
+		{"time ahead with final inputs", medianTime + 1, []uint32{MaxSequence, MaxSequence}, true},
+		{"height ahead with one final input", height + 1, []uint32{MaxSequence, 0}, false},
+	}
+
+	for _, test := range tests {
+		tx := Transaction{LockTime: test.lockTime}
+		for _, sequence := range test.sequences {
+			tx.Inputs = append(tx.Inputs, TxInput{Sequence: sequence})
+		}
+
+		if final := tx.IsFinal(height, medianTime); final != test.final {
+			t.Errorf("%s: IsFinal = %v, want %v", test.name, final, test.final)
+		}
+	}
+}
+
+func TestSequenceLocked(t *testing.T) {
+	const units = 3
+	outs := TxOutputs{Height: 10, Time: 1000000}
+	timeLock := int64(units << SequenceGranularity)
+
+	tests := []struct {
+		name       string
+		sequence   uint32
+		height     int
+		medianTime int64
+		locked     bool
+	}{
+		{"final", MaxSequence, 10, outs.Time, false},
+		{"disabled", SequenceDisableFlag | units, 10, outs.Time, false},
+		{"blocks waiting", units, 10 + units - 1, outs.Time, true},
+		{"blocks passed", units, 10 + units, outs.Time, false},
+		{"only the low bits count", 1<<16 | units, 10 + units, outs.Time, false},
+		{"time waiting", SequenceTypeFlag | units, 100, outs.Time + timeLock - 1, true},
+		{"time passed", SequenceTypeFlag | units, 10, outs.Time + timeLock, false},
+	}
+
+	for _, test := range tests {
+		in := TxInput{Sequence: test.sequence}
+		if locked := sequenceLocked(in, outs, test.height, test.medianTime); locked != test.locked {
+			t.Errorf("%s: sequenceLocked = %v, want %v", test.name, locked, test.locked)
+		}
+	}
+}
+
+func TestCheckLockTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		txLock   uint32
+		sequence uint32
+		lockTime int64
+		ok       bool
+	}{
+		{"height reached", 100, 0, 100, true},
+		{"height below", 100, 0, 99, true},
+		{"height above", 100, 0, 101, false},
+		{"time reached", LockTimeThreshold + 5, 0, LockTimeThreshold + 5, true},
+		{"time above", LockTimeThreshold + 5, 0, LockTimeThreshold + 6, false},
+		{"time against height", LockTimeThreshold + 5, 0, 100, false},
+		{"height against time", 100, 0, LockTimeThreshold, false},
+		{"final input", 100, MaxSequence, 100, false},
+	}
+
+	for _, test := range tests {
+		tx := &Transaction{Inputs: []TxInput{{Sequence: test.sequence}}, LockTime: test.txLock}
+		if ok := (txChecker{tx, 0}).CheckLockTime(test.lockTime); ok != test.ok {
+			t.Errorf("%s: CheckLockTime = %v, want %v", test.name, ok, test.ok)
+		}
+	}
+}
+
+func TestCheckSequence(t *testing.T) {
+	tests := []struct {
+		name       string
+		txSequence uint32
+		sequence   int64
+		ok         bool
+	}{
+		{"blocks reached", 5, 5, true},
+		{"blocks above", 5, 6, false},
+		{"time reached", SequenceTypeFlag | 5, int64(SequenceTypeFlag | 5), true},
+		{"time against blocks", SequenceTypeFlag | 5, 5, false},
+		{"blocks against time", 5, int64(SequenceTypeFlag | 5), false},
+		{"disabled input", SequenceDisableFlag | 5, 5, false},
+		{"disabled script lock", 0, int64(SequenceDisableFlag), true},
+	}
+
+	for _, test := range tests {
+		tx := &Transaction{Inputs: []TxInput{{Sequence: test.txSequence}}}
+		if ok := (txChecker{tx, 0}).CheckSequence(test.sequence); ok != test.ok {
+			t.Errorf("%s: CheckSequence = %v, want %v", test.name, ok, test.ok)
+		}
+	}
+}
+
+func TestMedianTimePast(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+	miner := newTestWallet(t)
+
+	genesis, err := chain.GetBlock(chain.LastHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if median, err := chain.MedianTimePast(&genesis); err != nil || median != genesis.Timestamp {
+		t.Fatalf("median time past of the genesis block is %d, %v", median, err)
+	}
+
+	// timestamps do not have to increase, only be after the median time past
+	offsets := []int64{100, 300, 200, 400, 500, 600, 700, 800, 900, 1000, 1100, 1200}
+	var block *Block
+	for _, offset := range offsets {
+		block = newBlock(t, chain, miner.address)
+		block.Timestamp = genesis.Timestamp + offset
+		remine(block)
+		if _, err := chain.ImportBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the last 11 offsets sorted: 200 300 400 500 600 [700] 800 900 1000 1100 1200
+	median, err := chain.MedianTimePast(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := genesis.Timestamp + 700; median != want {
+		t.Fatalf("median time past is %d, want %d", median, want)
+	}
+
+	block = newBlock(t, chain, miner.address)
+	block.Timestamp = median
+	remine(block)
+	if _, err := chain.ImportBlock(block); !errors.Is(err, ErrTimeTooOld) {
+		t.Fatalf("block at the median time past returned %v", err)
+	}
+	block.Timestamp = median + 1
+	remine(block)
+	if _, err := chain.ImportBlock(block); err != nil {
+		t.Fatalf("block after the median time past returned %v", err)
+	}
+}
+
+func TestCoinTimeIsMedianTimePast(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+	miner := newTestWallet(t)
+
+	mine(t, chain, miner.address)
+	parent, err := chain.GetBlock(chain.LastHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	medianTime, err := chain.MedianTimePast(&parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a timestamp far ahead must not shorten relative timelocks on the outputs
+	block := newBlock(t, chain, miner.address)
+	block.Timestamp = time.Now().Add(time.Hour).Unix()
+	remine(block)
+	if _, err := chain.ImportBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	outs, found, err := (&UTXOSet{chain}).FindOutputs(block.Transactions[0].ID)
+	if err != nil || !found {
+		t.Fatalf("coinbase outputs not found: %v", err)
+	}
+	if outs.Time != medianTime {
+		t.Fatalf("outputs have time %d, want the median time past %d of the parent", outs.Time, medianTime)
+	}
+	checkUTXOSet(t, chain)
+}
+
+func TestTimelockedTransactions(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+	alice, bob, miner := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+
+	mine(t, chain, alice.address)
+
+	// locked until the block after height 2, the next block is 2
+	tx, err := NewTransaction(signer.NewKeySigner(alice.PrivateKey), alice.PublicKey, bob.address, 10, 1, 2, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.ValidateTransaction(tx); !errors.Is(err, ErrNonFinalTx) {
+		t.Fatalf("transaction locked until height 2 returned %v", err)
+	}
+
+	// the output alice spends is at height 1, two blocks later is height 3
+	relative := send(t, chain, alice, bob.address, 10, 1)
+	for i := range relative.Inputs {
+		relative.Inputs[i].Sequence = 2
+	}
+	rehash(relative)
+	if err := chain.SignTransaction(relative, signer.NewKeySigner(alice.PrivateKey), alice.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.ValidateTransaction(relative); !errors.Is(err, ErrSequenceLocked) {
+		t.Fatalf("input locked for two blocks returned %v", err)
+	}
+
+	block := newBlock(t, chain, miner.address)
+	block.Transactions = append(block.Transactions, relative)
+	remine(block)
+	if _, err := chain.ImportBlock(block); !errors.Is(err, ErrSequenceLocked) {
+		t.Fatalf("block with a sequence locked input returned %v", err)
+	}
+
+	mine(t, chain, miner.address)
+
+	if _, err := chain.ValidateTransaction(tx); err != nil {
+		t.Fatalf("transaction locked until height 2 is not valid at height 3: %v", err)
+	}
+	if _, err := chain.ValidateTransaction(relative); err != nil {
+		t.Fatalf("input locked for two blocks is not valid at height 3: %v", err)
+	}
+	mine(t, chain, miner.address, relative)
+	if got := balance(t, chain, bob.address); got != 10 {
+		t.Fatalf("bob has %d, want 10", got)
+	}
+}
@@ -0,0 +1,198 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// MinRelayFee is the smallest fee a transaction must pay to be accepted into the mempool
+const MinRelayFee = 1
+
+// maxMempoolTransactions is how many transactions the mempool keeps pending
+const maxMempoolTransactions = 5000
+
+var (
+	// ErrFeeTooLow error when a transaction pays less than MinRelayFee
+	ErrFeeTooLow = errors.New("Transaction fee is below the minimum relay fee")
+	// ErrMempoolFull error when the mempool has no room for another transaction
+	ErrMempoolFull = errors.New("Mempool is full")
+	// ErrTxInMempool error when the transaction is already pending
+	ErrTxInMempool = errors.New("Transaction is already in the mempool")
+	// ErrDoubleSpend error when an input is used twice or already spent by a pending transaction
+	ErrDoubleSpend = errors.New("Transaction input is already spent")
+)
+
+// Mempool structure that keeps verified transactions until a miner takes them
+type Mempool struct {
+	UTXOSet      *UTXOSet
+	transactions map[string]*Transaction
+	fees         map[string]int
+	spent        map[string]string
+	order        []string
+	limit        int
+	mu           sync.Mutex
+}
+
+// NewMempool function to create an empty mempool on top of a UTXO set
+func NewMempool(utxo *UTXOSet) *Mempool {
+	return &Mempool{
+		UTXOSet:      utxo,
+		transactions: make(map[string]*Transaction),
+		fees:         make(map[string]int),
+		spent:        make(map[string]string),
+		limit:        maxMempoolTransactions,
+	}
+}
+
+func outpoint(txID []byte, out int) string {
+	return fmt.Sprintf("%x:%d", txID, out)
+}
+
+// Add method to accept a transaction into the mempool, it must be valid on
+// the tip, pay at least MinRelayFee and not spend what a pending transaction
+// spends. A full mempool drops its lowest fee transaction for one paying more
+func (mp *Mempool) Add(tx *Transaction) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	txID := hex.EncodeToString(tx.ID)
+	if _, ok := mp.transactions[txID]; ok {
+		return ErrTxInMempool
+	}
+
+	fee, err := mp.UTXOSet.Blockchain.ValidateTransaction(tx)
+	if err != nil {
+		return err
+	}
+	if fee < MinRelayFee {
+		return fmt.Errorf("%w: pays %d, needs %d", ErrFeeTooLow, fee, MinRelayFee)
+	}
+
+	for _, in := range tx.Inputs {
+		point := outpoint(in.ID, in.Out)
+		if other, ok := mp.spent[point]; ok {
+			return fmt.Errorf("%w: %s is spent by pending transaction %s", ErrDoubleSpend, point, other)
+		}
+	}
+
+	if len(mp.transactions) >= mp.limit {
+		lowest := mp.lowestFee()
+		if mp.fees[lowest] >= fee {
+			return fmt.Errorf("%w: %d transactions pay at least %d", ErrMempoolFull, len(mp.transactions), mp.fees[lowest])
+		}
+		mp.remove(lowest)
+	}
+
+	for _, in := range tx.Inputs {
+		mp.spent[outpoint(in.ID, in.Out)] = txID
+	}
+	mp.transactions[txID] = tx
+	mp.fees[txID] = fee
+	mp.order = append(mp.order, txID)
+
+	return nil
+}
+
+// Has method to check whether a transaction is pending
+func (mp *Mempool) Has(txID []byte) bool {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	_, ok := mp.transactions[hex.EncodeToString(txID)]
+
+	return ok
+}
+
+// Get method to find a pending transaction by its id
+func (mp *Mempool) Get(txID []byte) (*Transaction, bool) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	tx, ok := mp.transactions[hex.EncodeToString(txID)]
+
+	return tx, ok
+}
+
+// Count method that returns the number of pending transactions
+func (mp *Mempool) Count() int {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	return len(mp.transactions)
+}
+
+// Transactions method that returns the pending transactions in the order they arrived
+func (mp *Mempool) Transactions() []*Transaction {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	var txs []*Transaction
+	for _, txID := range mp.order {
+		txs = append(txs, mp.transactions[txID])
+	}
+
+	return txs
+}
+
+// Remove method to drop a pending transaction
+func (mp *Mempool) Remove(txID []byte) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	mp.remove(hex.EncodeToString(txID))
+}
+
+func (mp *Mempool) remove(txID string) {
+	tx, ok := mp.transactions[txID]
+	if !ok {
+		return
+	}
+
+	for _, in := range tx.Inputs {
+		delete(mp.spent, outpoint(in.ID, in.Out))
+	}
+	delete(mp.transactions, txID)
+	delete(mp.fees, txID)
+
+	for i, id := range mp.order {
+		if id == txID {
+			mp.order = append(mp.order[:i], mp.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// lowestFee returns the pending transaction that pays the lowest fee, the
+// one that arrived last among equals
+func (mp *Mempool) lowestFee() string {
+	lowest := ""
+	for _, txID := range mp.order {
+		if lowest == "" || mp.fees[txID] <= mp.fees[lowest] {
+			lowest = txID
+		}
+	}
+
+	return lowest
+}
+
+// RemoveBlock method to drop the transactions of a block and the pending
+// transactions that conflict with them
+func (mp *Mempool) RemoveBlock(block *Block) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	for _, tx := range block.Transactions {
+		mp.remove(hex.EncodeToString(tx.ID))
+
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Inputs {
+			if other, ok := mp.spent[outpoint(in.ID, in.Out)]; ok {
+				mp.remove(other)
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMempoolAdd(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	mine(t, chain, alice.address)
+
+	mp := NewMempool(&UTXOSet{chain})
+	tx := send(t, chain, alice, bob.address, 10, 1)
+	if err := mp.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+	if !mp.Has(tx.ID) || mp.Count() != 1 {
+		t.Fatalf("mempool has %d transactions after adding one", mp.Count())
+	}
+	if got, ok := mp.Get(tx.ID); !ok || got != tx {
+		t.Fatal("Get does not return the added transaction")
+	}
+
+	if err := mp.Add(tx); !errors.Is(err, ErrTxInMempool) {
+		t.Fatalf("adding a pending transaction again returned %v", err)
+	}
+
+	// the mempool checks transactions like a block would
+	invalid := send(t, chain, alice, bob.address, 10, 1)
+	invalid.Outputs[0].Value++
+	rehash(invalid)
+	if err := mp.Add(invalid); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("adding a transaction with a bad signature returned %v", err)
+	}
+}
+
+func TestMempoolDoubleSpend(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	mine(t, chain, alice.address)
+
+	mp := NewMempool(&UTXOSet{chain})
+	first := send(t, chain, alice, bob.address, 10, 1)
+	second := send(t, chain, alice, bob.address, 20, 1)
+	if err := mp.Add(first); err != nil {
+		t.Fatal(err)
+	}
+
+	// both spend the only output of alice
+	if err := mp.Add(second); !errors.Is(err, ErrDoubleSpend) {
+		t.Fatalf("adding a transaction spending a pending input returned %v", err)
+	}
+	if mp.Has(second.ID) || mp.Count() != 1 {
+		t.Fatal("the double spend is pending")
+	}
+
+	mp.Remove(first.ID)
+	if err := mp.Add(second); err != nil {
+		t.Fatalf("input is still taken after the pending transaction was removed: %v", err)
+	}
+}
+
+func TestMempoolFeeFloor(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	mine(t, chain, alice.address)
+
+	mp := NewMempool(&UTXOSet{chain})
+	if err := mp.Add(send(t, chain, alice, bob.address, 10, MinRelayFee-1)); !errors.Is(err, ErrFeeTooLow) {
+		t.Fatalf("adding a transaction below the minimum relay fee returned %v", err)
+	}
+	if err := mp.Add(send(t, chain, alice, bob.address, 10, MinRelayFee)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMempoolFull(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+	alice, bob, carol := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+	mine(t, chain, alice.address)
+	mine(t, chain, bob.address)
+	mine(t, chain, carol.address)
+
+	mp := NewMempool(&UTXOSet{chain})
+	mp.limit = 1
+	cheap := send(t, chain, alice, bob.address, 10, 2)
+	if err := mp.Add(cheap); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.Add(send(t, chain, bob, alice.address, 10, 2)); !errors.Is(err, ErrMempoolFull) {
+		t.Fatalf("adding to a full mempool without a higher fee returned %v", err)
+	}
+
+	// a higher fee takes the place of the lowest one
+	better := send(t, chain, carol, alice.address, 10, 3)
+	if err := mp.Add(better); err != nil {
+		t.Fatal(err)
+	}
+	if mp.Has(cheap.ID) || !mp.Has(better.ID) || mp.Count() != 1 {
+		t.Fatal("the higher fee transaction did not replace the lowest one")
+	}
+}
+
+func TestMempoolRemoveBlock(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+	alice, bob, miner := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+	mine(t, chain, alice.address)
+	mine(t, chain, bob.address)
+
+	mp := NewMempool(&UTXOSet{chain})
+	included := send(t, chain, bob, alice.address, 10, 1)
+	pending := send(t, chain, alice, bob.address, 10, 1)
+	conflicting := send(t, chain, alice, miner.address, 20, 1)
+	for _, tx := range []*Transaction{included, pending} {
+		if err := mp.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the block spends the output of alice that the pending transaction spends
+	block := mine(t, chain, miner.address, included, conflicting)
+	mp.RemoveBlock(block)
+
+	if mp.Has(included.ID) {
+		t.Fatal("a transaction of the block is still pending")
+	}
+	if mp.Has(pending.ID) {
+		t.Fatal("a transaction spending an output the block spent is still pending")
+	}
+	if mp.Count() != 0 {
+		t.Fatalf("mempool has %d transactions, want 0", mp.Count())
+	}
+}
@@ -0,0 +1,109 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+)
+
+// Leaves and inner nodes are hashed with different prefixes so an inner node
+// can never be passed off as a leaf in a proof
+var (
+	merkleLeafPrefix = []byte{0x00}
+	merkleNodePrefix = []byte{0x01}
+)
+
+// MerkleTree structure that keeps every level of the tree, leaves first
+type MerkleTree struct {
+	Levels [][][]byte
+}
+
+// MerkleProofNode structure for one step of an inclusion proof,
+// Left tells whether the sibling hash sits on the left side
+type MerkleProofNode struct {
+	Hash []byte
+	Left bool
+}
+
+func merkleLeaf(data []byte) []byte {
+	hash := sha256.Sum256(append(append([]byte{}, merkleLeafPrefix...), data...))
+
+	return hash[:]
+}
+
+func merkleParent(left, right []byte) []byte {
+	data := bytes.Join([][]byte{merkleNodePrefix, left, right}, []byte{})
+	hash := sha256.Sum256(data)
+
+	return hash[:]
+}
+
+// NewMerkleTree function to build a tree from the given leaves,
+// a node without a sibling is carried up to the next level unchanged
+func NewMerkleTree(data [][]byte) *MerkleTree {
+	var leaves [][]byte
+
+	for _, datum := range data {
+		leaves = append(leaves, merkleLeaf(datum))
+	}
+
+	tree := MerkleTree{[][][]byte{leaves}}
+
+	for level := leaves; len(level) > 1; {
+		var next [][]byte
+
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+			} else {
+				next = append(next, merkleParent(level[i], level[i+1]))
+			}
+		}
+
+		tree.Levels = append(tree.Levels, next)
+		level = next
+	}
+
+	return &tree
+}
+
+// Root method that returns the merkle root, the hash of nothing for an empty tree
+func (t *MerkleTree) Root() []byte {
+	top := t.Levels[len(t.Levels)-1]
+	if len(top) == 0 {
+		hash := sha256.Sum256([]byte{})
+		return hash[:]
+	}
+
+	return top[0]
+}
+
+// Proof method that returns the sibling hashes from the leaf at index up to the root
+func (t *MerkleTree) Proof(index int) []MerkleProofNode {
+	var proof []MerkleProofNode
+
+	for _, level := range t.Levels[:len(t.Levels)-1] {
+		if index%2 == 1 {
+			proof = append(proof, MerkleProofNode{level[index-1], true})
+		} else if index+1 < len(level) {
+			proof = append(proof, MerkleProofNode{level[index+1], false})
+		}
+		index /= 2
+	}
+
+	return proof
+}
+
+// VerifyMerkleProof function to check that data is a leaf of the tree with the given root
+func VerifyMerkleProof(root, data []byte, proof []MerkleProofNode) bool {
+	hash := merkleLeaf(data)
+
+	for _, node := range proof {
+		if node.Left {
+			hash = merkleParent(node.Hash, hash)
+		} else {
+			hash = merkleParent(hash, node.Hash)
+		}
+	}
+
+	return bytes.Equal(hash, root)
+}
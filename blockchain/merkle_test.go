@@ -0,0 +1,71 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+)
+
+func merkleTestData(n int) [][]byte {
+	var data [][]byte
+	for i := 0; i < n; i++ {
+		data = append(data, []byte(fmt.Sprintf("tx %d", i)))
+	}
+
+	return data
+}
+
+func TestMerkleRoot(t *testing.T) {
+	a, b, c := []byte("a"), []byte("b"), []byte("c")
+
+	tests := []struct {
+		name string
+		data [][]byte
+		want []byte
+	}{
+		{"one leaf", [][]byte{a}, merkleLeaf(a)},
+		{"two leaves", [][]byte{a, b}, merkleParent(merkleLeaf(a), merkleLeaf(b))},
+		// the odd leaf is carried up, not paired with itself
+		{"three leaves", [][]byte{a, b, c}, merkleParent(merkleParent(merkleLeaf(a), merkleLeaf(b)), merkleLeaf(c))},
+	}
+
+	for _, test := range tests {
+		if root := NewMerkleTree(test.data).Root(); string(root) != string(test.want) {
+			t.Errorf("%s: root %x, want %x", test.name, root, test.want)
+		}
+	}
+
+	empty := sha256.Sum256([]byte{})
+	if root := NewMerkleTree(nil).Root(); string(root) != string(empty[:]) {
+		t.Errorf("empty tree: root %x, want %x", root, empty)
+	}
+}
+
+func TestMerkleProofs(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		data := merkleTestData(n)
+		tree := NewMerkleTree(data)
+		root := tree.Root()
+
+		for i := range data {
+			proof := tree.Proof(i)
+			if !VerifyMerkleProof(root, data[i], proof) {
+				t.Fatalf("%d leaves: proof of leaf %d does not verify", n, i)
+			}
+			if VerifyMerkleProof(root, []byte("other"), proof) {
+				t.Fatalf("%d leaves: proof of leaf %d verifies other data", n, i)
+			}
+		}
+	}
+}
+
+func TestMerkleProofRejectsInnerNode(t *testing.T) {
+	tree := NewMerkleTree(merkleTestData(4))
+
+	// the children of the root passed off as the data of a single leaf
+	inner := tree.Levels[1]
+	forged := append(append([]byte{}, inner[0]...), inner[1]...)
+	if VerifyMerkleProof(tree.Root(), forged, nil) {
+		t.Fatal("two inner nodes were accepted as a leaf")
+	}
+}
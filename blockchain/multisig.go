@@ -0,0 +1,200 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/shortdaddy0711/golang-blockchain/script"
+	"github.com/shortdaddy0711/golang-blockchain/signer"
+	"github.com/shortdaddy0711/golang-blockchain/wallet"
+)
+
+// ErrNotMultiSig error when an input does not spend a multisig output
+var ErrNotMultiSig = errors.New("Input does not spend a multisig output")
+
+// NewMultiSigTransaction function to build a transaction paying amount and fee
+// out of the outputs of the multisig address of redeemScript, the change goes
+// back to the same address. Every input carries the redeem script and no signature,
+// the signers add theirs with SignPartial
+func NewMultiSigTransaction(redeemScript []byte, to string, amount, fee int, UTXO *UTXOSet) (*Transaction, error) {
+	if _, _, ok := script.ExtractMultiSig(redeemScript); !ok {
+		return nil, errors.New("Redeem script is not a multisig script")
+	}
+
+	p := UTXO.Blockchain.Params
+	from := string(wallet.ScriptHashAddress(script.Hash160(redeemScript), p))
+	tx, err := newSpend(script.PayToScriptHash(script.Hash160(redeemScript)), from, to, amount, fee, 0, UTXO)
+	if err != nil {
+		return nil, err
+	}
+
+	for inID := range tx.Inputs {
+		tx.Inputs[inID].ScriptSig = script.MultiSigSignatureScript(nil, redeemScript)
+	}
+	tx.ID = tx.Hash()
+
+	return tx, nil
+}
+
+// multiSigInput structure of the signatures collected for one input, by the
+// index of the public key that made them
+type multiSigInput struct {
+	redeemScript []byte
+	required     int
+	pubKeys      [][]byte
+	sigs         [][]byte
+}
+
+// multiSigInput method that reads the redeem script and the signatures so far
+// of the input at inID
+func (tx *Transaction) multiSigInput(inID int) (*multiSigInput, error) {
+	pushed, err := script.PushedData(tx.Inputs[inID].ScriptSig)
+	if err != nil || len(pushed) == 0 {
+		return nil, fmt.Errorf("%w: input %d", ErrNotMultiSig, inID)
+	}
+
+	redeemScript := pushed[len(pushed)-1]
+	required, pubKeys, ok := script.ExtractMultiSig(redeemScript)
+	if !ok {
+		return nil, fmt.Errorf("%w: input %d", ErrNotMultiSig, inID)
+	}
+
+	in := &multiSigInput{redeemScript, required, pubKeys, make([][]byte, len(pubKeys))}
+	in.addSignatures(txChecker{tx, inID}, pushed[:len(pushed)-1])
+
+	return in, nil
+}
+
+// addSignatures keeps every signature that one of the public keys made
+func (in *multiSigInput) addSignatures(checker txChecker, sigs [][]byte) {
+	for _, sig := range sigs {
+		if len(sig) == 0 {
+			continue
+		}
+		for i, pubKey := range in.pubKeys {
+			if in.sigs[i] == nil && checker.CheckSig(sig, pubKey, in.redeemScript) {
+				in.sigs[i] = sig
+				break
+			}
+		}
+	}
+}
+
+// signatureScript returns the unlocking script with at most the required
+// number of signatures, in the order of their public keys
+func (in *multiSigInput) signatureScript() []byte {
+	var sigs [][]byte
+	for _, sig := range in.sigs {
+		if sig != nil && len(sigs) < in.required {
+			sigs = append(sigs, sig)
+		}
+	}
+
+	return script.MultiSigSignatureScript(sigs, in.redeemScript)
+}
+
+// missing returns how many signatures the input still needs
+func (in *multiSigInput) missing() int {
+	missing := in.required
+	for _, sig := range in.sigs {
+		if sig != nil {
+			missing--
+		}
+	}
+	if missing < 0 {
+		return 0
+	}
+
+	return missing
+}
+
+// SignPartial method to add the signatures s makes for the public keys of the
+// multisig inputs, keys it does not hold are skipped, it returns how many
+// signatures were added
+func (tx *Transaction) SignPartial(s signer.Signer) (int, error) {
+	added := 0
+
+	for inID := range tx.Inputs {
+		in, err := tx.multiSigInput(inID)
+		if err != nil {
+			return 0, err
+		}
+		hash := tx.sigHash(inID, in.redeemScript)
+
+		for i, pubKey := range in.pubKeys {
+			if in.sigs[i] != nil {
+				continue
+			}
+
+			sig, err := s.Sign(pubKey, hash)
+			if errors.Is(err, signer.ErrUnknownKey) {
+				continue
+			}
+			if err != nil {
+				return 0, err
+			}
+			in.sigs[i] = sig
+			added++
+		}
+
+		tx.Inputs[inID].ScriptSig = in.signatureScript()
+	}
+	tx.ID = tx.Hash()
+
+	return added, nil
+}
+
+// CombineTransactions function to merge the signatures of copies of the same
+// multisig transaction that were signed apart
+func CombineTransactions(txs []*Transaction) (*Transaction, error) {
+	if len(txs) == 0 {
+		return nil, errors.New("No transactions to combine")
+	}
+
+	combined := *txs[0]
+	combined.Inputs = append([]TxInput{}, txs[0].Inputs...)
+
+	unsigned := combined.TrimmedCopy()
+	for _, tx := range txs[1:] {
+		if other := tx.TrimmedCopy(); !bytes.Equal(other.Serialize(), unsigned.Serialize()) {
+			return nil, fmt.Errorf("Transaction %x is not a copy of %x", tx.ID, combined.ID)
+		}
+	}
+
+	for inID := range combined.Inputs {
+		in, err := combined.multiSigInput(inID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tx := range txs[1:] {
+			other, err := tx.multiSigInput(inID)
+			if err != nil {
+				return nil, err
+			}
+			in.addSignatures(txChecker{&combined, inID}, other.sigs)
+		}
+
+		combined.Inputs[inID].ScriptSig = in.signatureScript()
+	}
+	combined.ID = combined.Hash()
+
+	return &combined, nil
+}
+
+// MissingSignatures method that returns how many signatures the multisig
+// inputs still need before the transaction is valid
+func (tx *Transaction) MissingSignatures() (int, error) {
+	missing := 0
+
+	for inID := range tx.Inputs {
+		in, err := tx.multiSigInput(inID)
+		if err != nil {
+			return 0, err
+		}
+		missing += in.missing()
+	}
+
+	return missing, nil
+}
@@ -0,0 +1,114 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shortdaddy0711/golang-blockchain/params"
+	"github.com/shortdaddy0711/golang-blockchain/signer"
+	"github.com/shortdaddy0711/golang-blockchain/wallet"
+)
+
+// copyTransaction returns a copy that shares nothing with tx
+func copyTransaction(t *testing.T, tx *Transaction) *Transaction {
+	t.Helper()
+
+	copied, err := DeserializeTransaction(tx.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &copied
+}
+
+func TestMultiSigPartialSigning(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+	alice, bob, miner := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+	keys := []testWallet{newTestWallet(t), newTestWallet(t), newTestWallet(t)}
+
+	address, redeemScript, err := wallet.MultiSigAddress(2,
+		[][]byte{keys[0].PublicKey, keys[1].PublicKey, keys[2].PublicKey}, &params.RegTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mine(t, chain, alice.address)
+	mine(t, chain, miner.address, send(t, chain, alice, address, 50, 1))
+
+	tx, err := NewMultiSigTransaction(redeemScript, bob.address, 30, 2, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if missing, err := tx.MissingSignatures(); err != nil || missing != 2 {
+		t.Fatalf("unsigned transaction misses %d signatures, %v", missing, err)
+	}
+
+	// the first and the last key sign copies of the transaction apart
+	first, last := copyTransaction(t, tx), copyTransaction(t, tx)
+	if added, err := first.SignPartial(signer.NewKeySigner(keys[0].PrivateKey)); err != nil || added != 1 {
+		t.Fatalf("first key added %d signatures, %v", added, err)
+	}
+	if added, err := last.SignPartial(signer.NewKeySigner(keys[2].PrivateKey, alice.PrivateKey)); err != nil || added != 1 {
+		t.Fatalf("last key added %d signatures, %v", added, err)
+	}
+	if added, err := first.SignPartial(signer.NewKeySigner(alice.PrivateKey)); err != nil || added != 0 {
+		t.Fatalf("a key outside the script added %d signatures, %v", added, err)
+	}
+
+	if _, err := chain.ValidateTransaction(first); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("transaction with one of two signatures was validated: %v", err)
+	}
+
+	combined, err := CombineTransactions([]*Transaction{first, last})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if missing, err := combined.MissingSignatures(); err != nil || missing != 0 {
+		t.Fatalf("combined transaction misses %d signatures, %v", missing, err)
+	}
+	if fee, err := chain.ValidateTransaction(combined); err != nil || fee != 2 {
+		t.Fatalf("combined transaction has fee %d, %v", fee, err)
+	}
+
+	mine(t, chain, miner.address, combined)
+	if got := balance(t, chain, bob.address); got != 30 {
+		t.Errorf("bob has %d, want 30", got)
+	}
+	if got := balance(t, chain, address); got != 50-30-2 {
+		t.Errorf("multisig address has %d, want %d", got, 50-30-2)
+	}
+	checkUTXOSet(t, chain)
+}
+
+func TestCombineOtherTransactions(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+	alice, miner := newTestWallet(t), newTestWallet(t)
+	keys := []testWallet{newTestWallet(t), newTestWallet(t)}
+
+	address, redeemScript, err := wallet.MultiSigAddress(1,
+		[][]byte{keys[0].PublicKey, keys[1].PublicKey}, &params.RegTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mine(t, chain, alice.address)
+	mine(t, chain, miner.address, send(t, chain, alice, address, 50, 1))
+
+	tx, err := NewMultiSigTransaction(redeemScript, alice.address, 10, 1, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewMultiSigTransaction(redeemScript, alice.address, 20, 1, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CombineTransactions([]*Transaction{tx, other}); err == nil {
+		t.Fatal("combined two different transactions")
+	}
+
+	plain := send(t, chain, alice, miner.address, 1, 0)
+	if _, err := plain.SignPartial(signer.NewKeySigner(keys[0].PrivateKey)); !errors.Is(err, ErrNotMultiSig) {
+		t.Fatalf("signing a pay to pubkey hash spend partially returned %v", err)
+	}
+}
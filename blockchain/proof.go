@@ -5,7 +5,6 @@ import (
 	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
-	"log"
 	"math"
 	"math/big"
 )
@@ -21,33 +20,88 @@ import (
 // Requirements:
 // The First few bytes must contain 0s
 
-// Difficulty variable
-const Difficulty = 12
-
 // ProofOfWork structure
 type ProofOfWork struct {
 	Block *Block
 	Target *big.Int
 }
 
-// NewProof function
+// NewProof function that uses the target the block claims in its Bits
 func NewProof(b *Block) *ProofOfWork {
-	target := big.NewInt(1)
-	target.Lsh(target, uint(256-Difficulty)) // Lsh <-> append
+	target := CompactToBig(b.Bits)
 
 	pow := &ProofOfWork{b, target}
 
 	return pow
 }
 
+// ExpectedProof method that returns the proof of work of a block against
+// the target the chain expects at the block's height
+func (bc *BlockChain) ExpectedProof(b *Block) (*ProofOfWork, error) {
+	bits := BigToCompact(bc.Params.GenesisTarget)
+
+	if len(b.PrevHash) != 0 {
+		prev, err := bc.GetBlock(b.PrevHash)
+		if err != nil {
+			return nil, err
+		}
+		if bits, err = bc.CalcNextBits(&prev); err != nil {
+			return nil, err
+		}
+	}
+
+	return &ProofOfWork{b, CompactToBig(bits)}, nil
+}
+
+// CalcNextBits method that returns the compact target of the block after prev,
+// the target is adjusted every RetargetInterval blocks of the network from the
+// time the last interval actually took compared to its TargetBlockTime
+func (bc *BlockChain) CalcNextBits(prev *Block) (uint32, error) {
+	p := bc.Params
+	if p.NoRetargeting || (prev.Height+1)%p.RetargetInterval != 0 {
+		return prev.Bits, nil
+	}
+
+	first := *prev
+	for i := 0; i < p.RetargetInterval-1; i++ {
+		block, err := bc.GetBlock(first.PrevHash)
+		if err != nil {
+			return 0, err
+		}
+		first = block
+	}
+
+	expected := int64(p.RetargetInterval-1) * p.TargetBlockTime
+	actual := prev.Timestamp - first.Timestamp
+	if actual < expected/p.MaxRetargetFactor {
+		actual = expected / p.MaxRetargetFactor
+	}
+	if actual > expected*p.MaxRetargetFactor {
+		actual = expected * p.MaxRetargetFactor
+	}
+
+	target := CompactToBig(prev.Bits)
+	target.Mul(target, big.NewInt(actual))
+	target.Div(target, big.NewInt(expected))
+
+	if target.Cmp(p.PowLimit) > 0 {
+		target.Set(p.PowLimit)
+	}
+
+	return BigToCompact(target), nil
+}
+
 // InitData method for ProofOfWork
 func (pow *ProofOfWork) InitData(nonce int) []byte {
 	data := bytes.Join(
 		[][]byte{
+			ToHex(int64(pow.Block.Version)),
 			pow.Block.PrevHash,
-			pow.Block.HashTransactions(),
+			pow.Block.MerkleRoot,
+			ToHex(pow.Block.Timestamp),
+			ToHex(int64(pow.Block.Height)),
 			ToHex(int64(nonce)),
-			ToHex(int64(Difficulty)),
+			ToHex(int64(pow.Block.Bits)),
 		},
 		[]byte{},
 	)
@@ -79,24 +133,93 @@ func (pow *ProofOfWork) Run() (int, []byte) {
 	return nonce, hash[:]
 }
 
-// Validate method for ProofOfWork
+// Validate method for ProofOfWork that checks the block claims the target
+// of the proof and that its hash meets it
 func (pow *ProofOfWork) Validate() bool {
 	var intHash big.Int
 
+	if pow.Target.Sign() <= 0 {
+		return false
+	}
+	if pow.Block.Bits != BigToCompact(pow.Target) {
+		return false
+	}
+
+	// the header commits to the transactions through the merkle root
+	if !bytes.Equal(pow.Block.MerkleRoot, pow.Block.HashTransactions()) {
+		return false
+	}
+
 	data := pow.InitData(pow.Block.Nonce)
 
 	hash := sha256.Sum256(data)
+	if !bytes.Equal(hash[:], pow.Block.Hash) {
+		return false
+	}
 	intHash.SetBytes(hash[:])
 
 	return intHash.Cmp(pow.Target) == -1
 }
 
-// ToHex function
+// ToHex function that returns the big endian bytes of num
 func ToHex(num int64) []byte {
-	buff := new(bytes.Buffer)
-	err := binary.Write(buff, binary.BigEndian, num)
-	if err != nil {
-		log.Panic(err)
+	buff := make([]byte, 8)
+	binary.BigEndian.PutUint64(buff, uint64(num))
+
+	return buff
+}
+
+// CompactToBig function to expand a compact target, the high byte is the
+// length of the number in bytes and the low three bytes are its most
+// significant bytes, as in the Bits field of a bitcoin header
+func CompactToBig(compact uint32) *big.Int {
+	mantissa := compact & 0x007fffff
+	isNegative := compact&0x00800000 != 0
+	exponent := uint(compact >> 24)
+
+	var bn *big.Int
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		bn = big.NewInt(int64(mantissa))
+	} else {
+		bn = big.NewInt(int64(mantissa))
+		bn.Lsh(bn, 8*(exponent-3))
 	}
-	return buff.Bytes()
+
+	if isNegative {
+		bn = bn.Neg(bn)
+	}
+
+	return bn
+}
+
+// BigToCompact function to pack a target into its compact form,
+// the precision beyond the three most significant bytes is dropped
+func BigToCompact(n *big.Int) uint32 {
+	if n.Sign() == 0 {
+		return 0
+	}
+
+	var mantissa uint32
+	abs := new(big.Int).Abs(n)
+	exponent := uint(len(abs.Bytes()))
+	if exponent <= 3 {
+		mantissa = uint32(abs.Uint64())
+		mantissa <<= 8 * (3 - exponent)
+	} else {
+		mantissa = uint32(abs.Rsh(abs, 8*(exponent-3)).Uint64())
+	}
+
+	// the sign bit is set, shift it out into the exponent
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+
+	compact := uint32(exponent<<24) | mantissa
+	if n.Sign() < 0 {
+		compact |= 0x00800000
+	}
+
+	return compact
 }
@@ -0,0 +1,173 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+	"testing"
+
+	badger "github.com/dgraph-io/badger/v2"
+	"github.com/shortdaddy0711/golang-blockchain/config"
+	"github.com/shortdaddy0711/golang-blockchain/params"
+)
+
+func hexBig(t *testing.T, s string) *big.Int {
+	t.Helper()
+
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatalf("bad number %s", s)
+	}
+
+	return n
+}
+
+func TestCompactToBig(t *testing.T) {
+	tests := []struct {
+		compact uint32
+		want    string
+	}{
+		{0x00000000, "0"},
+		{0x01003456, "0"},
+		{0x01123456, "12"},
+		{0x02008000, "80"},
+		{0x03123456, "123456"},
+		{0x04123456, "12345600"},
+		{0x05009234, "92340000"},
+		// the sign bit
+		{0x04923456, "-12345600"},
+		{0x01803456, "0"},
+		{0x1d00ffff, "ffff0000000000000000000000000000000000000000000000000000"},
+	}
+
+	for _, test := range tests {
+		if got := CompactToBig(test.compact); got.Cmp(hexBig(t, test.want)) != 0 {
+			t.Errorf("CompactToBig(%#08x) = %x, want %s", test.compact, got, test.want)
+		}
+	}
+}
+
+func TestBigToCompact(t *testing.T) {
+	tests := []struct {
+		n    string
+		want uint32
+	}{
+		{"0", 0x00000000},
+		{"12", 0x01120000},
+		{"80", 0x02008000},
+		{"1234", 0x02123400},
+		{"12345600", 0x04123456},
+		{"92340000", 0x05009234},
+		{"-12345600", 0x04923456},
+		// only the three most significant bytes are kept
+		{"123456789a", 0x05123456},
+		{"ffff0000000000000000000000000000000000000000000000000000", 0x1d00ffff},
+	}
+
+	for _, test := range tests {
+		if got := BigToCompact(hexBig(t, test.n)); got != test.want {
+			t.Errorf("BigToCompact(%s) = %#08x, want %#08x", test.n, got, test.want)
+		}
+	}
+}
+
+func TestCompactRoundTrip(t *testing.T) {
+	for _, compact := range []uint32{0x01120000, 0x02008000, 0x04123456, 0x04923456, 0x1d00ffff, 0x1f100000, 0x20008000} {
+		if got := BigToCompact(CompactToBig(compact)); got != compact {
+			t.Errorf("%#08x comes back as %#08x", compact, got)
+		}
+	}
+
+	for name, p := range params.Networks {
+		for _, target := range []*big.Int{p.PowLimit, p.GenesisTarget} {
+			if got := CompactToBig(BigToCompact(target)); got.Cmp(target) != 0 {
+				t.Errorf("%s target %x comes back as %x", name, target, got)
+			}
+		}
+	}
+}
+
+// storeBlocks stores blocks on top of the genesis block up to height without
+// checking them, the last one has the timestamp span seconds after the genesis
+// block and the bits given, the blocks before it keep the genesis target
+func storeBlocks(t *testing.T, chain *BlockChain, height int, span int64, bits uint32) *Block {
+	t.Helper()
+
+	genesis, err := chain.GetBlock(chain.LastHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev := &genesis
+	for h := 1; h <= height; h++ {
+		hash := sha256.Sum256([]byte(fmt.Sprintf("%d-%d-%d", h, span, bits)))
+		block := &Block{
+			Version:   BlockVersion,
+			Timestamp: genesis.Timestamp + int64(h)*span/int64(height),
+			PrevHash:  prev.Hash,
+			Hash:      hash[:],
+			Bits:      genesis.Bits,
+			Height:    h,
+		}
+		if h == height {
+			block.Bits = bits
+		}
+
+		err := chain.Database.Update(func(txn *badger.Txn) error {
+			return txn.Set(blockKey(block.Hash), block.Serialize())
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		prev = block
+	}
+
+	return prev
+}
+
+func TestCalcNextBits(t *testing.T) {
+	// a main network copy, its interval of 10 blocks is expected to take 90 seconds
+	p := params.MainNet
+	chain := newTestChain(t, &config.Config{DataDir: t.TempDir(), Params: &p})
+	genesisBits := BigToCompact(p.GenesisTarget)
+
+	tests := []struct {
+		name   string
+		height int
+		span   int64
+		bits   uint32
+		want   uint32
+	}{
+		{"between retargets", 5, 1, genesisBits, genesisBits},
+		{"on time", 9, 90, genesisBits, genesisBits},
+		{"twice as slow", 9, 180, genesisBits, 0x1f200000},
+		{"one and a half times as slow", 9, 135, genesisBits, 0x1f180000},
+		{"twice as fast", 9, 45, genesisBits, 0x1f080000},
+		{"far too slow is clamped", 9, 90 * 100, genesisBits, 0x1f400000},
+		// a quarter of 90 seconds rounds down to 22
+		{"far too fast is clamped", 9, 1, genesisBits, 0x1f03e93e},
+		{"capped at the pow limit", 9, 90 * 4, 0x20008000, BigToCompact(p.PowLimit)},
+	}
+
+	if genesisBits != 0x1f100000 {
+		t.Fatalf("main network genesis bits are %#08x", genesisBits)
+	}
+
+	for _, test := range tests {
+		prev := storeBlocks(t, chain, test.height, test.span, test.bits)
+		got, err := chain.CalcNextBits(prev)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got != test.want {
+			t.Errorf("%s: next bits are %#08x, want %#08x", test.name, got, test.want)
+		}
+	}
+
+	// without retargeting the bits stay those of the parent
+	p.NoRetargeting = true
+	prev := storeBlocks(t, chain, 9, 1, genesisBits)
+	if got, err := chain.CalcNextBits(prev); err != nil || got != genesisBits {
+		t.Errorf("next bits without retargeting are %#08x, %v", got, err)
+	}
+}
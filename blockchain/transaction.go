@@ -1,42 +1,54 @@
 package blockchain
 
 import (
-	"bytes"
 	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
-	"encoding/gob"
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
-	"math/big"
 	"strings"
 
+	"github.com/shortdaddy0711/golang-blockchain/params"
+	"github.com/shortdaddy0711/golang-blockchain/script"
+	"github.com/shortdaddy0711/golang-blockchain/signer"
 	"github.com/shortdaddy0711/golang-blockchain/wallet"
 )
 
-// Transaction structure
+var (
+	// ErrNotEnoughFunds error when the spendable outputs do not cover the amount
+	ErrNotEnoughFunds = errors.New("Not enough funds")
+	// ErrPrevTxMissing error when an input refers to a transaction that is not given
+	ErrPrevTxMissing = errors.New("Previous transaction does not exist")
+	// ErrNegativeFee error when a transaction is asked to pay a fee below zero
+	ErrNegativeFee = errors.New("Fee must not be negative")
+)
+
+// Transaction structure, LockTime is the height or unix time the transaction
+// is locked until, 0 for none
 type Transaction struct {
-	ID      []byte
-	Inputs  []TxInput
-	Outputs []TxOutput
+	ID       []byte
+	Inputs   []TxInput
+	Outputs  []TxOutput
+	LockTime uint32
 }
 
-// Serialize method for Transaction to serialize transaction
+// Serialize method for Transaction to serialize transaction, see
+// EncodingVersion for the format, the id is left out
 func (tx Transaction) Serialize() []byte {
-	var encoded bytes.Buffer
-
-	enc := gob.NewEncoder(&encoded)
-	err := enc.Encode(tx)
-	if err != nil {
-		log.Panic(err)
-	}
+	return encodeTransaction(&tx)
+}
 
-	return encoded.Bytes()
+// DeserializeTransaction function to decode a serialized transaction, the id
+// is computed from the transaction
+func DeserializeTransaction(data []byte) (Transaction, error) {
+	return decodeTransaction(data)
 }
 
-// Hash method for Transaction to hash the serialized transaction
+// Hash method for Transaction to hash the serialized transaction, the
+// unlocking scripts are part of it so the merkle root and the proof of work
+// of a block commit to the signatures too. Signing changes the id
 func (tx *Transaction) Hash() []byte {
 	var hash [32]byte
 
@@ -48,7 +60,6 @@ func (tx *Transaction) Hash() []byte {
 	return hash[:]
 }
 
-
 // // SetID method to make ID for each transaction
 // func (tx *Transaction) SetID() {
 // 	var encoded bytes.Buffer
@@ -62,61 +73,135 @@ func (tx *Transaction) Hash() []byte {
 // 	tx.ID = hash[:]
 // }
 
-// CoinbaseTx function to make base transaction
-func CoinbaseTx(to, data string) *Transaction {
+// CoinbaseTx function to make base transaction of the block at height,
+// it pays the block subsidy of the network and the fees of the block
+func CoinbaseTx(to, data string, height, fees int, p *params.ChainParams) (*Transaction, error) {
 	if data == "" {
 		randData := make([]byte, 20)
-		_, err := rand.Read(randData)
-		Handle(err)
+		if _, err := rand.Read(randData); err != nil {
+			return nil, err
+		}
 
 		data = fmt.Sprintf("%x", randData)
 	}
 
-	txin := TxInput{[]byte{}, -1, nil, []byte(data)}
-	txout := NewTXOutput(100, to)
+	txin := TxInput{[]byte{}, -1, coinbaseScript(height, []byte(data)), MaxSequence}
+	txout, err := NewTXOutput(p.BlockSubsidy(height)+fees, to, p)
+	if err != nil {
+		return nil, err
+	}
 
-	tx := Transaction{nil, []TxInput{txin}, []TxOutput{*txout}}
+	tx := Transaction{nil, []TxInput{txin}, []TxOutput{*txout}, 0}
 	tx.ID = tx.Hash()
 
-	return &tx
+	return &tx, nil
+}
+
+// coinbaseScript returns the unlocking script of the coinbase of the block at
+// height, the height comes first as 8 little endian bytes so coinbases of
+// different blocks never have the same id
+func coinbaseScript(height int, data []byte) []byte {
+	script := make([]byte, 8, 8+len(data))
+	binary.LittleEndian.PutUint64(script, uint64(height))
+
+	return append(script, data...)
+}
+
+// CoinbaseHeight method that returns the block height a coinbase was made for
+func (tx *Transaction) CoinbaseHeight() (int, bool) {
+	if !tx.IsCoinbase() || len(tx.Inputs[0].ScriptSig) < 8 {
+		return 0, false
+	}
+
+	return int(int64(binary.LittleEndian.Uint64(tx.Inputs[0].ScriptSig))), true
+}
+
+// NewTransaction function to generate new trasaction spending the outputs of pubKey,
+// the signer must hold its key.
+// The inputs pay fee more than the outputs to the miner, a lockTime other than 0
+// keeps the transaction out of the chain until it passes
+func NewTransaction(s signer.Signer, pubKey []byte, to string, amount, fee int, lockTime uint32, UTXO *UTXOSet) (*Transaction, error) {
+	pubKeyHash := wallet.PublicKeyHash(pubKey)
+	from := string(wallet.PubKeyHashAddress(pubKeyHash, UTXO.Blockchain.Params))
+	tx, err := newSpend(script.PayToPubKeyHash(pubKeyHash), from, to, amount, fee, lockTime, UTXO)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := UTXO.Blockchain.SignTransaction(tx, s, pubKey); err != nil {
+		return nil, err
+	}
+
+	return tx, nil
 }
 
-// NewTransaction function to generate new trasaction
-func NewTransaction(from, to string, amount int, UTXO *UTXOSet) *Transaction {
+// newSpend builds an unsigned transaction paying amount to the address to and
+// fee to the miner out of the outputs locked with pkScript, the change goes back to from
+func newSpend(pkScript []byte, from, to string, amount, fee int, lockTime uint32, UTXO *UTXOSet) (*Transaction, error) {
 	var inputs []TxInput
 	var outputs []TxOutput
 
-	wallets, err := wallet.CreateWallets()
-	Handle(err)
-	w := wallets.GetWallet(from)
-	pubKeyHash := wallet.PublicKeyHash(w.PublicKey)
-	acc, validOutputs := UTXO.FindSpendableOutputs(pubKeyHash, amount)
+	if fee < 0 {
+		return nil, fmt.Errorf("%w: %d", ErrNegativeFee, fee)
+	}
+
+	// final inputs would switch the lock time off
+	sequence := MaxSequence
+	if lockTime != 0 {
+		sequence = MaxSequence - 1
+	}
+
+	acc, validOutputs, err := UTXO.FindSpendableOutputs(pkScript, amount+fee)
+	if err != nil {
+		return nil, err
+	}
 
-	if acc < amount {
-		log.Panic("Error: not enough funds")
+	if acc < amount+fee {
+		return nil, fmt.Errorf("%w: have %d, need %d", ErrNotEnoughFunds, acc, amount+fee)
 	}
 
 	for txid, outs := range validOutputs {
 		txID, err := hex.DecodeString(txid)
-		Handle(err)
+		if err != nil {
+			return nil, err
+		}
 
 		for _, out := range outs {
-			input := TxInput{txID, out, nil, w.PublicKey}
+			input := TxInput{txID, out, nil, sequence}
 			inputs = append(inputs, input)
 		}
 	}
 
-	outputs = append(outputs, *NewTXOutput(amount, to))
+	p := UTXO.Blockchain.Params
+	output, err := NewTXOutput(amount, to, p)
+	if err != nil {
+		return nil, err
+	}
+	outputs = append(outputs, *output)
 
-	if acc > amount {
-		outputs = append(outputs, *NewTXOutput(acc-amount, from))
+	if acc > amount+fee {
+		change, err := NewTXOutput(acc-amount-fee, from, p)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, *change)
 	}
 
-	tx := Transaction{nil, inputs, outputs}
+	tx := Transaction{nil, inputs, outputs, lockTime}
 	tx.ID = tx.Hash()
-	UTXO.Blockchain.SignTransaction(&tx, w.PrivateKey)
 
-	return &tx
+	return &tx, nil
+}
+
+// OutputValue method that returns the sum of the transaction outputs
+func (tx *Transaction) OutputValue() int {
+	total := 0
+
+	for _, out := range tx.Outputs {
+		total += out.Value
+	}
+
+	return total
 }
 
 // IsCoinbase method for transaction struture
@@ -124,89 +209,112 @@ func (tx *Transaction) IsCoinbase() bool {
 	return len(tx.Inputs) == 1 && len(tx.Inputs[0].ID) == 0 && tx.Inputs[0].Out == -1
 }
 
-// Sign method for transaction to give signature to input
-func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transaction) {
+// Sign method for transaction to give every input the unlocking script of
+// the pay to pubkey hash output of pubKey it spends, s signs with its key
+func (tx *Transaction) Sign(s signer.Signer, pubKey []byte, prevTXs map[string]Transaction) error {
 	if tx.IsCoinbase() {
-		return
+		return nil
 	}
 
+	pkScript := script.PayToPubKeyHash(wallet.PublicKeyHash(pubKey))
+
 	for _, in := range tx.Inputs {
-		if prevTXs[hex.EncodeToString(in.ID)].ID == nil {
-			log.Panic("ERROR: Previous transaction is not correct")
+		prevTX := prevTXs[hex.EncodeToString(in.ID)]
+		if prevTX.ID == nil {
+			return fmt.Errorf("%w: %x", ErrPrevTxMissing, in.ID)
+		}
+		if in.Out < 0 || in.Out >= len(prevTX.Outputs) {
+			return fmt.Errorf("Output %d of transaction %x does not exist", in.Out, in.ID)
+		}
+		if !prevTX.Outputs[in.Out].IsLockedWith(pkScript) {
+			return fmt.Errorf("Output %d of transaction %x is not locked with the key", in.Out, in.ID)
 		}
 	}
 
-	txCopy := tx.TrimmedCopy()
-
-	for inID, in := range txCopy.Inputs {
+	for inID, in := range tx.Inputs {
 		prevTX := prevTXs[hex.EncodeToString(in.ID)]
-		txCopy.Inputs[inID].Signature = nil
-		txCopy.Inputs[inID].PubKey = prevTX.Outputs[in.Out].PubKeyHash
-		txCopy.ID = txCopy.Hash()
-		txCopy.Inputs[inID].PubKey = nil
+		hash := tx.sigHash(inID, prevTX.Outputs[in.Out].ScriptPubKey)
 
-		r, s, err := ecdsa.Sign(rand.Reader, &privKey, txCopy.ID)
-		Handle(err)
-		signature := append(r.Bytes(), s.Bytes()...)
+		sig, err := s.Sign(pubKey, hash)
+		if err != nil {
+			return err
+		}
 
-		tx.Inputs[inID].Signature = signature
+		tx.Inputs[inID].ScriptSig = script.SignatureScript(sig, pubKey)
 	}
+	tx.ID = tx.Hash()
+
+	return nil
 }
 
-// TrimmedCopy method to prepare a copy of transaction
+// TrimmedCopy method to prepare a copy of transaction without unlocking scripts
 func (tx *Transaction) TrimmedCopy() Transaction {
 	var inputs []TxInput
 	var outputs []TxOutput
 
 	for _, in := range tx.Inputs {
-		inputs = append(inputs, TxInput{in.ID, in.Out, nil, nil})
+		inputs = append(inputs, TxInput{in.ID, in.Out, nil, in.Sequence})
 	}
 
 	for _, out := range tx.Outputs {
-		outputs = append(outputs, TxOutput{out.Value, out.PubKeyHash})
+		outputs = append(outputs, TxOutput{out.Value, out.ScriptPubKey})
 	}
 
-	txCopy := Transaction{tx.ID, inputs, outputs}
+	txCopy := Transaction{tx.ID, inputs, outputs, tx.LockTime}
 
 	return txCopy
 }
 
-// Verify method for Transaction structure to compare public key with previous public key
+// sigHash method that returns the hash a signature of the input at inID signs,
+// the input carries subScript in place of its unlocking script
+func (tx *Transaction) sigHash(inID int, subScript []byte) []byte {
+	txCopy := tx.TrimmedCopy()
+	txCopy.ID = []byte{}
+	txCopy.Inputs[inID].ScriptSig = subScript
+
+	hash := sha256.Sum256(txCopy.Serialize())
+
+	return hash[:]
+}
+
+// txChecker structure that checks signatures of one input for the script engine
+type txChecker struct {
+	tx   *Transaction
+	inID int
+}
+
+// CheckSig method to verify a canonical ECDSA signature over a compressed public key
+func (c txChecker) CheckSig(sig, pubKey, subScript []byte) bool {
+	r, s, err := script.ParseSignature(sig)
+	if err != nil {
+		return false
+	}
+	rawPubKey, err := script.ParsePubKey(pubKey)
+	if err != nil {
+		return false
+	}
+
+	return ecdsa.Verify(rawPubKey, c.tx.sigHash(c.inID, subScript), r, s)
+}
+
+// Verify method for Transaction structure to run the unlocking script of every
+// input against the locking script of the output it spends
 func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
 	if tx.IsCoinbase() {
 		return true
 	}
 
-	for _, in := range tx.Inputs {
-		if prevTXs[hex.EncodeToString(in.ID)].ID == nil {
-			log.Panic("Previous transaction does not exist")
-		}
-	}
-
-	txCopy := tx.TrimmedCopy()
-	curve := elliptic.P256()
-
 	for inID, in := range tx.Inputs {
 		prevTX := prevTXs[hex.EncodeToString(in.ID)]
-		txCopy.Inputs[inID].Signature = nil
-		txCopy.Inputs[inID].PubKey = prevTX.Outputs[in.Out].PubKeyHash
-		txCopy.ID = txCopy.Hash()
-		txCopy.Inputs[inID].PubKey = nil
-
-		r := big.Int{}
-		s := big.Int{}
-		sigLen := len(in.Signature)
-		r.SetBytes(in.Signature[:(sigLen / 2)])
-		s.SetBytes(in.Signature[(sigLen / 2):])
-
-		x := big.Int{}
-		y := big.Int{}
-		keyLen := len(in.PubKey)
-		x.SetBytes(in.PubKey[:(keyLen / 2)])
-		y.SetBytes(in.PubKey[(keyLen / 2):])
-
-		rawPubKey := ecdsa.PublicKey{Curve: curve, X: &x, Y: &y}
-		if ecdsa.Verify(&rawPubKey, txCopy.ID, &r, &s) == false {
+		if prevTX.ID == nil {
+			return false
+		}
+		if in.Out < 0 || in.Out >= len(prevTX.Outputs) {
+			return false
+		}
+
+		checker := txChecker{tx, inID}
+		if err := script.Execute(in.ScriptSig, prevTX.Outputs[in.Out].ScriptPubKey, checker); err != nil {
 			return false
 		}
 	}
@@ -219,18 +327,27 @@ func (tx Transaction) String() string {
 	var lines []string
 
 	lines = append(lines, fmt.Sprintf("--- Transaction %x:", tx.ID))
+	if tx.LockTime != 0 {
+		lines = append(lines, fmt.Sprintf("     LockTime: %d", tx.LockTime))
+	}
 	for i, input := range tx.Inputs {
 		lines = append(lines, fmt.Sprintf("     Input %d:", i))
 		lines = append(lines, fmt.Sprintf("       TXID:     %x", input.ID))
 		lines = append(lines, fmt.Sprintf("       Out:       %d", input.Out))
-		lines = append(lines, fmt.Sprintf("       Signature: %x", input.Signature))
-		lines = append(lines, fmt.Sprintf("       PubKey:    %x", input.PubKey))
+		if input.Sequence != MaxSequence {
+			lines = append(lines, fmt.Sprintf("       Sequence:  %#x", input.Sequence))
+		}
+		if tx.IsCoinbase() {
+			lines = append(lines, fmt.Sprintf("       Coinbase:  %x", input.ScriptSig))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("       ScriptSig: %s", script.Disassemble(input.ScriptSig)))
 	}
 
 	for i, output := range tx.Outputs {
 		lines = append(lines, fmt.Sprintf("     Output %d:", i))
 		lines = append(lines, fmt.Sprintf("       Value:  %d", output.Value))
-		lines = append(lines, fmt.Sprintf("       Script: %x", output.PubKeyHash))
+		lines = append(lines, fmt.Sprintf("       Script: %s", script.Disassemble(output.ScriptPubKey)))
 	}
 
 	return strings.Join(lines, "\n")
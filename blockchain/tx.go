@@ -2,71 +2,70 @@ package blockchain
 
 import (
 	"bytes"
-	"encoding/gob"
 
+	"github.com/shortdaddy0711/golang-blockchain/params"
 	"github.com/shortdaddy0711/golang-blockchain/wallet"
 )
 
-// TxOutput transaction output structure
+// TxOutput transaction output structure, ScriptPubKey is the locking script
+// that the input spending the output has to satisfy
 type TxOutput struct {
-	Value      int
-	PubKeyHash []byte
+	Value        int
+	ScriptPubKey []byte
 }
 
-// TxOutputs structure
+// TxOutputs structure that keeps the unspent outputs of a transaction
+// by their index in the original transaction, with the height of the block
+// the transaction is in and the median time past of its parent for relative timelocks
 type TxOutputs struct {
-	Outputs []TxOutput
+	Outputs map[int]TxOutput
+	Height  int
+	Time    int64
 }
 
-// TxInput transaction input structure
+// TxInput transaction input structure, ScriptSig is the unlocking script that
+// runs before the locking script of the spent output, a coinbase keeps its data there.
+// Sequence is MaxSequence for a final input, or the relative timelock of the input
 type TxInput struct {
 	ID        []byte
 	Out       int
-	Signature []byte
-	PubKey    []byte
+	ScriptSig []byte
+	Sequence  uint32
 }
 
 // NewTXOutput function to give value to TxOutput structure
-func NewTXOutput(value int, address string) *TxOutput {
+func NewTXOutput(value int, address string, p *params.ChainParams) (*TxOutput, error) {
 	txo := &TxOutput{value, nil}
-	txo.Lock([]byte(address))
+	if err := txo.Lock([]byte(address), p); err != nil {
+		return nil, err
+	}
 
-	return txo
+	return txo, nil
 }
 
-// Serialize method for TxOutputs
+// Serialize method for TxOutputs, see EncodingVersion for the format
 func (outs TxOutputs) Serialize() []byte {
-	var buffer bytes.Buffer
-	encode := gob.NewEncoder(&buffer)
-	err := encode.Encode(outs)
-	Handle(err)
-	return buffer.Bytes()
+	return encodeOutputs(outs)
 }
 
 // DeserializeOutputs function to deserialize the serialized output
-func DeserializeOutputs(data []byte) TxOutputs {
-	var outputs TxOutputs
-	decode := gob.NewDecoder(bytes.NewReader(data))
-	err := decode.Decode(&outputs)
-	Handle(err)
-	return outputs
+func DeserializeOutputs(data []byte) (TxOutputs, error) {
+	return decodeOutputs(data)
 }
 
-// UsesKey method for TxInput structure
-func (in *TxInput) UsesKey(pubKeyHash []byte) bool {
-	lockingHash := wallet.PublicKeyHash(in.PubKey)
+// Lock method for TxOutput structure to pay to the address with the locking
+// script of its kind, the address must be on the network of p
+func (out *TxOutput) Lock(address []byte, p *params.ChainParams) error {
+	pkScript, err := wallet.AddressScript(string(address), p)
+	if err != nil {
+		return err
+	}
+	out.ScriptPubKey = pkScript
 
-	return bytes.Compare(lockingHash, pubKeyHash) == 0
+	return nil
 }
 
-// Lock method for TxOutput structure
-func (out *TxOutput) Lock(address []byte) {
-	pubKeyHash := wallet.Base58Decode(address)
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash) - 4]
-	out.PubKeyHash = pubKeyHash
-}
-
-// IsLockedWithKey method
-func (out *TxOutput) IsLockedWithKey(pubKeyHash []byte) bool {
-	return bytes.Compare(out.PubKeyHash, pubKeyHash) == 0
+// IsLockedWith method that tells whether the output is locked with pkScript
+func (out *TxOutput) IsLockedWith(pkScript []byte) bool {
+	return bytes.Equal(out.ScriptPubKey, pkScript)
 }
\ No newline at end of file
@@ -0,0 +1,191 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+
+	badger "github.com/dgraph-io/badger/v2"
+)
+
+var (
+	txIndexPrefix = []byte("tx-")
+	// txIndexKey marks that the transaction index is built and kept up to date
+	txIndexKey = []byte("txindex")
+)
+
+// TxLocation structure that tells where a transaction of the main chain is
+// stored, the hash of its block and its position in the block
+type TxLocation struct {
+	BlockHash []byte
+	Position  int
+}
+
+func txIndexKeyOf(txID []byte) []byte {
+	return append(append([]byte{}, txIndexPrefix...), txID...)
+}
+
+// Serialize method for TxLocation, see EncodingVersion for the format
+func (loc TxLocation) Serialize() []byte {
+	return encodeTxLocation(loc)
+}
+
+// DeserializeTxLocation function to decode an entry of the transaction index
+func DeserializeTxLocation(data []byte) (TxLocation, error) {
+	return decodeTxLocation(data)
+}
+
+// indexBlock adds the transactions of a block joining the main chain to the
+// index, a transaction id seen again points to the newest block as the walk
+// from the tip would find it
+func indexBlock(txn *badger.Txn, block *Block) error {
+	for i, tx := range block.Transactions {
+		loc := TxLocation{block.Hash, i}
+		if err := txn.Set(txIndexKeyOf(tx.ID), loc.Serialize()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unindexBlock removes the transactions of a block leaving the main chain
+func unindexBlock(txn *badger.Txn, block *Block) error {
+	for _, tx := range block.Transactions {
+		loc, found, err := getTxLocation(txn, tx.ID)
+		if err != nil {
+			return err
+		}
+		if !found || !bytes.Equal(loc.BlockHash, block.Hash) {
+			continue
+		}
+		if err := txn.Delete(txIndexKeyOf(tx.ID)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func getTxLocation(txn *badger.Txn, txID []byte) (TxLocation, bool, error) {
+	item, err := txn.Get(txIndexKeyOf(txID))
+	if err == badger.ErrKeyNotFound {
+		return TxLocation{}, false, nil
+	}
+	if err != nil {
+		return TxLocation{}, false, err
+	}
+	v, err := item.ValueCopy(nil)
+	if err != nil {
+		return TxLocation{}, false, err
+	}
+	loc, err := DeserializeTxLocation(v)
+
+	return loc, err == nil, err
+}
+
+// FindTxLocation method that looks a transaction of the main chain up in the
+// index, it reports false when the index does not have it
+func (bc *BlockChain) FindTxLocation(txID []byte) (TxLocation, bool, error) {
+	var loc TxLocation
+	var found bool
+
+	err := bc.Database.View(func(txn *badger.Txn) error {
+		var err error
+		loc, found, err = getTxLocation(txn, txID)
+		return err
+	})
+
+	return loc, found, err
+}
+
+// findIndexedTransaction reads a transaction from the block the index points to
+func (bc *BlockChain) findIndexedTransaction(ID []byte) (Transaction, error) {
+	loc, found, err := bc.FindTxLocation(ID)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if !found {
+		return Transaction{}, fmt.Errorf("%w: %x", ErrTxNotFound, ID)
+	}
+
+	block, err := bc.GetBlock(loc.BlockHash)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if loc.Position >= len(block.Transactions) || !bytes.Equal(block.Transactions[loc.Position].ID, ID) {
+		return Transaction{}, fmt.Errorf("Transaction index is out of date for %x, run reindextx", ID)
+	}
+
+	return *block.Transactions[loc.Position], nil
+}
+
+// ReindexTransactions method to build the transaction index from the main
+// chain and keep it up to date from now on, it returns how many transactions
+// were indexed
+func (bc *BlockChain) ReindexTransactions() (int, error) {
+	if err := bc.DropTxIndex(); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	iterator := bc.Iterator()
+	for {
+		block, err := iterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		// the walk goes from the tip down, a transaction id already indexed
+		// belongs to a newer block and keeps pointing there
+		err = bc.Database.Update(func(txn *badger.Txn) error {
+			for i, tx := range block.Transactions {
+				_, found, err := getTxLocation(txn, tx.ID)
+				if err != nil {
+					return err
+				}
+				if found {
+					continue
+				}
+				loc := TxLocation{block.Hash, i}
+				if err := txn.Set(txIndexKeyOf(tx.ID), loc.Serialize()); err != nil {
+					return err
+				}
+				count++
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	err := bc.Database.Update(func(txn *badger.Txn) error {
+		return txn.Set(txIndexKey, []byte{1})
+	})
+	if err != nil {
+		return 0, err
+	}
+	bc.TxIndex = true
+
+	return count, nil
+}
+
+// DropTxIndex method to delete the transaction index and stop keeping it,
+// lookups walk the chain again
+func (bc *BlockChain) DropTxIndex() error {
+	err := bc.Database.Update(func(txn *badger.Txn) error {
+		return txn.Delete(txIndexKey)
+	})
+	if err != nil {
+		return err
+	}
+	bc.TxIndex = false
+
+	UTXOSet := UTXOSet{bc}
+
+	return UTXOSet.DeleteByPrefix(txIndexPrefix)
+}
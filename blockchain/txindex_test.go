@@ -0,0 +1,91 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	badger "github.com/dgraph-io/badger/v2"
+)
+
+func TestTxIndex(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+	alice, bob, miner := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+
+	mine(t, chain, alice.address)
+	spend := send(t, chain, alice, bob.address, 10, 1)
+	block := mine(t, chain, miner.address, spend)
+
+	// the genesis block and two blocks, the last with a spend
+	count, err := chain.ReindexTransactions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 || !chain.TxIndex {
+		t.Fatalf("indexed %d transactions, want 4", count)
+	}
+
+	loc, found, err := chain.FindTxLocation(spend.ID)
+	if err != nil || !found {
+		t.Fatalf("spend is not indexed: %v", err)
+	}
+	if !bytes.Equal(loc.BlockHash, block.Hash) || loc.Position != 1 {
+		t.Fatalf("spend is indexed at %x/%d, want %x/1", loc.BlockHash, loc.Position, block.Hash)
+	}
+	if tx, err := chain.FindTransaction(spend.ID); err != nil || !bytes.Equal(tx.ID, spend.ID) {
+		t.Fatalf("FindTransaction through the index returned %x, %v", tx.ID, err)
+	}
+
+	// blocks connected from now on are indexed as they come
+	later := send(t, chain, bob, alice.address, 5, 1)
+	laterBlock := mine(t, chain, miner.address, later)
+	if loc, found, err := chain.FindTxLocation(later.ID); err != nil || !found || !bytes.Equal(loc.BlockHash, laterBlock.Hash) {
+		t.Fatalf("transaction of a new block is not indexed: %v", err)
+	}
+
+	// and the ones taken off the main chain leave the index
+	if _, err := chain.DisconnectTip(); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, err := chain.FindTxLocation(later.ID); err != nil || found {
+		t.Fatalf("transaction of a disconnected block is still indexed: %v", err)
+	}
+	if _, err := chain.FindTransaction(later.ID); !errors.Is(err, ErrTxNotFound) {
+		t.Fatalf("FindTransaction of a disconnected transaction returned %v", err)
+	}
+
+	if err := chain.DropTxIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, err := chain.FindTxLocation(spend.ID); err != nil || found || chain.TxIndex {
+		t.Fatalf("index is kept after it was dropped: %v", err)
+	}
+	// without the index the chain is walked
+	if tx, err := chain.FindTransaction(spend.ID); err != nil || !bytes.Equal(tx.ID, spend.ID) {
+		t.Fatalf("FindTransaction without the index returned %x, %v", tx.ID, err)
+	}
+}
+
+func TestDropTxIndexKeepsBlocks(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+
+	// a block hash that starts like a transaction index key
+	hash := append([]byte("tx-"), bytes.Repeat([]byte{5}, 29)...)
+	genesis := Genesis(chain.Params)
+	err := chain.Database.Update(func(txn *badger.Txn) error {
+		return txn.Set(blockKey(hash), genesis.Serialize())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := chain.ReindexTransactions(); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.DropTxIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := chain.HasBlock(hash); err != nil || !stored {
+		t.Fatalf("dropping the index deleted the block %x: %v", hash, err)
+	}
+}
@@ -0,0 +1,37 @@
+package blockchain
+
+import "errors"
+
+var undoPrefix = []byte("undo-")
+
+// ErrNoUndoData error when the undo data of a block is missing
+var ErrNoUndoData = errors.New("Block has no undo data")
+
+// SpentOutput structure for an output a block spent, with where it came from
+// and the height and time of the block that created it, as in TxOutputs
+type SpentOutput struct {
+	TxID   []byte
+	Index  int
+	Output TxOutput
+	Height int
+	Time   int64
+}
+
+// BlockUndo structure that keeps what is needed to take a block off the UTXO set
+type BlockUndo struct {
+	Spent []SpentOutput
+}
+
+func undoKey(blockHash []byte) []byte {
+	return append(append([]byte{}, undoPrefix...), blockHash...)
+}
+
+// Serialize method for BlockUndo, see EncodingVersion for the format
+func (undo BlockUndo) Serialize() []byte {
+	return encodeUndo(undo)
+}
+
+// DeserializeUndo function to decode the undo data of a block
+func DeserializeUndo(data []byte) (BlockUndo, error) {
+	return decodeUndo(data)
+}
@@ -0,0 +1,122 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	badger "github.com/dgraph-io/badger/v2"
+)
+
+func TestDisconnectTipRestoresUTXOSet(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+	alice, bob, miner := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+
+	var snapshots []map[string]string
+	var blocks []*Block
+	step := func(block func() *Block) {
+		snapshots = append(snapshots, utxoSnapshot(t, chain))
+		blocks = append(blocks, block())
+	}
+
+	step(func() *Block { return mine(t, chain, alice.address) })
+	step(func() *Block { return mine(t, chain, miner.address, send(t, chain, alice, bob.address, 40, 1)) })
+	// bob spends one output of a transaction whose change stays unspent
+	step(func() *Block { return mine(t, chain, miner.address, send(t, chain, bob, alice.address, 10, 2)) })
+	tipSnapshot := utxoSnapshot(t, chain)
+
+	for i := len(blocks) - 1; i >= 0; i-- {
+		block, err := chain.DisconnectTip()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(block.Hash, blocks[i].Hash) {
+			t.Fatalf("disconnected %x, want %x", block.Hash, blocks[i].Hash)
+		}
+		if !bytes.Equal(chain.LastHash, block.PrevHash) {
+			t.Fatalf("tip is %x after disconnecting %x", chain.LastHash, block.Hash)
+		}
+		if got := utxoSnapshot(t, chain); !reflect.DeepEqual(got, snapshots[i]) {
+			t.Fatalf("UTXO set after disconnecting height %d differs from before it was connected", block.Height)
+		}
+	}
+
+	if _, err := chain.DisconnectTip(); err == nil {
+		t.Fatal("disconnected the genesis block")
+	}
+
+	// the disconnected blocks stay stored and come back with the old UTXO set
+	update, err := chain.ImportBlock(blocks[len(blocks)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(update.Connected) != len(blocks) {
+		t.Fatalf("reconnected %d blocks, want %d", len(update.Connected), len(blocks))
+	}
+	if got := utxoSnapshot(t, chain); !reflect.DeepEqual(got, tipSnapshot) {
+		t.Fatal("UTXO set after reconnecting differs from the one before the rollback")
+	}
+	checkUTXOSet(t, chain)
+}
+
+func TestRevertWithoutUndoData(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+	miner := newTestWallet(t)
+
+	block := newBlock(t, chain, miner.address)
+	err := chain.Database.Update(func(txn *badger.Txn) error {
+		return (&UTXOSet{chain}).Revert(txn, block)
+	})
+	if !errors.Is(err, ErrNoUndoData) {
+		t.Fatalf("reverting a block that was never connected returned %v", err)
+	}
+}
+
+func TestFailedDisconnectChangesNothing(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+	miner := newTestWallet(t)
+
+	mine(t, chain, miner.address)
+	if _, err := chain.ReindexTransactions(); err != nil {
+		t.Fatal(err)
+	}
+	block := mine(t, chain, miner.address)
+	before := utxoSnapshot(t, chain)
+
+	// the UTXO set is rolled back before the broken index entry is read
+	err := chain.Database.Update(func(txn *badger.Txn) error {
+		return txn.Set(txIndexKeyOf(block.Transactions[0].ID), []byte{0xff})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.DisconnectTip(); !errors.Is(err, ErrUnknownEncoding) {
+		t.Fatalf("disconnecting with a broken index entry returned %v", err)
+	}
+
+	if !bytes.Equal(chain.LastHash, block.Hash) {
+		t.Fatal("the tip moved although the disconnect failed")
+	}
+	if hash, err := chain.GetBlockHash(block.Height); err != nil || !bytes.Equal(hash, block.Hash) {
+		t.Fatalf("height %d is indexed to %x, %v", block.Height, hash, err)
+	}
+	if got := utxoSnapshot(t, chain); !reflect.DeepEqual(got, before) {
+		t.Fatal("the UTXO set was rolled back although the disconnect failed")
+	}
+	err = chain.Database.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("lh"))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(lastHash []byte) error {
+			if !bytes.Equal(lastHash, block.Hash) {
+				t.Errorf("stored tip is %x, want %x", lastHash, block.Hash)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -3,7 +3,6 @@ package blockchain
 import (
 	"bytes"
 	"encoding/hex"
-	"log"
 
 	badger "github.com/dgraph-io/badger/v2"
 )
@@ -18,8 +17,9 @@ type UTXOSet struct {
 	Blockchain *BlockChain
 }
 
-// FindSpendableOutputs method for UTXOSet structure
-func (u UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int) {
+// FindSpendableOutputs method for UTXOSet structure, it collects outputs locked
+// with pkScript until they cover amount
+func (u UTXOSet) FindSpendableOutputs(pkScript []byte, amount int) (int, map[string][]int, error) {
 	unspentOuts := make(map[string][]int)
 	accumulated := 0
 	db := u.Blockchain.Database
@@ -34,13 +34,18 @@ func (u UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[s
 			item := it.Item()
 			k := item.Key()
 			v, err := item.ValueCopy(nil)
-			Handle(err)
+			if err != nil {
+				return err
+			}
 			k = bytes.TrimPrefix(k, utxoPrefix)
 			txID := hex.EncodeToString(k)
-			outs := DeserializeOutputs(v)
+			outs, err := DeserializeOutputs(v)
+			if err != nil {
+				return err
+			}
 
 			for outIdx, out := range outs.Outputs {
-				if out.IsLockedWithKey(pubKeyHash) && accumulated < amount {
+				if out.IsLockedWith(pkScript) && accumulated < amount {
 					accumulated += out.Value
 					unspentOuts[txID] = append(unspentOuts[txID], outIdx)
 				}
@@ -48,12 +53,12 @@ func (u UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[s
 		}
 		return nil
 	})
-	Handle(err)
-	return accumulated, unspentOuts
+
+	return accumulated, unspentOuts, err
 }
 
-// FindUTXO method for UTXOSet structure
-func (u UTXOSet) FindUTXO(pubKeyHash []byte) []TxOutput {
+// FindUTXO method for UTXOSet structure that returns the outputs locked with pkScript
+func (u UTXOSet) FindUTXO(pkScript []byte) ([]TxOutput, error) {
 	var UTXOs []TxOutput
 
 	db := u.Blockchain.Database
@@ -67,11 +72,16 @@ func (u UTXOSet) FindUTXO(pubKeyHash []byte) []TxOutput {
 		for it.Seek(utxoPrefix); it.ValidForPrefix(utxoPrefix); it.Next() {
 			item := it.Item()
 			v, err := item.ValueCopy(nil)
-			Handle(err)
-			outs := DeserializeOutputs(v)
+			if err != nil {
+				return err
+			}
+			outs, err := DeserializeOutputs(v)
+			if err != nil {
+				return err
+			}
 
 			for _, out := range outs.Outputs {
-				if out.IsLockedWithKey(pubKeyHash) {
+				if out.IsLockedWith(pkScript) {
 					UTXOs = append(UTXOs, out)
 				}
 			}
@@ -79,13 +89,89 @@ func (u UTXOSet) FindUTXO(pubKeyHash []byte) []TxOutput {
 
 		return nil
 	})
-	Handle(err)
 
-	return UTXOs
+	return UTXOs, err
+}
+
+// FindOutput method to look up a single unspent output by transaction id and index
+func (u UTXOSet) FindOutput(txID []byte, outIdx int) (TxOutput, bool, error) {
+	outs, found, err := u.FindOutputs(txID)
+	if err != nil || !found {
+		return TxOutput{}, false, err
+	}
+	output, found := outs.Outputs[outIdx]
+
+	return output, found, nil
+}
+
+// FindOutputs method to look up the unspent outputs of a transaction
+func (u UTXOSet) FindOutputs(txID []byte) (TxOutputs, bool, error) {
+	var outs TxOutputs
+	found := false
+
+	db := u.Blockchain.Database
+
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(append(append([]byte{}, utxoPrefix...), txID...))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		v, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		outs, err = DeserializeOutputs(v)
+		if err != nil {
+			return err
+		}
+		found = true
+
+		return nil
+	})
+
+	return outs, found, err
+}
+
+// TotalValue method that returns the sum of every unspent output, the
+// money supply of the chain
+func (u UTXOSet) TotalValue() (int, error) {
+	total := 0
+	db := u.Blockchain.Database
+
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(utxoPrefix); it.ValidForPrefix(utxoPrefix); it.Next() {
+			v, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			outs, err := DeserializeOutputs(v)
+			if err != nil {
+				return err
+			}
+
+			for _, out := range outs.Outputs {
+				total += out.Value
+			}
+		}
+
+		return nil
+	})
+
+	return total, err
 }
 
 // CountTransactions method
-func (u UTXOSet) CountTransactions() int {
+func (u UTXOSet) CountTransactions() (int, error) {
 	db := u.Blockchain.Database
 	counter := 0
 
@@ -99,83 +185,147 @@ func (u UTXOSet) CountTransactions() int {
 		}
 		return nil
 	})
-	Handle(err)
 
-	return counter
+	return counter, err
 }
 
 // Reindex method
-func (u UTXOSet) Reindex() {
+func (u UTXOSet) Reindex() error {
 	db := u.Blockchain.Database
-	u.DeleteByPrefix(utxoPrefix)
-	UTXO := u.Blockchain.FindUTXO()
+	if err := u.DeleteByPrefix(utxoPrefix); err != nil {
+		return err
+	}
+	UTXO, err := u.Blockchain.FindUTXO()
+	if err != nil {
+		return err
+	}
 
-	err := db.Update(func(txn *badger.Txn) error {
+	return db.Update(func(txn *badger.Txn) error {
 		for txID, outs := range UTXO {
 			key, err := hex.DecodeString(txID)
-			Handle(err)
-			key = append(utxoPrefix, key...)
+			if err != nil {
+				return err
+			}
+			key = append(append([]byte{}, utxoPrefix...), key...)
 
-			err = txn.Set(key, outs.Serialize())
-			Handle(err)
+			if err := txn.Set(key, outs.Serialize()); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
-	Handle(err)
 }
 
-// Update method
-func (u *UTXOSet) Update(block *Block) {
-	db := u.Blockchain.Database
+// Update method to move the UTXO set in txn along with a block joining the
+// main chain, what the block spends is kept as its undo data
+func (u *UTXOSet) Update(txn *badger.Txn, block *Block) error {
+	coinTime, err := u.Blockchain.coinTime(block)
+	if err != nil {
+		return err
+	}
 
-	err := db.Update(func(txn *badger.Txn) error {
-		for _, tx := range block.Transactions {
-			if tx.IsCoinbase() == false {
-				for _, in := range tx.Inputs {
-					updatedOuts := TxOutputs{}
-					inID := append(utxoPrefix, in.ID...)
-					item, err := txn.Get(inID)
-					Handle(err)
-					v, err := item.ValueCopy(nil)
-					Handle(err)
-
-					outs := DeserializeOutputs(v)
-
-					for outIdx, out := range outs.Outputs {
-						if outIdx != in.Out {
-							updatedOuts.Outputs = append(updatedOuts.Outputs, out)
-						}
-					}
+	undo := BlockUndo{}
+
+	for _, tx := range block.Transactions {
+		if tx.IsCoinbase() == false {
+			for _, in := range tx.Inputs {
+				inID := append(append([]byte{}, utxoPrefix...), in.ID...)
+				item, err := txn.Get(inID)
+				if err != nil {
+					return err
+				}
+				v, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+
+				updatedOuts, err := DeserializeOutputs(v)
+				if err != nil {
+					return err
+				}
+				undo.Spent = append(undo.Spent, SpentOutput{in.ID, in.Out, updatedOuts.Outputs[in.Out],
+					updatedOuts.Height, updatedOuts.Time})
+				delete(updatedOuts.Outputs, in.Out)
 
-					if len(updatedOuts.Outputs) == 0 {
-						if err := txn.Delete(inID); err != nil {
-							log.Panic(err)
-						}
-					} else {
-						if err := txn.Set(inID, updatedOuts.Serialize()); err != nil {
-							log.Panic(err)
-						}
+				if len(updatedOuts.Outputs) == 0 {
+					if err := txn.Delete(inID); err != nil {
+						return err
+					}
+				} else {
+					if err := txn.Set(inID, updatedOuts.Serialize()); err != nil {
+						return err
 					}
 				}
 			}
-			newOutputs := TxOutputs{}
-			for _, out := range tx.Outputs {
-				newOutputs.Outputs = append(newOutputs.Outputs, out)
-			}
+		}
+		newOutputs := TxOutputs{make(map[int]TxOutput), block.Height, coinTime}
+		for outIdx, out := range tx.Outputs {
+			newOutputs.Outputs[outIdx] = out
+		}
 
-			txID := append(utxoPrefix, tx.ID...)
-			if err := txn.Set(txID, newOutputs.Serialize()); err != nil {
-				log.Panic(err)
+		txID := append(append([]byte{}, utxoPrefix...), tx.ID...)
+		if err := txn.Set(txID, newOutputs.Serialize()); err != nil {
+			return err
+		}
+	}
+
+	return txn.Set(undoKey(block.Hash), undo.Serialize())
+}
+
+// Revert method to undo Update in txn for the tip block, the outputs the
+// block created are removed and the outputs it spent come back from its undo data
+func (u *UTXOSet) Revert(txn *badger.Txn, block *Block) error {
+	item, err := txn.Get(undoKey(block.Hash))
+	if err == badger.ErrKeyNotFound {
+		return ErrNoUndoData
+	}
+	if err != nil {
+		return err
+	}
+	v, err := item.ValueCopy(nil)
+	if err != nil {
+		return err
+	}
+	undo, err := DeserializeUndo(v)
+	if err != nil {
+		return err
+	}
+
+	for _, tx := range block.Transactions {
+		txID := append(append([]byte{}, utxoPrefix...), tx.ID...)
+		if err := txn.Delete(txID); err != nil {
+			return err
+		}
+	}
+
+	for _, spent := range undo.Spent {
+		inID := append(append([]byte{}, utxoPrefix...), spent.TxID...)
+		outs := TxOutputs{make(map[int]TxOutput), spent.Height, spent.Time}
+
+		item, err := txn.Get(inID)
+		if err == nil {
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if outs, err = DeserializeOutputs(v); err != nil {
+				return err
 			}
+		} else if err != badger.ErrKeyNotFound {
+			return err
 		}
 
-		return nil
-	})
-	Handle(err)
+		outs.Outputs[spent.Index] = spent.Output
+		if err := txn.Set(inID, outs.Serialize()); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // DeleteByPrefix method
-func (u *UTXOSet) DeleteByPrefix(prefix []byte) {
+func (u *UTXOSet) DeleteByPrefix(prefix []byte) error {
 	deleteKeys := func(keysForDelete [][]byte) error {
 		if err := u.Blockchain.Database.Update(func(txn *badger.Txn) error {
 			for _, key := range keysForDelete {
@@ -191,7 +341,7 @@ func (u *UTXOSet) DeleteByPrefix(prefix []byte) {
 	}
 
 	collectSize := 100000
-	u.Blockchain.Database.View(func(txn *badger.Txn) error {
+	return u.Blockchain.Database.View(func(txn *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
 		opts.PrefetchValues = false
 		it := txn.NewIterator(opts)
@@ -205,7 +355,7 @@ func (u *UTXOSet) DeleteByPrefix(prefix []byte) {
 			keysCollected++
 			if keysCollected == collectSize {
 				if err := deleteKeys(keysForDelete); err != nil {
-					log.Panic(err)
+					return err
 				}
 				keysForDelete = make([][]byte, 0, collectSize)
 				keysCollected = 0
@@ -213,7 +363,7 @@ func (u *UTXOSet) DeleteByPrefix(prefix []byte) {
 		}
 		if keysCollected > 0 {
 			if err := deleteKeys(keysForDelete); err != nil {
-				log.Panic(err)
+				return err
 			}
 		}
 		return nil
@@ -0,0 +1,316 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// maxFutureBlockTime is how far ahead of the local clock a block timestamp may be
+const maxFutureBlockTime = 2 * time.Hour
+
+var (
+	// ErrOrphanBlock error when the parent of a block is unknown
+	ErrOrphanBlock = errors.New("Parent block is unknown")
+	// ErrBadPrevHash error when a block does not extend the tip of the chain
+	ErrBadPrevHash = errors.New("Block does not extend the tip of the chain")
+	// ErrBadHeight error when the height is not one more than the parent's
+	ErrBadHeight = errors.New("Block height does not follow its parent")
+	// ErrBadTimestamp error when the block is too far in the future
+	ErrBadTimestamp = errors.New("Block timestamp is too far in the future")
+	// ErrTimeTooOld error when the block is not newer than the median time past of its parent
+	ErrTimeTooOld = errors.New("Block timestamp is not after the median time of the last blocks")
+	// ErrBadMerkleRoot error when the header does not commit to the transactions
+	ErrBadMerkleRoot = errors.New("Merkle root does not match the transactions")
+	// ErrBadProofOfWork error when the hash does not meet the expected target
+	ErrBadProofOfWork = errors.New("Block does not meet the expected proof of work")
+	// ErrBadCoinbase error when the block does not start with exactly one coinbase
+	ErrBadCoinbase = errors.New("Block must have exactly one coinbase as its first transaction")
+	// ErrBadCoinbaseAmount error when the coinbase pays out more than the subsidy and the fees
+	ErrBadCoinbaseAmount = errors.New("Coinbase pays out more than the subsidy and the fees")
+	// ErrBadCoinbaseHeight error when the coinbase does not start with the height of its block
+	ErrBadCoinbaseHeight = errors.New("Coinbase does not start with the block height")
+	// ErrDuplicateTx error when a transaction has the id of one whose outputs are still unspent
+	ErrDuplicateTx = errors.New("Transaction id already has unspent outputs")
+	// ErrBadTxID error when a transaction id is not the hash of the transaction
+	ErrBadTxID = errors.New("Transaction id does not match its hash")
+	// ErrNoInputs error when a transaction other than the coinbase spends nothing
+	ErrNoInputs = errors.New("Transaction has no inputs")
+	// ErrNoOutputs error when a transaction other than the coinbase pays nothing out
+	ErrNoOutputs = errors.New("Transaction has no outputs")
+	// ErrBadOutputValue error when an output has a negative value
+	ErrBadOutputValue = errors.New("Transaction output has a negative value")
+	// ErrOutputsAboveSupply error when the outputs of a transaction pay more than there can ever be
+	ErrOutputsAboveSupply = errors.New("Transaction outputs exceed the maximum money supply")
+	// ErrMissingInput error when an input is not in the UTXO set
+	ErrMissingInput = errors.New("Transaction input is missing or already spent")
+	// ErrBlockDoubleSpend error when two inputs in a block spend the same output
+	ErrBlockDoubleSpend = errors.New("Output is spent twice in the block")
+	// ErrInputsBelowOutputs error when a transaction creates more than it spends
+	ErrInputsBelowOutputs = errors.New("Transaction outputs exceed its inputs")
+	// ErrBadSignature error when an input signature does not verify
+	ErrBadSignature = errors.New("Transaction signature is invalid")
+)
+
+// BlockError structure that tells which block broke which rule
+type BlockError struct {
+	Hash []byte
+	Err  error
+}
+
+func (e *BlockError) Error() string {
+	return fmt.Sprintf("Invalid block %x: %s", e.Hash, e.Err)
+}
+
+// Unwrap method so errors.Is finds the broken rule
+func (e *BlockError) Unwrap() error {
+	return e.Err
+}
+
+// TxError structure that tells which transaction broke which rule
+type TxError struct {
+	ID  []byte
+	Err error
+}
+
+func (e *TxError) Error() string {
+	return fmt.Sprintf("Invalid transaction %x: %s", e.ID, e.Err)
+}
+
+// Unwrap method so errors.Is finds the broken rule
+func (e *TxError) Unwrap() error {
+	return e.Err
+}
+
+// CheckBlockHeader method to check the header of a block against its parent,
+// these checks do not depend on the UTXO set so they hold for side branches too
+func (bc *BlockChain) CheckBlockHeader(block *Block) error {
+	parent, err := bc.GetBlock(block.PrevHash)
+	if err != nil {
+		return &BlockError{block.Hash, ErrOrphanBlock}
+	}
+
+	if block.Height != parent.Height+1 {
+		return &BlockError{block.Hash, ErrBadHeight}
+	}
+
+	if time.Unix(block.Timestamp, 0).After(time.Now().Add(maxFutureBlockTime)) {
+		return &BlockError{block.Hash, ErrBadTimestamp}
+	}
+
+	medianTime, err := bc.MedianTimePast(&parent)
+	if err != nil {
+		return err
+	}
+	if block.Timestamp <= medianTime {
+		return &BlockError{block.Hash, ErrTimeTooOld}
+	}
+
+	if !bytes.Equal(block.MerkleRoot, block.HashTransactions()) {
+		return &BlockError{block.Hash, ErrBadMerkleRoot}
+	}
+
+	bits, err := bc.CalcNextBits(&parent)
+	if err != nil {
+		return err
+	}
+
+	pow := &ProofOfWork{block, CompactToBig(bits)}
+	if !pow.Validate() {
+		return &BlockError{block.Hash, ErrBadProofOfWork}
+	}
+
+	return nil
+}
+
+// ValidateBlock method to run every consensus rule on a block that extends
+// the tip, the transactions are checked against the current UTXO set
+func (bc *BlockChain) ValidateBlock(block *Block) error {
+	if !bytes.Equal(block.PrevHash, bc.LastHash) {
+		return &BlockError{block.Hash, ErrBadPrevHash}
+	}
+
+	if err := bc.CheckBlockHeader(block); err != nil {
+		return err
+	}
+
+	if len(block.Transactions) == 0 || !block.Transactions[0].IsCoinbase() {
+		return &BlockError{block.Hash, ErrBadCoinbase}
+	}
+
+	parent, err := bc.GetBlock(block.PrevHash)
+	if err != nil {
+		return err
+	}
+	medianTime, err := bc.MedianTimePast(&parent)
+	if err != nil {
+		return err
+	}
+
+	fees := 0
+	spent := make(map[string]bool)
+	for _, tx := range block.Transactions[1:] {
+		if tx.IsCoinbase() {
+			return &BlockError{block.Hash, ErrBadCoinbase}
+		}
+
+		for _, in := range tx.Inputs {
+			point := outpoint(in.ID, in.Out)
+			if spent[point] {
+				return &BlockError{block.Hash, &TxError{tx.ID, ErrBlockDoubleSpend}}
+			}
+			spent[point] = true
+		}
+
+		fee, err := bc.validateTransaction(tx, block.Height, medianTime)
+		if err != nil {
+			return &BlockError{block.Hash, err}
+		}
+		fees += fee
+	}
+
+	coinbase := block.Transactions[0]
+	if err := checkTxFormat(coinbase, bc.Params.MaxSupply()); err != nil {
+		return &BlockError{block.Hash, err}
+	}
+	if height, ok := coinbase.CoinbaseHeight(); !ok || height != block.Height {
+		return &BlockError{block.Hash, &TxError{coinbase.ID, ErrBadCoinbaseHeight}}
+	}
+	if err := bc.checkNewTxID(coinbase); err != nil {
+		return &BlockError{block.Hash, err}
+	}
+	if !coinbase.IsFinal(block.Height, medianTime) {
+		return &BlockError{block.Hash, &TxError{coinbase.ID, ErrNonFinalTx}}
+	}
+	if coinbase.OutputValue() > bc.Params.BlockSubsidy(block.Height)+fees {
+		return &BlockError{block.Hash, &TxError{coinbase.ID, ErrBadCoinbaseAmount}}
+	}
+
+	return nil
+}
+
+// ValidateTransaction method to check a transaction against the current UTXO
+// set, its inputs must be unspent, cover its outputs and carry valid signatures,
+// and its timelocks must allow it into the next block. It returns the fee, what
+// the inputs pay more than the outputs
+func (bc *BlockChain) ValidateTransaction(tx *Transaction) (int, error) {
+	tip, err := bc.GetBlock(bc.LastHash)
+	if err != nil {
+		return 0, err
+	}
+	medianTime, err := bc.MedianTimePast(&tip)
+	if err != nil {
+		return 0, err
+	}
+
+	return bc.validateTransaction(tx, tip.Height+1, medianTime)
+}
+
+// validateTransaction checks a transaction for the block at height whose
+// parent has the median time past medianTime and returns its fee
+func (bc *BlockChain) validateTransaction(tx *Transaction, height int, medianTime int64) (int, error) {
+	if tx.IsCoinbase() {
+		return 0, &TxError{tx.ID, ErrBadCoinbase}
+	}
+
+	if err := checkTxFormat(tx, bc.Params.MaxSupply()); err != nil {
+		return 0, err
+	}
+
+	if !tx.IsFinal(height, medianTime) {
+		return 0, &TxError{tx.ID, ErrNonFinalTx}
+	}
+
+	if err := bc.checkNewTxID(tx); err != nil {
+		return 0, err
+	}
+
+	UTXOSet := UTXOSet{bc}
+	inputValue := 0
+	inputs := make(map[string]bool)
+
+	for _, in := range tx.Inputs {
+		point := outpoint(in.ID, in.Out)
+		if inputs[point] {
+			return 0, &TxError{tx.ID, ErrDoubleSpend}
+		}
+		inputs[point] = true
+
+		outs, ok, err := UTXOSet.FindOutputs(in.ID)
+		if err != nil {
+			return 0, err
+		}
+		out, spendable := outs.Outputs[in.Out]
+		if !ok || !spendable {
+			return 0, &TxError{tx.ID, ErrMissingInput}
+		}
+		if sequenceLocked(in, outs, height, medianTime) {
+			return 0, &TxError{tx.ID, ErrSequenceLocked}
+		}
+		inputValue += out.Value
+	}
+
+	if inputValue < tx.OutputValue() {
+		return 0, &TxError{tx.ID, ErrInputsBelowOutputs}
+	}
+
+	valid, err := bc.VerifyTransaction(tx)
+	if err != nil {
+		return 0, err
+	}
+	if !valid {
+		return 0, &TxError{tx.ID, ErrBadSignature}
+	}
+
+	return inputValue - tx.OutputValue(), nil
+}
+
+// checkNewTxID rejects a transaction whose id already has a record in the
+// UTXO set, the new outputs would overwrite the old ones and rolling the
+// block back would delete both
+func (bc *BlockChain) checkNewTxID(tx *Transaction) error {
+	UTXOSet := UTXOSet{bc}
+
+	_, found, err := UTXOSet.FindOutputs(tx.ID)
+	if err != nil {
+		return err
+	}
+	if found {
+		return &TxError{tx.ID, ErrDuplicateTx}
+	}
+
+	return nil
+}
+
+func checkTxFormat(tx *Transaction, maxSupply int) error {
+	if !bytes.Equal(tx.ID, tx.Hash()) {
+		return &TxError{tx.ID, ErrBadTxID}
+	}
+
+	if !tx.IsCoinbase() {
+		if len(tx.Inputs) == 0 {
+			return &TxError{tx.ID, ErrNoInputs}
+		}
+		if len(tx.Outputs) == 0 {
+			return &TxError{tx.ID, ErrNoOutputs}
+		}
+	}
+
+	total := 0
+	for _, out := range tx.Outputs {
+		if out.Value < 0 {
+			return &TxError{tx.ID, ErrBadOutputValue}
+		}
+		// checking every output keeps the sum from overflowing
+		if out.Value > maxSupply {
+			return &TxError{tx.ID, ErrOutputsAboveSupply}
+		}
+		total += out.Value
+		if total > maxSupply {
+			return &TxError{tx.ID, ErrOutputsAboveSupply}
+		}
+	}
+
+	return nil
+}
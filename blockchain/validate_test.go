@@ -0,0 +1,337 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shortdaddy0711/golang-blockchain/params"
+	"github.com/shortdaddy0711/golang-blockchain/signer"
+	"github.com/shortdaddy0711/golang-blockchain/wallet"
+)
+
+// testWallet is a key the tests send from and mine to
+type testWallet struct {
+	*wallet.Wallet
+	address string
+}
+
+func newTestWallet(t *testing.T) testWallet {
+	t.Helper()
+
+	w, err := wallet.MakeWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testWallet{w, string(w.Address(&params.RegTest))}
+}
+
+// send builds a transaction of amount and fee from w to the address to
+func send(t *testing.T, chain *BlockChain, w testWallet, to string, amount, fee int) *Transaction {
+	t.Helper()
+
+	tx, err := NewTransaction(signer.NewKeySigner(w.PrivateKey), w.PublicKey, to, amount, fee, 0, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tx
+}
+
+// newBlock builds a block on the tip paying the subsidy and the fees of txs
+// to the address miner, without adding it to the chain
+func newBlock(t *testing.T, chain *BlockChain, miner string, txs ...*Transaction) *Block {
+	t.Helper()
+
+	tip, err := chain.GetBlock(chain.LastHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bits, err := chain.CalcNextBits(&tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timestamp, err := chain.NextBlockTime(&tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fees := 0
+	for _, tx := range txs {
+		fee, err := chain.ValidateTransaction(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fees += fee
+	}
+	coinbase, err := CoinbaseTx(miner, "", tip.Height+1, fees, chain.Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return CreateBlock(append([]*Transaction{coinbase}, txs...), tip.Hash, tip.Height+1, bits, timestamp)
+}
+
+// mine adds a block of txs to the chain, see newBlock
+func mine(t *testing.T, chain *BlockChain, miner string, txs ...*Transaction) *Block {
+	t.Helper()
+
+	block := newBlock(t, chain, miner, txs...)
+	if _, err := chain.ImportBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	return block
+}
+
+// remine gives a block changed by a test a valid proof of work again
+func remine(block *Block) {
+	block.MerkleRoot = block.HashTransactions()
+	nonce, hash := NewProof(block).Run()
+	block.Nonce = nonce
+	block.Hash = hash
+}
+
+// rehash makes a transaction changed by a test consistent with its id again,
+// its signatures stay those of the original
+func rehash(tx *Transaction) {
+	tx.ID = tx.Hash()
+}
+
+func balance(t *testing.T, chain *BlockChain, address string) int {
+	t.Helper()
+
+	pkScript, err := wallet.AddressScript(address, chain.Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outs, err := (&UTXOSet{chain}).FindUTXO(pkScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := 0
+	for _, out := range outs {
+		total += out.Value
+	}
+
+	return total
+}
+
+func TestValidBlocks(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+	alice, bob, miner := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+
+	mine(t, chain, alice.address)
+	mine(t, chain, miner.address, send(t, chain, alice, bob.address, 30, 5))
+
+	subsidy := params.RegTest.BlockSubsidy(1)
+	if got := balance(t, chain, alice.address); got != subsidy-35 {
+		t.Errorf("alice has %d, want %d", got, subsidy-35)
+	}
+	if got := balance(t, chain, bob.address); got != 30 {
+		t.Errorf("bob has %d, want 30", got)
+	}
+	if got := balance(t, chain, miner.address); got != params.RegTest.BlockSubsidy(2)+5 {
+		t.Errorf("miner has %d, want %d", got, params.RegTest.BlockSubsidy(2)+5)
+	}
+}
+
+func TestValidateBlockRejects(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	mine(t, chain, alice.address)
+	mine(t, chain, alice.address)
+	// its outputs stay unspent, alice has enough without them
+	mined := send(t, chain, alice, bob.address, 5, 0)
+	mine(t, chain, alice.address, mined)
+
+	tests := []struct {
+		name  string
+		block func() *Block
+		want  error
+	}{
+		{"no coinbase", func() *Block {
+			block := newBlock(t, chain, bob.address, send(t, chain, alice, bob.address, 10, 0))
+			block.Transactions = block.Transactions[1:]
+			remine(block)
+			return block
+		}, ErrBadCoinbase},
+		{"second coinbase", func() *Block {
+			block := newBlock(t, chain, bob.address)
+			block.Transactions = append(block.Transactions, block.Transactions[0])
+			remine(block)
+			return block
+		}, ErrBadCoinbase},
+		{"coinbase above subsidy and fees", func() *Block {
+			block := newBlock(t, chain, bob.address, send(t, chain, alice, bob.address, 10, 2))
+			block.Transactions[0].Outputs[0].Value++
+			rehash(block.Transactions[0])
+			remine(block)
+			return block
+		}, ErrBadCoinbaseAmount},
+		{"coinbase without the height", func() *Block {
+			block := newBlock(t, chain, bob.address)
+			block.Transactions[0].Inputs[0].ScriptSig = []byte{1, 2, 3}
+			rehash(block.Transactions[0])
+			remine(block)
+			return block
+		}, ErrBadCoinbaseHeight},
+		{"coinbase of another height", func() *Block {
+			block := newBlock(t, chain, bob.address)
+			block.Transactions[0].Inputs[0].ScriptSig = coinbaseScript(block.Height-1, nil)
+			rehash(block.Transactions[0])
+			remine(block)
+			return block
+		}, ErrBadCoinbaseHeight},
+		{"transaction already on the chain", func() *Block {
+			block := newBlock(t, chain, bob.address)
+			block.Transactions = append(block.Transactions, mined)
+			remine(block)
+			return block
+		}, ErrDuplicateTx},
+		{"output spent twice", func() *Block {
+			return newBlock(t, chain, bob.address,
+				send(t, chain, alice, bob.address, 10, 0), send(t, chain, alice, bob.address, 11, 0))
+		}, ErrBlockDoubleSpend},
+		{"missing input", func() *Block {
+			tx := send(t, chain, alice, bob.address, 10, 0)
+			block := newBlock(t, chain, bob.address, tx)
+			tx.Inputs[0].ID = bytes.Repeat([]byte{1}, 32)
+			rehash(tx)
+			remine(block)
+			return block
+		}, ErrMissingInput},
+		{"outputs above inputs", func() *Block {
+			tx := send(t, chain, alice, bob.address, 10, 0)
+			block := newBlock(t, chain, bob.address, tx)
+			tx.Outputs[0].Value += 1000
+			rehash(tx)
+			remine(block)
+			return block
+		}, ErrInputsBelowOutputs},
+		{"signature of other outputs", func() *Block {
+			tx := send(t, chain, alice, bob.address, 10, 0)
+			block := newBlock(t, chain, bob.address, tx)
+			tx.Outputs[0].Value--
+			rehash(tx)
+			remine(block)
+			return block
+		}, ErrBadSignature},
+		{"no inputs", func() *Block {
+			block := newBlock(t, chain, bob.address)
+			out, err := NewTXOutput(10, bob.address, chain.Params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tx := &Transaction{nil, nil, []TxOutput{*out}, 0}
+			rehash(tx)
+			block.Transactions = append(block.Transactions, tx)
+			remine(block)
+			return block
+		}, ErrNoInputs},
+		{"no outputs", func() *Block {
+			tx := send(t, chain, alice, bob.address, 10, 0)
+			block := newBlock(t, chain, bob.address, tx)
+			tx.Outputs = nil
+			rehash(tx)
+			remine(block)
+			return block
+		}, ErrNoOutputs},
+		{"negative output", func() *Block {
+			block := newBlock(t, chain, bob.address)
+			block.Transactions[0].Outputs = append(block.Transactions[0].Outputs, TxOutput{-1, nil})
+			rehash(block.Transactions[0])
+			remine(block)
+			return block
+		}, ErrBadOutputValue},
+		{"wrong transaction id", func() *Block {
+			block := newBlock(t, chain, bob.address)
+			block.Transactions[0].ID = bytes.Repeat([]byte{2}, 32)
+			remine(block)
+			return block
+		}, ErrBadTxID},
+		{"unlocking script replaced under the same id", func() *Block {
+			tx := send(t, chain, alice, bob.address, 10, 0)
+			block := newBlock(t, chain, bob.address, tx)
+			tx.Inputs[0].ScriptSig = []byte{0x51}
+			remine(block)
+			return block
+		}, ErrBadTxID},
+		{"wrong merkle root", func() *Block {
+			block := newBlock(t, chain, bob.address)
+			block.MerkleRoot = bytes.Repeat([]byte{3}, 32)
+			block.Hash = block.HeaderHash()
+			return block
+		}, ErrBadMerkleRoot},
+		{"wrong height", func() *Block {
+			block := newBlock(t, chain, bob.address)
+			block.Height++
+			remine(block)
+			return block
+		}, ErrBadHeight},
+		{"far in the future", func() *Block {
+			block := newBlock(t, chain, bob.address)
+			block.Timestamp = time.Now().Add(3 * time.Hour).Unix()
+			remine(block)
+			return block
+		}, ErrBadTimestamp},
+		{"before the median time past", func() *Block {
+			block := newBlock(t, chain, bob.address)
+			block.Timestamp = params.RegTest.GenesisTime
+			remine(block)
+			return block
+		}, ErrTimeTooOld},
+		{"easier target", func() *Block {
+			block := newBlock(t, chain, bob.address)
+			block.Bits = BigToCompact(params.RegTest.PowLimit) + 1
+			remine(block)
+			return block
+		}, ErrBadProofOfWork},
+		{"hash above the target", func() *Block {
+			block := newBlock(t, chain, bob.address)
+			for block.Hash = block.HeaderHash(); NewProof(block).Validate(); block.Hash = block.HeaderHash() {
+				block.Nonce++
+			}
+			return block
+		}, ErrBadProofOfWork},
+	}
+
+	for _, test := range tests {
+		tip := chain.LastHash
+		_, err := chain.ImportBlock(test.block())
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+		if !bytes.Equal(chain.LastHash, tip) {
+			t.Fatalf("%s: the invalid block became the tip", test.name)
+		}
+	}
+}
+
+func TestValidateBlockNotOnTip(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+	miner := newTestWallet(t)
+
+	stale := newBlock(t, chain, miner.address)
+	mine(t, chain, miner.address)
+
+	if err := chain.ValidateBlock(stale); !errors.Is(err, ErrBadPrevHash) {
+		t.Fatalf("validating a block beside the tip returned %v", err)
+	}
+}
+
+func TestValidateBlockOrphan(t *testing.T) {
+	chain := newTestChain(t, newTestConfig(t))
+	miner := newTestWallet(t)
+
+	block := newBlock(t, chain, miner.address)
+	block.PrevHash = bytes.Repeat([]byte{4}, 32)
+	remine(block)
+
+	if _, err := chain.ImportBlock(block); !errors.Is(err, ErrOrphanBlock) {
+		t.Fatalf("importing a block of an unknown parent returned %v", err)
+	}
+}
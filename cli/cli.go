@@ -1,14 +1,23 @@
 package cli
 
 import (
+	"encoding/hex"
 	"flag"
 	"fmt"
-	"log"
+	"io/ioutil"
+	"math"
 	"os"
 	"runtime"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/shortdaddy0711/golang-blockchain/blockchain"
+	"github.com/shortdaddy0711/golang-blockchain/config"
+	"github.com/shortdaddy0711/golang-blockchain/network"
+	"github.com/shortdaddy0711/golang-blockchain/params"
+	"github.com/shortdaddy0711/golang-blockchain/rpc"
+	"github.com/shortdaddy0711/golang-blockchain/signer"
 	"github.com/shortdaddy0711/golang-blockchain/wallet"
 )
 
@@ -20,12 +29,28 @@ type CommandLine struct {
 func (cli *CommandLine) printUsage() {
 	fmt.Println("Usage:")
 	fmt.Println(" getbalance -address ADDRESS - Get the balance for an address")
-	fmt.Println(" createblockchain -address ADDRESS - Creates a blockchain and sends genesis reward to address")
+	fmt.Println(" createblockchain -address ADDRESS - Creates a blockchain from the network genesis and mines the first block to address")
 	fmt.Println(" printchain - Prints the blocks in the chain")
-	fmt.Println(" send -from FROM -to TO -amount AMOUNT - Send amount of coins")
-	fmt.Println(" createwallet - Creates a new Wallet")
-	fmt.Println(" listaddresses - Lists the addresses in our wallet file")
+	fmt.Println(" getblock -height N - Prints the block at height N of the main chain")
+	fmt.Println(" getblockhash -height N - Prints the hash of the block at height N of the main chain")
+	fmt.Println(" send -from FROM -to TO -amount AMOUNT -fee FEE -mine -passphrase PASS -locktime N -signer SOCKET - Send amount of coins and pay FEE to the miner. When -mine is set, mine the block on this node, an encrypted wallet needs -passphrase unless the external signer on SOCKET signs. -locktime keeps the transaction out of the chain until block height N, or unix time N from 500000000 on")
+	fmt.Println(" createwallet -mnemonic -passphrase PASS - Creates a new Wallet, an encrypted wallet needs -passphrase. When -mnemonic is set, new wallets are derived from a new seed phrase")
+	fmt.Println(" restorewallet -mnemonic WORDS -count N -passphrase PASS - Restores the first N wallets derived from the seed phrase WORDS")
+	fmt.Println(" createmultisig -required M -keys KEY,KEY,... - Creates an address that needs M signatures of the keys, given as hex public keys or addresses in the wallet file")
+	fmt.Println(" signpartial -tx FILE -from ADDRESS -to TO -amount AMOUNT -fee FEE -passphrase PASS -signer SOCKET - Adds the signatures of the wallet file, or of the external signer on SOCKET, to the multisig transaction in FILE, creating it from -from, -to, -amount and -fee when those are set")
+	fmt.Println(" combine -in FILE,FILE,... -out FILE -send - Merges the signatures of the multisig transactions, writing the result to -out and sending it when -send is set")
+	fmt.Println(" encryptwallet -passphrase PASS - Encrypts the private keys in the wallet file with PASS")
+	fmt.Println(" walletpassphrase -passphrase PASS -timeout SECONDS -rpc ADDR - Unlocks the wallet of the JSON-RPC server at ADDR for SECONDS")
+	fmt.Println(" walletlock -rpc ADDR - Locks the wallet of the JSON-RPC server at ADDR")
+	fmt.Println(" listaddresses -pubkeys - Lists the addresses in our wallet file, with their hex public keys when -pubkeys is set")
 	fmt.Println(" reindexutxo - Rebuilds the UTXO set")
+	fmt.Println(" reindextx -drop - Builds the transaction index and keeps it from then on, so transactions are looked up without walking the chain. -drop deletes it")
+	fmt.Println(" supply - Checks the coins in the UTXO set against the subsidies paid out up to the tip")
+	fmt.Println(" rollback -blocks N - Takes the last N blocks off the chain and restores the UTXO set")
+	fmt.Println(" startnode -port PORT -miner ADDRESS -rpc ADDR -signer SOCKET - Start a node listening on PORT (defaults to NODE_ID), mining to ADDRESS when -miner is set. -rpc serves JSON-RPC over HTTP on ADDR from the node's chain and mempool, signing with the external signer on SOCKET when -signer is set")
+	fmt.Println(" startsigner -socket SOCKET -passphrase PASS - Sign for the other commands with the keys of the wallet file on the unix socket SOCKET, so they need no private keys")
+	fmt.Println("Every command takes -datadir DIR to keep the chain and wallets in DIR, " + config.DataDirEnv + " sets the default")
+	fmt.Println("Every command takes -network NAME to use mainnet (default), testnet or regtest")
 
 }
 
@@ -36,117 +61,657 @@ func (cli *CommandLine) validateArgs() {
 	}
 }
 
-func (cli *CommandLine) reindexUTXO() {
-	chain := blockchain.ContinueBlockChain("")
+func (cli *CommandLine) startNode(cfg *config.Config, port, minerAddress, rpcListen, socket string) error {
+	fmt.Printf("Starting Node localhost:%s\n", port)
+
+	if len(minerAddress) > 0 {
+		if err := wallet.ValidateAddress(minerAddress, cfg.Params); err != nil {
+			return fmt.Errorf("Wrong miner address: %w", err)
+		}
+		fmt.Println("Mining is on. Address to receive rewards: ", minerAddress)
+	}
+
+	var rpcCfg *network.RPCConfig
+	if rpcListen != "" {
+		rpcCfg = &network.RPCConfig{Listen: rpcListen}
+		if socket != "" {
+			rpcCfg.Signer = signer.NewRemoteSigner(socket)
+		}
+	}
+
+	return network.StartServer(cfg, port, minerAddress, rpcCfg)
+}
+
+func (cli *CommandLine) startSigner(cfg *config.Config, socket, passphrase string) error {
+	wallets, err := wallet.CreateWallets(cfg)
+	if err != nil {
+		return err
+	}
+	if err := unlockWallets(wallets, passphrase); err != nil {
+		return err
+	}
+	keys, err := wallets.Signer()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Signing with %d keys on %s\n", len(wallets.Wallets), socket)
+
+	return signer.ListenAndServe(socket, keys)
+}
+
+func (cli *CommandLine) reindexUTXO(cfg *config.Config) error {
+	chain, err := blockchain.ContinueBlockChain(cfg)
+	if err != nil {
+		return err
+	}
 	defer chain.Database.Close()
+
 	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
-	UTXOSet.Reindex()
+	if err := UTXOSet.Reindex(); err != nil {
+		return err
+	}
 
-	count := UTXOSet.CountTransactions()
+	count, err := UTXOSet.CountTransactions()
+	if err != nil {
+		return err
+	}
 	fmt.Printf("Done! There are %d transactions in the UTXO set.\n", count)
+
+	return nil
+}
+
+func (cli *CommandLine) reindexTx(cfg *config.Config, drop bool) error {
+	chain, err := blockchain.ContinueBlockChain(cfg)
+	if err != nil {
+		return err
+	}
+	defer chain.Database.Close()
+
+	if drop {
+		if err := chain.DropTxIndex(); err != nil {
+			return err
+		}
+		fmt.Println("Done! The transaction index is deleted.")
+		return nil
+	}
+
+	count, err := chain.ReindexTransactions()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Done! There are %d transactions in the transaction index.\n", count)
+
+	return nil
+}
+
+func (cli *CommandLine) supply(cfg *config.Config) error {
+	chain, err := blockchain.ContinueBlockChain(cfg)
+	if err != nil {
+		return err
+	}
+	defer chain.Database.Close()
+
+	height, err := chain.GetBestHeight()
+	if err != nil {
+		return err
+	}
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	total, err := UTXOSet.TotalValue()
+	if err != nil {
+		return err
+	}
+
+	p := cfg.Params
+	emitted := p.Emission(height)
+	fmt.Printf("Height:         %d\n", height)
+	fmt.Printf("Block subsidy:  %d\n", p.BlockSubsidy(height))
+	fmt.Printf("Unspent coins:  %d\n", total)
+	fmt.Printf("Emitted coins:  %d\n", emitted)
+	fmt.Printf("Maximum supply: %d\n", p.MaxSupply())
+
+	// fees only move coins and a coinbase may claim less than it could,
+	// so the unspent coins can fall short of the emission but never exceed it
+	if total > emitted {
+		return fmt.Errorf("The UTXO set holds %d coins, more than the %d emitted by height %d", total, emitted, height)
+	}
+	fmt.Printf("Done! %d coins were never claimed or burned.\n", emitted-total)
+
+	return nil
 }
 
-func (cli *CommandLine) listaddresses() {
-	wallets, _ := wallet.CreateWallets()
+func (cli *CommandLine) rollback(blocks int, cfg *config.Config) error {
+	chain, err := blockchain.ContinueBlockChain(cfg)
+	if err != nil {
+		return err
+	}
+	defer chain.Database.Close()
+
+	for i := 0; i < blocks; i++ {
+		block, err := chain.DisconnectTip()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Disconnected block %x at height %d\n", block.Hash, block.Height)
+	}
+
+	height, err := chain.GetBestHeight()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Done! The tip is at height %d.\n", height)
+
+	return nil
+}
+
+func (cli *CommandLine) listaddresses(cfg *config.Config, withPubKeys bool) error {
+	wallets, err := wallet.CreateWallets(cfg)
+	if err != nil {
+		return err
+	}
 	addresses := wallets.GetAllAddresses()
 
 	for _, address := range addresses {
+		if withPubKeys {
+			fmt.Printf("%s %x\n", address, wallets.Wallets[address].PublicKey)
+			continue
+		}
 		fmt.Println(address)
 	}
+
+	return nil
 }
 
-func (cli *CommandLine) createWallet() {
-	wallets, _ := wallet.CreateWallets()
-	address := wallets.AddWallet()
-	wallets.SaveFile()
+func (cli *CommandLine) createWallet(cfg *config.Config, passphrase string, withMnemonic bool) error {
+	wallets, err := wallet.CreateWallets(cfg)
+	if err != nil {
+		return err
+	}
+	if err := unlockWallets(wallets, passphrase); err != nil {
+		return err
+	}
+	if withMnemonic {
+		mnemonic, err := wallets.NewSeed()
+		if err != nil {
+			return err
+		}
+		fmt.Println("Write down the seed phrase, it restores every wallet created from now on:")
+		fmt.Println(mnemonic)
+	}
+	address, err := wallets.AddWallet()
+	if err != nil {
+		return err
+	}
+	if err := wallets.SaveFile(cfg); err != nil {
+		return err
+	}
 
 	fmt.Printf("New address is: %s\n", address)
+
+	return nil
+}
+
+func (cli *CommandLine) restoreWallet(cfg *config.Config, mnemonic string, count int, passphrase string) error {
+	wallets, err := wallet.CreateWallets(cfg)
+	if err != nil {
+		return err
+	}
+	if err := unlockWallets(wallets, passphrase); err != nil {
+		return err
+	}
+	if err := wallets.SetMnemonic(mnemonic); err != nil {
+		return err
+	}
+
+	for i := 0; i < count; i++ {
+		address, err := wallets.AddWallet()
+		if err != nil {
+			return err
+		}
+		fmt.Println(address)
+	}
+	if err := wallets.SaveFile(cfg); err != nil {
+		return err
+	}
+
+	fmt.Printf("Restored %d addresses\n", count)
+
+	return nil
+}
+
+func (cli *CommandLine) createMultiSig(cfg *config.Config, required int, keys []string) error {
+	wallets, err := wallet.CreateWallets(cfg)
+	if err != nil {
+		return err
+	}
+
+	var pubKeys [][]byte
+	for _, key := range keys {
+		if w, ok := wallets.Wallets[key]; ok {
+			pubKeys = append(pubKeys, w.PublicKey)
+			continue
+		}
+		pubKey, err := hex.DecodeString(key)
+		if err != nil {
+			return fmt.Errorf("%s is neither an address in the wallet file nor a hex public key", key)
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+
+	address, redeemScript, err := wallet.MultiSigAddress(required, pubKeys, cfg.Params)
+	if err != nil {
+		return err
+	}
+	wallets.AddScript(redeemScript)
+	if err := wallets.SaveFile(cfg); err != nil {
+		return err
+	}
+
+	fmt.Printf("Multisig address is: %s\n", address)
+	fmt.Printf("Redeem script: %x\n", redeemScript)
+
+	return nil
+}
+
+func (cli *CommandLine) signPartial(cfg *config.Config, txFile, from, to string, amount, fee int, passphrase,
+	socket string) error {
+	wallets, err := wallet.CreateWallets(cfg)
+	if err != nil {
+		return err
+	}
+	if err := unlockWallets(wallets, passphrase); err != nil {
+		return err
+	}
+
+	var tx *blockchain.Transaction
+	if from != "" {
+		if tx, err = cli.newMultiSigTransaction(cfg, wallets, from, to, amount, fee); err != nil {
+			return err
+		}
+	} else if tx, err = readTransaction(txFile); err != nil {
+		return err
+	}
+
+	keys, err := walletSigner(wallets, socket)
+	if err != nil {
+		return err
+	}
+	added, err := tx.SignPartial(keys)
+	if err != nil {
+		return err
+	}
+	missing, err := tx.MissingSignatures()
+	if err != nil {
+		return err
+	}
+	if err := writeTransaction(txFile, tx); err != nil {
+		return err
+	}
+
+	fmt.Printf("Added %d signatures to %s, %d more needed\n", added, txFile, missing)
+
+	return nil
 }
 
+func (cli *CommandLine) newMultiSigTransaction(cfg *config.Config, wallets *wallet.Wallets, from, to string,
+	amount, fee int) (*blockchain.Transaction, error) {
+	if err := wallet.ValidateAddress(to, cfg.Params); err != nil {
+		return nil, err
+	}
+	redeemScript, err := wallets.GetScript(from)
+	if err != nil {
+		return nil, err
+	}
 
-func (cli *CommandLine) printChain() {
-	chain := blockchain.ContinueBlockChain("")
+	chain, err := blockchain.ContinueBlockChain(cfg)
+	if err != nil {
+		return nil, err
+	}
 	defer chain.Database.Close()
-	iterator := chain.Iterator()
 
-	for {
-		block := iterator.Next()
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+
+	return blockchain.NewMultiSigTransaction(redeemScript, to, amount, fee, &UTXOSet)
+}
+
+func (cli *CommandLine) combine(cfg *config.Config, inFiles []string, outFile string, send bool) error {
+	var txs []*blockchain.Transaction
+	for _, inFile := range inFiles {
+		tx, err := readTransaction(inFile)
+		if err != nil {
+			return err
+		}
+		txs = append(txs, tx)
+	}
+
+	tx, err := blockchain.CombineTransactions(txs)
+	if err != nil {
+		return err
+	}
+	missing, err := tx.MissingSignatures()
+	if err != nil {
+		return err
+	}
+
+	if outFile != "" {
+		if err := writeTransaction(outFile, tx); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote the combined transaction to %s\n", outFile)
+	}
+	if missing > 0 {
+		fmt.Printf("Transaction %x needs %d more signatures\n", tx.ID, missing)
+		return nil
+	}
+
+	fmt.Printf("Transaction %x is fully signed\n", tx.ID)
+	if send {
+		if err := network.SendTx(network.KnownNodes[0], tx, cfg.Params); err != nil {
+			return err
+		}
+		fmt.Println("Sent transaction to the mempool of", network.KnownNodes[0])
+	}
+
+	return nil
+}
+
+// readTransaction reads a transaction that writeTransaction saved
+func readTransaction(path string) (*blockchain.Transaction, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, fmt.Errorf("%s does not hold a hex encoded transaction", path)
+	}
+
+	tx, err := blockchain.DeserializeTransaction(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tx, nil
+}
+
+// writeTransaction saves a transaction hex encoded so it can be passed between signers
+func writeTransaction(path string, tx *blockchain.Transaction) error {
+	return ioutil.WriteFile(path, []byte(hex.EncodeToString(tx.Serialize())+"\n"), 0600)
+}
 
-		fmt.Printf("Previous Hash: %x\n", block.PrevHash)
-		fmt.Printf("Hash: %s\n", block.Hash)
-		pow := blockchain.NewProof(block)
-		fmt.Printf("PoW: %s\n", strconv.FormatBool(pow.Validate()))
+func (cli *CommandLine) encryptWallet(cfg *config.Config, passphrase string) error {
+	wallets, err := wallet.CreateWallets(cfg)
+	if err != nil {
+		return err
+	}
+	if err := wallets.Encrypt(passphrase); err != nil {
+		return err
+	}
+	if err := wallets.SaveFile(cfg); err != nil {
+		return err
+	}
+
+	fmt.Println("Wallet encrypted, commands that sign need -passphrase from now on")
+
+	return nil
+}
+
+func (cli *CommandLine) walletPassphrase(cfg *config.Config, rpcAddr, passphrase string, timeout int) error {
+	auth, err := rpc.ReadCookie(cfg.CookiePath())
+	if err != nil {
+		return err
+	}
+	if err := rpc.Call(rpcAddr, auth, "walletpassphrase", []interface{}{passphrase, timeout}, nil); err != nil {
+		return err
+	}
 
-		for _, tx := range block.Transactions {
-			fmt.Println(tx)
+	fmt.Printf("Wallet of %s is unlocked for %d seconds\n", rpcAddr, timeout)
+
+	return nil
+}
+
+func (cli *CommandLine) walletLock(cfg *config.Config, rpcAddr string) error {
+	auth, err := rpc.ReadCookie(cfg.CookiePath())
+	if err != nil {
+		return err
+	}
+	if err := rpc.Call(rpcAddr, auth, "walletlock", nil, nil); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wallet of %s is locked\n", rpcAddr)
+
+	return nil
+}
+
+// unlockWallets unlocks encrypted wallets with the passphrase for the length of
+// a command, wallets that are not encrypted need no passphrase
+func unlockWallets(wallets *wallet.Wallets, passphrase string) error {
+	if !wallets.IsEncrypted() || passphrase == "" {
+		return nil
+	}
+
+	return wallets.Unlock(passphrase)
+}
+
+// walletSigner returns the external signer listening on socket, or the
+// wallets themselves when no socket is given
+func walletSigner(wallets *wallet.Wallets, socket string) (signer.Signer, error) {
+	if socket != "" {
+		return signer.NewRemoteSigner(socket), nil
+	}
+
+	return wallets.Signer()
+}
+
+
+func (cli *CommandLine) printChain(cfg *config.Config) error {
+	chain, err := blockchain.ContinueBlockChain(cfg)
+	if err != nil {
+		return err
+	}
+	defer chain.Database.Close()
+	iterator := chain.Iterator()
+
+	for {
+		block, err := iterator.Next()
+		if err != nil {
+			return err
 		}
-		fmt.Println()
+
+		printBlock(chain, block)
 
 		if len(block.PrevHash) == 0 {
 			break
 		}
 	}
+
+	return nil
 }
 
 
-func (cli *CommandLine) createBlockChain(address string) {
-	if !wallet.ValidateAddress(address) {
-		log.Panic("Address is not Valid")
+func (cli *CommandLine) getBlock(cfg *config.Config, height int) error {
+	chain, err := blockchain.ContinueBlockChain(cfg)
+	if err != nil {
+		return err
 	}
+	defer chain.Database.Close()
+
+	block, err := chain.GetBlockByHeight(height)
+	if err != nil {
+		return err
+	}
+	printBlock(chain, &block)
+
+	return nil
+}
+
+func (cli *CommandLine) getBlockHash(cfg *config.Config, height int) error {
+	chain, err := blockchain.ContinueBlockChain(cfg)
+	if err != nil {
+		return err
+	}
+	defer chain.Database.Close()
 
-	chain := blockchain.InitBlockChain(address)
-	chain.Database.Close()
+	blockHash, err := chain.GetBlockHash(height)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%x\n", blockHash)
+
+	return nil
+}
+
+func printBlock(chain *blockchain.BlockChain, block *blockchain.Block) {
+	fmt.Printf("Height: %d\n", block.Height)
+	fmt.Printf("Version: %d\n", block.Version)
+	fmt.Printf("Timestamp: %s\n", time.Unix(block.Timestamp, 0).Format(time.RFC3339))
+	fmt.Printf("Previous Hash: %x\n", block.PrevHash)
+	fmt.Printf("Merkle Root: %x\n", block.MerkleRoot)
+	fmt.Printf("Hash: %x\n", block.Hash)
+	fmt.Printf("Bits: %08x\n", block.Bits)
+	pow, err := chain.ExpectedProof(block)
+	fmt.Printf("PoW: %s\n", strconv.FormatBool(err == nil && pow.Validate()))
+
+	for _, tx := range block.Transactions {
+		fmt.Println(tx)
+	}
+	fmt.Println()
+}
+
+func (cli *CommandLine) createBlockChain(address string, cfg *config.Config) error {
+	if err := wallet.ValidateAddress(address, cfg.Params); err != nil {
+		return err
+	}
+
+	chain, err := blockchain.InitBlockChain(cfg)
+	if err != nil {
+		return err
+	}
+	defer chain.Database.Close()
 
 	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
-	UTXOSet.Reindex()
+	if err := UTXOSet.Reindex(); err != nil {
+		return err
+	}
+
+	// nobody can spend the genesis coinbase, the first block rewards address
+	cbtx, err := blockchain.CoinbaseTx(address, "", 1, 0, cfg.Params)
+	if err != nil {
+		return err
+	}
+	if _, err := chain.AddBlock([]*blockchain.Transaction{cbtx}); err != nil {
+		return err
+	}
 
 	fmt.Println("Finished!")
+
+	return nil
 }
 
 
-func (cli *CommandLine) getBalance(address string) {
-	if !wallet.ValidateAddress(address) {
-		log.Panic("Address is not Valid")
+func (cli *CommandLine) getBalance(address string, cfg *config.Config) error {
+	pkScript, err := wallet.AddressScript(address, cfg.Params)
+	if err != nil {
+		return err
 	}
 
-	chain := blockchain.ContinueBlockChain(address)
+	chain, err := blockchain.ContinueBlockChain(cfg)
+	if err != nil {
+		return err
+	}
 	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
 	defer chain.Database.Close()
 
 	balance := 0
-	pubKeyHash := wallet.Base58Decode([]byte(address))
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash) - 4]
-	UTXOs := UTXOSet.FindUTXO(pubKeyHash)
+	UTXOs, err := UTXOSet.FindUTXO(pkScript)
+	if err != nil {
+		return err
+	}
 
 	for _, out := range UTXOs {
 		balance += out.Value
 	}
 
 	fmt.Printf("Balance of %s: %d\n", address, balance)
+
+	return nil
 }
 
 
-func (cli *CommandLine) send(from, to string, amount int) {
-	if !wallet.ValidateAddress(to) {
-		log.Panic("Address is not Valid")
+func (cli *CommandLine) send(from, to string, amount, fee int, cfg *config.Config, mineNow bool, passphrase string,
+	lockTime uint, socket string) error {
+	if err := wallet.ValidateAddress(to, cfg.Params); err != nil {
+		return err
+	}
+	if err := wallet.ValidateAddress(from, cfg.Params); err != nil {
+		return err
 	}
-	if !wallet.ValidateAddress(from) {
-		log.Panic("Address is not Valid")
+	chain, err := blockchain.ContinueBlockChain(cfg)
+	if err != nil {
+		return err
 	}
-	chain := blockchain.ContinueBlockChain(from)
 	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
 	defer chain.Database.Close()
 
-	tx := blockchain.NewTransaction(from, to, amount, &UTXOSet)
-	block := chain.AddBlock([]*blockchain.Transaction{tx})
-	UTXOSet.Update(block)
+	wallets, err := wallet.CreateWallets(cfg)
+	if err != nil {
+		return err
+	}
+	if err := unlockWallets(wallets, passphrase); err != nil {
+		return err
+	}
+	w, err := wallets.GetWallet(from)
+	if err != nil {
+		return err
+	}
+	keys, err := walletSigner(wallets, socket)
+	if err != nil {
+		return err
+	}
+
+	tx, err := blockchain.NewTransaction(keys, w.PublicKey, to, amount, fee, uint32(lockTime), &UTXOSet)
+	if err != nil {
+		return err
+	}
+	if mineNow {
+		height, err := chain.GetBestHeight()
+		if err != nil {
+			return err
+		}
+		cbTx, err := blockchain.CoinbaseTx(from, "", height+1, fee, cfg.Params)
+		if err != nil {
+			return err
+		}
+		if _, err := chain.AddBlock([]*blockchain.Transaction{cbTx, tx}); err != nil {
+			return err
+		}
+	} else {
+		if err := network.SendTx(network.KnownNodes[0], tx, cfg.Params); err != nil {
+			return err
+		}
+		fmt.Println("Sent transaction to the mempool of", network.KnownNodes[0])
+	}
 	fmt.Println("Success!")
+
+	return nil
+}
+
+// exitOnError prints the error and ends the process, the library only returns
+// errors so this is the one place a failed command stops the program
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		os.Exit(1)
+	}
 }
 
 // Run method to run the command line interface
 func (cli *CommandLine) Run() {
 	cli.validateArgs()
 
+	nodeID := os.Getenv("NODE_ID")
+
 	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
 	createBlockchainCmd := flag.NewFlagSet("createblockchain", flag.ExitOnError)
 	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
@@ -154,46 +719,152 @@ func (cli *CommandLine) Run() {
 	createWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)
 	listAddressesCmd := flag.NewFlagSet("listaddresses", flag.ExitOnError)
 	reindexUTXOCmd := flag.NewFlagSet("reindexutxo", flag.ExitOnError)
+	reindexTxCmd := flag.NewFlagSet("reindextx", flag.ExitOnError)
+	getBlockCmd := flag.NewFlagSet("getblock", flag.ExitOnError)
+	getBlockHashCmd := flag.NewFlagSet("getblockhash", flag.ExitOnError)
+	startNodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)
+	rollbackCmd := flag.NewFlagSet("rollback", flag.ExitOnError)
+	supplyCmd := flag.NewFlagSet("supply", flag.ExitOnError)
+	restoreWalletCmd := flag.NewFlagSet("restorewallet", flag.ExitOnError)
+	createMultiSigCmd := flag.NewFlagSet("createmultisig", flag.ExitOnError)
+	signPartialCmd := flag.NewFlagSet("signpartial", flag.ExitOnError)
+	combineCmd := flag.NewFlagSet("combine", flag.ExitOnError)
+	encryptWalletCmd := flag.NewFlagSet("encryptwallet", flag.ExitOnError)
+	walletPassphraseCmd := flag.NewFlagSet("walletpassphrase", flag.ExitOnError)
+	walletLockCmd := flag.NewFlagSet("walletlock", flag.ExitOnError)
+	startSignerCmd := flag.NewFlagSet("startsigner", flag.ExitOnError)
 
 	getBalanceAddress := getBalanceCmd.String("address", "", "The address to get balance for")
 	createBlockchainAddress := createBlockchainCmd.String("address", "", "The address to send genesis block reward to")
 	sendFrom := sendCmd.String("from", "", "source wallet address")
 	sendTo := sendCmd.String("to", "", "Destination wallet address")
 	sendAmount := sendCmd.Int("amount", 0, "Amount to send")
+	sendFee := sendCmd.Int("fee", blockchain.MinRelayFee, "Fee to pay the miner")
+	sendMine := sendCmd.Bool("mine", false, "Mine immediately on the same node")
+	sendPassphrase := sendCmd.String("passphrase", "", "Passphrase of an encrypted wallet")
+	sendLockTime := sendCmd.Uint("locktime", 0, "Block height or unix time the transaction is locked until")
+	sendSigner := sendCmd.String("signer", "", "Unix socket of the external signer holding the key")
+	createWalletPassphrase := createWalletCmd.String("passphrase", "", "Passphrase of an encrypted wallet")
+	createWalletMnemonic := createWalletCmd.Bool("mnemonic", false, "Derive new wallets from a new seed phrase")
+	restoreWalletMnemonic := restoreWalletCmd.String("mnemonic", "", "Seed phrase to restore the wallets from")
+	restoreWalletCount := restoreWalletCmd.Int("count", 20, "Number of addresses to restore")
+	restoreWalletPassphrase := restoreWalletCmd.String("passphrase", "", "Passphrase of an encrypted wallet")
+	startNodePort := startNodeCmd.String("port", nodeID, "Port the node listens on")
+	startNodeMiner := startNodeCmd.String("miner", "", "Enable mining mode and send reward to ADDRESS")
+	startNodeRPC := startNodeCmd.String("rpc", "", "Address to serve JSON-RPC on, for example localhost:8332")
+	startNodeSigner := startNodeCmd.String("signer", "", "Unix socket of the external signer holding the keys")
+	rollbackBlocks := rollbackCmd.Int("blocks", 0, "Number of blocks to take off the chain")
+	getBlockHeight := getBlockCmd.Int("height", -1, "Height of the block on the main chain")
+	getBlockHashHeight := getBlockHashCmd.Int("height", -1, "Height of the block on the main chain")
+	reindexTxDrop := reindexTxCmd.Bool("drop", false, "Delete the transaction index instead of building it")
+	listAddressesPubKeys := listAddressesCmd.Bool("pubkeys", false, "Show the public key of every address")
+	createMultiSigRequired := createMultiSigCmd.Int("required", 0, "Number of signatures the address needs")
+	createMultiSigKeys := createMultiSigCmd.String("keys", "", "Comma separated hex public keys or addresses in the wallet file")
+	signPartialTx := signPartialCmd.String("tx", "", "File of the multisig transaction")
+	signPartialFrom := signPartialCmd.String("from", "", "Multisig address to create the transaction from")
+	signPartialTo := signPartialCmd.String("to", "", "Destination wallet address of a new transaction")
+	signPartialAmount := signPartialCmd.Int("amount", 0, "Amount to send in a new transaction")
+	signPartialFee := signPartialCmd.Int("fee", blockchain.MinRelayFee, "Fee to pay the miner in a new transaction")
+	signPartialPassphrase := signPartialCmd.String("passphrase", "", "Passphrase of an encrypted wallet")
+	signPartialSigner := signPartialCmd.String("signer", "", "Unix socket of the external signer holding the keys")
+	combineIn := combineCmd.String("in", "", "Comma separated files of the signed copies of a transaction")
+	combineOut := combineCmd.String("out", "", "File to write the combined transaction to")
+	combineSend := combineCmd.Bool("send", false, "Send the transaction to the central node when it is fully signed")
+	encryptWalletPassphrase := encryptWalletCmd.String("passphrase", "", "Passphrase to encrypt the wallet with")
+	walletPassphrasePassphrase := walletPassphraseCmd.String("passphrase", "", "Passphrase of the encrypted wallet")
+	walletPassphraseTimeout := walletPassphraseCmd.Int("timeout", 60, "Seconds the wallet stays unlocked")
+	walletPassphraseRPC := walletPassphraseCmd.String("rpc", "localhost:8332", "Address of the JSON-RPC server")
+	walletLockRPC := walletLockCmd.String("rpc", "localhost:8332", "Address of the JSON-RPC server")
+	startSignerSocket := startSignerCmd.String("socket", "", "Unix socket the signer listens on")
+	startSignerPassphrase := startSignerCmd.String("passphrase", "", "Passphrase of an encrypted wallet")
+
+	var dataDir, networkName string
+	for _, cmd := range []*flag.FlagSet{getBalanceCmd, createBlockchainCmd, sendCmd, printChainCmd, createWalletCmd,
+		listAddressesCmd, reindexUTXOCmd, startNodeCmd, rollbackCmd, restoreWalletCmd,
+		createMultiSigCmd, signPartialCmd, combineCmd, encryptWalletCmd, walletPassphraseCmd, walletLockCmd, supplyCmd,
+		startSignerCmd, reindexTxCmd, getBlockCmd, getBlockHashCmd} {
+		cmd.StringVar(&dataDir, "datadir", "", fmt.Sprintf("Directory for the chain and wallets (defaults to $%s or %s)", config.DataDirEnv, config.DefaultDataDir))
+		cmd.StringVar(&networkName, "network", params.MainNet.Name, "Network to use: mainnet, testnet or regtest")
+	}
 
 	switch os.Args[1] {
 	case "getbalance":
 		err := getBalanceCmd.Parse(os.Args[2:])
-		blockchain.Handle(err)
+		exitOnError(err)
 	case "reindexutxo":
 		err := reindexUTXOCmd.Parse(os.Args[2:])
-		blockchain.Handle(err)
+		exitOnError(err)
+	case "reindextx":
+		err := reindexTxCmd.Parse(os.Args[2:])
+		exitOnError(err)
 	case "createblockchain":
 		err := createBlockchainCmd.Parse(os.Args[2:])
-		blockchain.Handle(err)
+		exitOnError(err)
 	case "listaddresses":
 		err := listAddressesCmd.Parse(os.Args[2:])
-		blockchain.Handle(err)
+		exitOnError(err)
 	case "createwallet":
 		err := createWalletCmd.Parse(os.Args[2:])
-		blockchain.Handle(err)
+		exitOnError(err)
 	case "printchain":
 		err := printChainCmd.Parse(os.Args[2:])
-		blockchain.Handle(err)
+		exitOnError(err)
+	case "getblock":
+		err := getBlockCmd.Parse(os.Args[2:])
+		exitOnError(err)
+	case "getblockhash":
+		err := getBlockHashCmd.Parse(os.Args[2:])
+		exitOnError(err)
 	case "send":
 		err := sendCmd.Parse(os.Args[2:])
-		blockchain.Handle(err)
+		exitOnError(err)
+	case "startnode":
+		err := startNodeCmd.Parse(os.Args[2:])
+		exitOnError(err)
+	case "rollback":
+		err := rollbackCmd.Parse(os.Args[2:])
+		exitOnError(err)
+	case "supply":
+		err := supplyCmd.Parse(os.Args[2:])
+		exitOnError(err)
+	case "restorewallet":
+		err := restoreWalletCmd.Parse(os.Args[2:])
+		exitOnError(err)
+	case "createmultisig":
+		err := createMultiSigCmd.Parse(os.Args[2:])
+		exitOnError(err)
+	case "signpartial":
+		err := signPartialCmd.Parse(os.Args[2:])
+		exitOnError(err)
+	case "combine":
+		err := combineCmd.Parse(os.Args[2:])
+		exitOnError(err)
+	case "encryptwallet":
+		err := encryptWalletCmd.Parse(os.Args[2:])
+		exitOnError(err)
+	case "walletpassphrase":
+		err := walletPassphraseCmd.Parse(os.Args[2:])
+		exitOnError(err)
+	case "walletlock":
+		err := walletLockCmd.Parse(os.Args[2:])
+		exitOnError(err)
+	case "startsigner":
+		err := startSignerCmd.Parse(os.Args[2:])
+		exitOnError(err)
 	default:
 		cli.printUsage()
 		runtime.Goexit()
 	}
 
+	cfg, err := config.New(dataDir, nodeID, networkName)
+	exitOnError(err)
+
 	if getBalanceCmd.Parsed() {
 		if *getBalanceAddress == "" {
 			getBalanceCmd.Usage()
 			runtime.Goexit()
 		}
-		cli.getBalance(*getBalanceAddress)
+		exitOnError(cli.getBalance(*getBalanceAddress, cfg))
 	}
 
 	if createBlockchainCmd.Parsed() {
@@ -201,30 +872,137 @@ func (cli *CommandLine) Run() {
 			createBlockchainCmd.Usage()
 			runtime.Goexit()
 		}
-		cli.createBlockChain(*createBlockchainAddress)
+		exitOnError(cli.createBlockChain(*createBlockchainAddress, cfg))
 	}
 
 	if printChainCmd.Parsed() {
-		cli.printChain()
+		exitOnError(cli.printChain(cfg))
+	}
+
+	if getBlockCmd.Parsed() {
+		if *getBlockHeight < 0 {
+			getBlockCmd.Usage()
+			runtime.Goexit()
+		}
+		exitOnError(cli.getBlock(cfg, *getBlockHeight))
+	}
+
+	if getBlockHashCmd.Parsed() {
+		if *getBlockHashHeight < 0 {
+			getBlockHashCmd.Usage()
+			runtime.Goexit()
+		}
+		exitOnError(cli.getBlockHash(cfg, *getBlockHashHeight))
 	}
 
 	if listAddressesCmd.Parsed() {
-		cli.listaddresses()
+		exitOnError(cli.listaddresses(cfg, *listAddressesPubKeys))
 	}
 
 	if createWalletCmd.Parsed() {
-		cli.createWallet()
+		exitOnError(cli.createWallet(cfg, *createWalletPassphrase, *createWalletMnemonic))
+	}
+
+	if restoreWalletCmd.Parsed() {
+		if *restoreWalletMnemonic == "" || *restoreWalletCount <= 0 {
+			restoreWalletCmd.Usage()
+			runtime.Goexit()
+		}
+		exitOnError(cli.restoreWallet(cfg, *restoreWalletMnemonic, *restoreWalletCount, *restoreWalletPassphrase))
 	}
 
 	if reindexUTXOCmd.Parsed() {
-		cli.reindexUTXO()
+		exitOnError(cli.reindexUTXO(cfg))
+	}
+
+	if reindexTxCmd.Parsed() {
+		exitOnError(cli.reindexTx(cfg, *reindexTxDrop))
 	}
 
 	if sendCmd.Parsed() {
-		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 {
+		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 || *sendFee < 0 || *sendLockTime > math.MaxUint32 {
 			sendCmd.Usage()
 			runtime.Goexit()
 		}
-		cli.send(*sendFrom, *sendTo, *sendAmount)
+		exitOnError(cli.send(*sendFrom, *sendTo, *sendAmount, *sendFee, cfg, *sendMine, *sendPassphrase, *sendLockTime,
+			*sendSigner))
+	}
+
+	if supplyCmd.Parsed() {
+		exitOnError(cli.supply(cfg))
+	}
+
+	if rollbackCmd.Parsed() {
+		if *rollbackBlocks <= 0 {
+			rollbackCmd.Usage()
+			runtime.Goexit()
+		}
+		exitOnError(cli.rollback(*rollbackBlocks, cfg))
+	}
+
+	if startNodeCmd.Parsed() {
+		if *startNodePort == "" {
+			startNodeCmd.Usage()
+			runtime.Goexit()
+		}
+		exitOnError(cli.startNode(cfg, *startNodePort, *startNodeMiner, *startNodeRPC, *startNodeSigner))
+	}
+
+	if createMultiSigCmd.Parsed() {
+		if *createMultiSigRequired <= 0 || *createMultiSigKeys == "" {
+			createMultiSigCmd.Usage()
+			runtime.Goexit()
+		}
+		exitOnError(cli.createMultiSig(cfg, *createMultiSigRequired, strings.Split(*createMultiSigKeys, ",")))
+	}
+
+	if signPartialCmd.Parsed() {
+		if *signPartialTx == "" || *signPartialFee < 0 ||
+			(*signPartialFrom != "" && (*signPartialTo == "" || *signPartialAmount <= 0)) {
+			signPartialCmd.Usage()
+			runtime.Goexit()
+		}
+		exitOnError(cli.signPartial(cfg, *signPartialTx, *signPartialFrom, *signPartialTo, *signPartialAmount,
+			*signPartialFee, *signPartialPassphrase, *signPartialSigner))
+	}
+
+	if combineCmd.Parsed() {
+		if *combineIn == "" {
+			combineCmd.Usage()
+			runtime.Goexit()
+		}
+		exitOnError(cli.combine(cfg, strings.Split(*combineIn, ","), *combineOut, *combineSend))
+	}
+
+	if encryptWalletCmd.Parsed() {
+		if *encryptWalletPassphrase == "" {
+			encryptWalletCmd.Usage()
+			runtime.Goexit()
+		}
+		exitOnError(cli.encryptWallet(cfg, *encryptWalletPassphrase))
+	}
+
+	if walletPassphraseCmd.Parsed() {
+		if *walletPassphrasePassphrase == "" || *walletPassphraseTimeout <= 0 || *walletPassphraseRPC == "" {
+			walletPassphraseCmd.Usage()
+			runtime.Goexit()
+		}
+		exitOnError(cli.walletPassphrase(cfg, *walletPassphraseRPC, *walletPassphrasePassphrase, *walletPassphraseTimeout))
+	}
+
+	if walletLockCmd.Parsed() {
+		if *walletLockRPC == "" {
+			walletLockCmd.Usage()
+			runtime.Goexit()
+		}
+		exitOnError(cli.walletLock(cfg, *walletLockRPC))
+	}
+
+	if startSignerCmd.Parsed() {
+		if *startSignerSocket == "" {
+			startSignerCmd.Usage()
+			runtime.Goexit()
+		}
+		exitOnError(cli.startSigner(cfg, *startSignerSocket, *startSignerPassphrase))
 	}
 }
\ No newline at end of file
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/shortdaddy0711/golang-blockchain/params"
+)
+
+const (
+	// DefaultDataDir is the data directory used when none is given
+	DefaultDataDir = "./tmp"
+	// DataDirEnv is the environment variable that sets the data directory
+	DataDirEnv = "BLOCKCHAIN_DATADIR"
+
+	blocksDir  = "blocks"
+	walletFile = "wallets"
+	cookieFile = ".cookie"
+)
+
+// Config structure that tells a node instance which network it is on and
+// where to keep its chain and wallets, nodes sharing a data directory are
+// kept apart by their id
+type Config struct {
+	DataDir string
+	NodeID  string
+	Params  *params.ChainParams
+}
+
+// New function to make a config for the named network, an empty dataDir falls
+// back to the environment and then to DefaultDataDir, networks other than
+// mainnet keep their data in a subdirectory named after the network
+func New(dataDir, nodeID, network string) (*Config, error) {
+	p, err := params.ByName(network)
+	if err != nil {
+		return nil, err
+	}
+
+	if dataDir == "" {
+		dataDir = os.Getenv(DataDirEnv)
+	}
+	if dataDir == "" {
+		dataDir = DefaultDataDir
+	}
+	if p != &params.MainNet {
+		dataDir = filepath.Join(dataDir, p.Name)
+	}
+
+	return &Config{dataDir, nodeID, p}, nil
+}
+
+// BlocksPath method that returns the database directory of the chain
+func (c *Config) BlocksPath() string {
+	return filepath.Join(c.DataDir, c.withNodeID(blocksDir))
+}
+
+// WalletPath method that returns the file the wallets are saved in
+func (c *Config) WalletPath() string {
+	return filepath.Join(c.DataDir, c.withNodeID(walletFile)+".data")
+}
+
+// CookiePath method that returns the file holding the credentials of the
+// JSON-RPC server while it runs
+func (c *Config) CookiePath() string {
+	return filepath.Join(c.DataDir, c.withNodeID(cookieFile))
+}
+
+// EnsureDataDir method to create the data directory when it does not exist yet
+func (c *Config) EnsureDataDir() error {
+	return os.MkdirAll(c.DataDir, 0700)
+}
+
+func (c *Config) withNodeID(name string) string {
+	if c.NodeID == "" {
+		return name
+	}
+	return fmt.Sprintf("%s_%s", name, c.NodeID)
+}
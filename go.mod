@@ -5,5 +5,6 @@ go 1.16
 require (
 	github.com/dgraph-io/badger/v2 v2.2007.2
 	github.com/mr-tron/base58 v1.2.0
-	golang.org/x/crypto v0.0.0-20190308221718-c2843e01d9a2
+	github.com/tyler-smith/go-bip39 v1.1.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 )
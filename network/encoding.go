@@ -0,0 +1,138 @@
+package network
+
+import (
+	"github.com/shortdaddy0711/golang-blockchain/blockchain"
+)
+
+// A message is the network magic, the command padded with zero bytes to
+// commandLength and the payload. Payloads are records in the format of
+// blockchain.EncodingVersion, a string is encoded as bytes.
+//
+//	addr:      version, list of strings that each hold a node address
+//	block:     version, string sender, bytes encoded block
+//	getblocks: version, string sender
+//	getdata:   version, string sender, string kind, bytes id
+//	inv:       version, string sender, string kind, list of bytes ids
+//	tx:        version, string sender, bytes encoded transaction
+//	version:   version, i64 protocol version, bytes genesis hash, i64 best
+//	           height, string sender
+
+// payload is the part of a message after the command
+type payload interface {
+	encode(e *blockchain.Encoder)
+	decode(d *blockchain.Decoder)
+}
+
+// encodePayload function to encode the payload of a message
+func encodePayload(p payload) []byte {
+	e := blockchain.NewEncoder()
+	p.encode(e)
+
+	return e.Data()
+}
+
+// decodePayload function to decode the payload of a request into p
+func decodePayload(request []byte, p payload) error {
+	d := blockchain.NewDecoder(request[headerLength:])
+	p.decode(d)
+
+	return d.Finish()
+}
+
+func encodeList(e *blockchain.Encoder, items [][]byte) {
+	e.Uint32(uint32(len(items)))
+	for _, item := range items {
+		e.Bytes(item)
+	}
+}
+
+func decodeList(d *blockchain.Decoder) [][]byte {
+	var items [][]byte
+
+	count := d.Count(4)
+	for i := 0; i < count; i++ {
+		items = append(items, d.Bytes())
+	}
+
+	return items
+}
+
+func (m *Addr) encode(e *blockchain.Encoder) {
+	var list [][]byte
+	for _, addr := range m.AddrList {
+		list = append(list, []byte(addr))
+	}
+	encodeList(e, list)
+}
+
+func (m *Addr) decode(d *blockchain.Decoder) {
+	for _, addr := range decodeList(d) {
+		m.AddrList = append(m.AddrList, string(addr))
+	}
+}
+
+func (m *Block) encode(e *blockchain.Encoder) {
+	e.Bytes([]byte(m.AddrFrom))
+	e.Bytes(m.Block)
+}
+
+func (m *Block) decode(d *blockchain.Decoder) {
+	m.AddrFrom = string(d.Bytes())
+	m.Block = d.Bytes()
+}
+
+func (m *GetBlocks) encode(e *blockchain.Encoder) {
+	e.Bytes([]byte(m.AddrFrom))
+}
+
+func (m *GetBlocks) decode(d *blockchain.Decoder) {
+	m.AddrFrom = string(d.Bytes())
+}
+
+func (m *GetData) encode(e *blockchain.Encoder) {
+	e.Bytes([]byte(m.AddrFrom))
+	e.Bytes([]byte(m.Type))
+	e.Bytes(m.ID)
+}
+
+func (m *GetData) decode(d *blockchain.Decoder) {
+	m.AddrFrom = string(d.Bytes())
+	m.Type = string(d.Bytes())
+	m.ID = d.Bytes()
+}
+
+func (m *Inv) encode(e *blockchain.Encoder) {
+	e.Bytes([]byte(m.AddrFrom))
+	e.Bytes([]byte(m.Type))
+	encodeList(e, m.Items)
+}
+
+func (m *Inv) decode(d *blockchain.Decoder) {
+	m.AddrFrom = string(d.Bytes())
+	m.Type = string(d.Bytes())
+	m.Items = decodeList(d)
+}
+
+func (m *Tx) encode(e *blockchain.Encoder) {
+	e.Bytes([]byte(m.AddrFrom))
+	e.Bytes(m.Transaction)
+}
+
+func (m *Tx) decode(d *blockchain.Decoder) {
+	m.AddrFrom = string(d.Bytes())
+	m.Transaction = d.Bytes()
+}
+
+func (m *Version) encode(e *blockchain.Encoder) {
+	e.Int64(int64(m.Version))
+	e.Bytes(m.GenesisHash)
+	e.Int64(int64(m.BestHeight))
+	e.Bytes([]byte(m.AddrFrom))
+}
+
+func (m *Version) decode(d *blockchain.Decoder) {
+	m.Version = int(d.Int64())
+	m.GenesisHash = d.Bytes()
+	m.BestHeight = int(d.Int64())
+	m.AddrFrom = string(d.Bytes())
+}
@@ -0,0 +1,720 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/shortdaddy0711/golang-blockchain/blockchain"
+	"github.com/shortdaddy0711/golang-blockchain/config"
+	"github.com/shortdaddy0711/golang-blockchain/params"
+	"github.com/shortdaddy0711/golang-blockchain/rpc"
+	"github.com/shortdaddy0711/golang-blockchain/signer"
+	"github.com/shortdaddy0711/golang-blockchain/wallet"
+)
+
+const (
+	protocol      = "tcp"
+	version       = 2
+	magicLength   = 4
+	commandLength = 12
+	headerLength  = magicLength + commandLength
+
+	// maxBlockTransactions is the number of mempool transactions a miner packs into one block
+	maxBlockTransactions = 100
+	// mineInterval is how often a miner checks the mempool for pending transactions
+	mineInterval = 10 * time.Second
+	// maxMessageSize is the largest message a node reads from a peer
+	maxMessageSize = 32 << 20
+	// readTimeout is how long a peer has to send its whole message
+	readTimeout = 30 * time.Second
+)
+
+// KnownNodes variable, the first node is the central node every other node syncs with
+var KnownNodes = []string{"localhost:3000"}
+
+// Addr message to share known node addresses
+type Addr struct {
+	AddrList []string
+}
+
+// Block message to send a serialized block
+type Block struct {
+	AddrFrom string
+	Block    []byte
+}
+
+// GetBlocks message to ask for the hashes of a node's chain
+type GetBlocks struct {
+	AddrFrom string
+}
+
+// GetData message to ask for a single block or transaction
+type GetData struct {
+	AddrFrom string
+	Type     string
+	ID       []byte
+}
+
+// Inv message to announce blocks or transactions a node has
+type Inv struct {
+	AddrFrom string
+	Type     string
+	Items    [][]byte
+}
+
+// Tx message to send a serialized transaction
+type Tx struct {
+	AddrFrom    string
+	Transaction []byte
+}
+
+// Version message to exchange protocol version and chain height
+type Version struct {
+	Version     int
+	GenesisHash []byte
+	BestHeight  int
+	AddrFrom    string
+}
+
+// Server structure that holds the state of a running node
+type Server struct {
+	Address         string
+	MinerAddress    string
+	KnownNodes      []string
+	Chain           *blockchain.BlockChain
+	Mempool         *blockchain.Mempool
+	blocksInTransit [][]byte
+	mu              sync.Mutex
+}
+
+// CmdToBytes function to convert a command into a fixed length byte slice
+func CmdToBytes(cmd string) []byte {
+	var bytes [commandLength]byte
+
+	for i, c := range cmd {
+		bytes[i] = byte(c)
+	}
+
+	return bytes[:]
+}
+
+// BytesToCmd function to read the command back from the fixed length byte slice
+func BytesToCmd(bytes []byte) string {
+	var cmd []byte
+
+	for _, b := range bytes {
+		if b != 0x0 {
+			cmd = append(cmd, b)
+		}
+	}
+
+	return fmt.Sprintf("%s", cmd)
+}
+
+// NewMessage function to build a request from the network magic, the command
+// and the encoded payload
+func NewMessage(magic [magicLength]byte, cmd string, payload []byte) []byte {
+	request := append(magic[:], CmdToBytes(cmd)...)
+
+	return append(request, payload...)
+}
+
+// ExtractMagic function that returns the network magic of a request
+func ExtractMagic(request []byte) []byte {
+	return request[:magicLength]
+}
+
+// ExtractCmd function that returns the command part of a request
+func ExtractCmd(request []byte) []byte {
+	return request[magicLength:headerLength]
+}
+
+// SendTx function to send a transaction to a node of the network from outside it
+func SendTx(addr string, tx *blockchain.Transaction, p *params.ChainParams) error {
+	data := Tx{"", tx.Serialize()}
+	payload := encodePayload(&data)
+	request := NewMessage(p.Magic, "tx", payload)
+
+	return sendRequest(addr, request)
+}
+
+func (s *Server) isKnown(addr string) bool {
+	for _, node := range s.KnownNodes {
+		if node == addr {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) addKnown(addr string) {
+	if addr != "" && addr != s.Address && !s.isKnown(addr) {
+		s.KnownNodes = append(s.KnownNodes, addr)
+	}
+}
+
+func (s *Server) removeKnown(addr string) {
+	var nodes []string
+
+	for _, node := range s.KnownNodes {
+		if node != addr {
+			nodes = append(nodes, node)
+		}
+	}
+
+	s.KnownNodes = nodes
+}
+
+func (s *Server) sendData(addr string, data []byte) {
+	if err := sendRequest(addr, data); err != nil {
+		fmt.Printf("%s is not available\n", addr)
+		s.removeKnown(addr)
+	}
+}
+
+func sendRequest(addr string, data []byte) error {
+	conn, err := net.Dial(protocol, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = io.Copy(conn, bytes.NewReader(data))
+
+	return err
+}
+
+func (s *Server) sendAddr(addr string) {
+	nodes := Addr{append(s.KnownNodes, s.Address)}
+	payload := encodePayload(&nodes)
+	request := NewMessage(s.Chain.Params.Magic, "addr", payload)
+
+	s.sendData(addr, request)
+}
+
+func (s *Server) sendBlock(addr string, b *blockchain.Block) {
+	data := Block{s.Address, b.Serialize()}
+	payload := encodePayload(&data)
+	request := NewMessage(s.Chain.Params.Magic, "block", payload)
+
+	s.sendData(addr, request)
+}
+
+func (s *Server) sendInv(addr, kind string, items [][]byte) {
+	inventory := Inv{s.Address, kind, items}
+	payload := encodePayload(&inventory)
+	request := NewMessage(s.Chain.Params.Magic, "inv", payload)
+
+	s.sendData(addr, request)
+}
+
+func (s *Server) sendTx(addr string, tx *blockchain.Transaction) {
+	data := Tx{s.Address, tx.Serialize()}
+	payload := encodePayload(&data)
+	request := NewMessage(s.Chain.Params.Magic, "tx", payload)
+
+	s.sendData(addr, request)
+}
+
+func (s *Server) sendGetBlocks(addr string) {
+	payload := encodePayload(&GetBlocks{s.Address})
+	request := NewMessage(s.Chain.Params.Magic, "getblocks", payload)
+
+	s.sendData(addr, request)
+}
+
+func (s *Server) sendGetData(addr, kind string, id []byte) {
+	payload := encodePayload(&GetData{s.Address, kind, id})
+	request := NewMessage(s.Chain.Params.Magic, "getdata", payload)
+
+	s.sendData(addr, request)
+}
+
+func (s *Server) sendVersion(addr string) {
+	bestHeight, err := s.Chain.GetBestHeight()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	payload := encodePayload(&Version{version, s.Chain.Params.GenesisHash, bestHeight, s.Address})
+	request := NewMessage(s.Chain.Params.Magic, "version", payload)
+
+	s.sendData(addr, request)
+}
+
+func (s *Server) handleAddr(request []byte) {
+	var payload Addr
+	if err := decodePayload(request, &payload); err != nil {
+		log.Println(err)
+		return
+	}
+
+	for _, addr := range payload.AddrList {
+		s.addKnown(addr)
+	}
+	fmt.Printf("there are %d known nodes\n", len(s.KnownNodes))
+}
+
+func (s *Server) handleBlock(request []byte) {
+	var payload Block
+	if err := decodePayload(request, &payload); err != nil {
+		log.Println(err)
+		return
+	}
+
+	block, err := blockchain.DeserializeBlock(payload.Block)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	fmt.Printf("Received block %x\n", block.Hash)
+
+	update, err := s.Chain.ImportBlock(block)
+	if errors.Is(err, blockchain.ErrOrphanBlock) {
+		// we are missing the parent, ask the sender for its whole chain
+		s.blocksInTransit = nil
+		s.sendGetBlocks(payload.AddrFrom)
+		return
+	}
+	if err != nil {
+		fmt.Printf("Rejected block: %s\n", err)
+		s.blocksInTransit = nil
+		return
+	}
+	fmt.Printf("Added block %x\n", block.Hash)
+
+	s.updateMempool(update)
+
+	if len(s.blocksInTransit) > 0 {
+		blockHash := s.blocksInTransit[0]
+		s.sendGetData(payload.AddrFrom, "block", blockHash)
+
+		s.blocksInTransit = s.blocksInTransit[1:]
+	}
+}
+
+func (s *Server) handleInv(request []byte) {
+	var payload Inv
+	if err := decodePayload(request, &payload); err != nil {
+		log.Println(err)
+		return
+	}
+
+	fmt.Printf("Received inventory with %d %s\n", len(payload.Items), payload.Type)
+	if len(payload.Items) == 0 {
+		return
+	}
+
+	if payload.Type == "block" {
+		// items arrive from genesis to tip, only ask for the ones we miss
+		var missing [][]byte
+		for _, blockHash := range payload.Items {
+			stored, err := s.Chain.HasBlock(blockHash)
+			if err != nil {
+				log.Println(err)
+				return
+			}
+			if !stored {
+				missing = append(missing, blockHash)
+			}
+		}
+		if len(missing) == 0 {
+			return
+		}
+
+		s.blocksInTransit = missing[1:]
+		s.sendGetData(payload.AddrFrom, "block", missing[0])
+	}
+
+	if payload.Type == "tx" {
+		txID := payload.Items[0]
+
+		if !s.Mempool.Has(txID) {
+			s.sendGetData(payload.AddrFrom, "tx", txID)
+		}
+	}
+}
+
+func (s *Server) handleGetBlocks(request []byte) {
+	var payload GetBlocks
+	if err := decodePayload(request, &payload); err != nil {
+		log.Println(err)
+		return
+	}
+
+	blocks, err := s.Chain.GetBlockHashes()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	s.sendInv(payload.AddrFrom, "block", blocks)
+}
+
+func (s *Server) handleGetData(request []byte) {
+	var payload GetData
+	if err := decodePayload(request, &payload); err != nil {
+		log.Println(err)
+		return
+	}
+
+	if payload.Type == "block" {
+		block, err := s.Chain.GetBlock(payload.ID)
+		if err != nil {
+			return
+		}
+
+		s.sendBlock(payload.AddrFrom, &block)
+	}
+
+	if payload.Type == "tx" {
+		tx, ok := s.Mempool.Get(payload.ID)
+		if !ok {
+			return
+		}
+
+		s.sendTx(payload.AddrFrom, tx)
+	}
+}
+
+func (s *Server) handleTx(request []byte) {
+	var payload Tx
+	if err := decodePayload(request, &payload); err != nil {
+		log.Println(err)
+		return
+	}
+
+	tx, err := blockchain.DeserializeTransaction(payload.Transaction)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if err := s.acceptTx(&tx, payload.AddrFrom); err != nil {
+		fmt.Printf("Rejected transaction %x: %s\n", tx.ID, err)
+	}
+}
+
+// acceptTx puts a transaction into the mempool and announces it to the known
+// nodes but the one it came from, a full mempool is mined right away
+func (s *Server) acceptTx(tx *blockchain.Transaction, from string) error {
+	if err := s.Mempool.Add(tx); err != nil {
+		return err
+	}
+	fmt.Printf("%s, %d transactions in the mempool\n", s.Address, s.Mempool.Count())
+
+	if s.MinerAddress != "" && s.Mempool.Count() >= maxBlockTransactions {
+		s.mineBlock()
+	}
+
+	for _, node := range s.KnownNodes {
+		if node != s.Address && node != from {
+			s.sendInv(node, "tx", [][]byte{tx.ID})
+		}
+	}
+
+	return nil
+}
+
+// startRPC serves JSON-RPC on the node's chain and mempool, calls hold the
+// node lock like the peer handlers do and need the credentials written to the
+// cookie file
+func (s *Server) startRPC(cfg *config.Config, rpcCfg *RPCConfig) (*http.Server, error) {
+	wallets, err := wallet.CreateWallets(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	relay := func(tx *blockchain.Transaction) error {
+		return s.acceptTx(tx, "")
+	}
+	rpcServer := rpc.NewServer(cfg, s.Chain, wallets, relay)
+	rpcServer.Signer = rpcCfg.Signer
+	rpcServer.Locker = &s.mu
+	if rpcServer.Auth, err = rpc.WriteCookie(cfg.CookiePath()); err != nil {
+		return nil, err
+	}
+
+	httpServer, err := rpc.Listen(rpcCfg.Listen, rpcServer)
+	if err != nil {
+		os.Remove(cfg.CookiePath())
+		return nil, err
+	}
+	fmt.Printf("Serving JSON-RPC on http://%s, credentials are in %s\n", rpcCfg.Listen, cfg.CookiePath())
+
+	return httpServer, nil
+}
+
+// updateMempool drops the transactions the main chain now contains and
+// gives the ones from disconnected blocks another chance
+func (s *Server) updateMempool(update *blockchain.ChainUpdate) {
+	for _, block := range update.Connected {
+		s.Mempool.RemoveBlock(block)
+	}
+
+	for _, block := range update.Disconnected {
+		for _, tx := range block.Transactions {
+			if !tx.IsCoinbase() {
+				// transactions the new branch already spent are simply dropped
+				s.Mempool.Add(tx)
+			}
+		}
+	}
+}
+
+// mineBlock packs the pending transactions that pay the most fees into a new
+// block paying the coinbase to the miner address and announces the block to
+// the known nodes
+func (s *Server) mineBlock() {
+	var txs []*blockchain.Transaction
+	txFees := make(map[*blockchain.Transaction]int)
+
+	for _, tx := range s.Mempool.Transactions() {
+		if fee, err := s.Chain.ValidateTransaction(tx); err == nil {
+			txs = append(txs, tx)
+			txFees[tx] = fee
+		} else {
+			s.Mempool.Remove(tx.ID)
+		}
+	}
+
+	if len(txs) == 0 {
+		fmt.Println("All transactions are invalid")
+		return
+	}
+
+	sort.SliceStable(txs, func(i, j int) bool { return txFees[txs[i]] > txFees[txs[j]] })
+	if len(txs) > maxBlockTransactions {
+		txs = txs[:maxBlockTransactions]
+	}
+	fees := 0
+	for _, tx := range txs {
+		fees += txFees[tx]
+	}
+
+	height, err := s.Chain.GetBestHeight()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	cbTx, err := blockchain.CoinbaseTx(s.MinerAddress, "", height+1, fees, s.Chain.Params)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	txs = append([]*blockchain.Transaction{cbTx}, txs...)
+
+	newBlock, err := s.Chain.AddBlock(txs)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	s.Mempool.RemoveBlock(newBlock)
+
+	fmt.Printf("New block %x is mined with %d transactions\n", newBlock.Hash, len(txs))
+
+	for _, node := range s.KnownNodes {
+		if node != s.Address {
+			s.sendInv(node, "block", [][]byte{newBlock.Hash})
+		}
+	}
+}
+
+func (s *Server) mineLoop() {
+	ticker := time.NewTicker(mineInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mu.Lock()
+		if s.Mempool.Count() > 0 {
+			s.mineBlock()
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *Server) handleVersion(request []byte) {
+	var payload Version
+	if err := decodePayload(request, &payload); err != nil {
+		log.Println(err)
+		return
+	}
+	if payload.Version != version {
+		fmt.Printf("Ignoring %s, it speaks protocol version %d\n", payload.AddrFrom, payload.Version)
+		return
+	}
+	if !bytes.Equal(payload.GenesisHash, s.Chain.Params.GenesisHash) {
+		fmt.Printf("Ignoring %s, its chain starts from genesis %x\n", payload.AddrFrom, payload.GenesisHash)
+		return
+	}
+
+	bestHeight, err := s.Chain.GetBestHeight()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	otherHeight := payload.BestHeight
+
+	if bestHeight < otherHeight {
+		s.sendGetBlocks(payload.AddrFrom)
+	} else if bestHeight > otherHeight {
+		s.sendVersion(payload.AddrFrom)
+	}
+
+	if !s.isKnown(payload.AddrFrom) {
+		s.sendAddr(payload.AddrFrom)
+		s.addKnown(payload.AddrFrom)
+	}
+}
+
+func (s *Server) handleConnection(conn net.Conn) {
+	defer conn.Close()
+
+	if err := conn.SetReadDeadline(time.Now().Add(readTimeout)); err != nil {
+		log.Println(err)
+		return
+	}
+	req, err := ioutil.ReadAll(io.LimitReader(conn, maxMessageSize+1))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if len(req) > maxMessageSize {
+		fmt.Printf("Ignoring message of more than %d bytes from %s\n", maxMessageSize, conn.RemoteAddr())
+		return
+	}
+	if len(req) < headerLength {
+		return
+	}
+	if !bytes.Equal(ExtractMagic(req), s.Chain.Params.Magic[:]) {
+		fmt.Println("Ignoring message from another network")
+		return
+	}
+
+	command := BytesToCmd(ExtractCmd(req))
+	fmt.Printf("Received %s command\n", command)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch command {
+	case "addr":
+		s.handleAddr(req)
+	case "block":
+		s.handleBlock(req)
+	case "inv":
+		s.handleInv(req)
+	case "getblocks":
+		s.handleGetBlocks(req)
+	case "getdata":
+		s.handleGetData(req)
+	case "tx":
+		s.handleTx(req)
+	case "version":
+		s.handleVersion(req)
+	default:
+		fmt.Println("Unknown command")
+	}
+}
+
+// RPCConfig structure for the JSON-RPC server a node runs on Listen, Signer
+// signs the transactions it sends when set, otherwise the unlocked wallets do
+type RPCConfig struct {
+	Listen string
+	Signer signer.Signer
+}
+
+// StartServer function to run a node on the given port until it is interrupted,
+// the node mines pending transactions when a miner address is given and
+// answers JSON-RPC calls when rpcCfg is not nil
+func StartServer(cfg *config.Config, port, minerAddress string, rpcCfg *RPCConfig) error {
+	address := fmt.Sprintf("localhost:%s", port)
+
+	ln, err := net.Listen(protocol, address)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	chain, err := blockchain.ContinueBlockChain(cfg)
+	if err != nil {
+		return err
+	}
+
+	s := &Server{
+		Address:      address,
+		MinerAddress: minerAddress,
+		KnownNodes:   append([]string{}, KnownNodes...),
+		Chain:        chain,
+		Mempool:      blockchain.NewMempool(&blockchain.UTXOSet{Blockchain: chain}),
+	}
+
+	var httpServer *http.Server
+	if rpcCfg != nil {
+		if httpServer, err = s.startRPC(cfg, rpcCfg); err != nil {
+			chain.Database.Close()
+			return err
+		}
+	}
+	go closeOnSignal(ln)
+
+	if address != s.KnownNodes[0] {
+		s.mu.Lock()
+		s.sendVersion(s.KnownNodes[0])
+		s.mu.Unlock()
+	}
+
+	if minerAddress != "" {
+		go s.mineLoop()
+	}
+
+	for {
+		conn, acceptErr := ln.Accept()
+		if acceptErr != nil {
+			if !errors.Is(acceptErr, net.ErrClosed) {
+				err = acceptErr
+			}
+			break
+		}
+		go s.handleConnection(conn)
+	}
+
+	if httpServer != nil {
+		if shutdownErr := httpServer.Shutdown(context.Background()); err == nil {
+			err = shutdownErr
+		}
+		os.Remove(cfg.CookiePath())
+	}
+
+	// wait for the running handler and keep the lock, so neither the handlers
+	// nor the miner touch the database once it is closed
+	s.mu.Lock()
+	if closeErr := chain.Database.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// closeOnSignal closes the listener when the node is interrupted,
+// StartServer then stops accepting and closes the database
+func closeOnSignal(ln net.Listener) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
+
+	ln.Close()
+}
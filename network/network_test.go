@@ -0,0 +1,261 @@
+package network
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shortdaddy0711/golang-blockchain/blockchain"
+	"github.com/shortdaddy0711/golang-blockchain/config"
+	"github.com/shortdaddy0711/golang-blockchain/params"
+	"github.com/shortdaddy0711/golang-blockchain/signer"
+	"github.com/shortdaddy0711/golang-blockchain/wallet"
+)
+
+// a server without a chain fails on any access to it, so the handlers below
+// pass only when they drop the message before looking at the chain
+
+func TestHandleInvWithoutItems(t *testing.T) {
+	s := &Server{}
+
+	for _, kind := range []string{"tx", "block"} {
+		request := NewMessage([magicLength]byte{}, "inv", encodePayload(&Inv{"localhost:3001", kind, nil}))
+		s.handleInv(request)
+	}
+}
+
+func TestHandleVersionOfAnotherProtocol(t *testing.T) {
+	s := &Server{}
+
+	request := NewMessage([magicLength]byte{}, "version", encodePayload(&Version{version + 1, nil, 10, "localhost:3001"}))
+	s.handleVersion(request)
+
+	if len(s.KnownNodes) != 0 {
+		t.Fatalf("peer of another protocol version became known: %v", s.KnownNodes)
+	}
+}
+
+func TestHandleVersionFromAnotherGenesis(t *testing.T) {
+	s := &Server{Chain: &blockchain.BlockChain{Params: &params.RegTest}}
+
+	request := NewMessage(params.RegTest.Magic, "version", encodePayload(&Version{version, params.TestNet.GenesisHash, 10, "localhost:3001"}))
+	s.handleVersion(request)
+
+	if len(s.KnownNodes) != 0 {
+		t.Fatalf("peer of another genesis became known: %v", s.KnownNodes)
+	}
+}
+
+func TestHandleConnectionTooLarge(t *testing.T) {
+	s := &Server{}
+	client, server := net.Pipe()
+
+	done := make(chan struct{})
+	go func() {
+		s.handleConnection(server)
+		close(done)
+	}()
+
+	// the node stops reading after the limit and closes the connection
+	chunk := make([]byte, 1<<20)
+	for written := 0; written <= maxMessageSize; written += len(chunk) {
+		if _, err := client.Write(chunk); err != nil {
+			break
+		}
+	}
+	client.Close()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("handleConnection did not return")
+	}
+}
+
+func TestPayloadsRoundTrip(t *testing.T) {
+	payloads := []payload{
+		&Addr{[]string{"localhost:3000", "localhost:3001"}},
+		&Block{"localhost:3001", []byte{1, 2, 3}},
+		&GetBlocks{"localhost:3001"},
+		&GetData{"localhost:3001", "tx", []byte{4, 5}},
+		&Inv{"localhost:3001", "block", [][]byte{{6}, {7, 8}}},
+		&Tx{"localhost:3001", []byte{9}},
+		&Version{version, params.RegTest.GenesisHash, 42, "localhost:3001"},
+	}
+
+	for _, p := range payloads {
+		request := NewMessage(params.RegTest.Magic, "test", encodePayload(p))
+
+		decoded := reflect.New(reflect.TypeOf(p).Elem()).Interface().(payload)
+		if err := decodePayload(request, decoded); err != nil {
+			t.Fatalf("%T: %v", p, err)
+		}
+		if !reflect.DeepEqual(decoded, p) {
+			t.Errorf("%T decoded to %+v, want %+v", p, decoded, p)
+		}
+	}
+}
+
+func TestDecodePayloadRejectsMalformed(t *testing.T) {
+	valid := encodePayload(&GetData{"localhost:3001", "tx", []byte{4, 5}})
+
+	tests := map[string][]byte{
+		"empty":          {},
+		"other version":  append([]byte{blockchain.EncodingVersion + 1}, valid[1:]...),
+		"truncated":      valid[:len(valid)-1],
+		"trailing bytes": append(append([]byte{}, valid...), 0),
+		"huge length":    {blockchain.EncodingVersion, 0xff, 0xff, 0xff, 0xff},
+	}
+
+	for name, data := range tests {
+		request := NewMessage(params.RegTest.Magic, "getdata", data)
+
+		var decoded GetData
+		err := decodePayload(request, &decoded)
+		if !errors.Is(err, blockchain.ErrMalformedData) && !errors.Is(err, blockchain.ErrUnknownEncoding) {
+			t.Errorf("%s: decoding returned %v", name, err)
+		}
+	}
+}
+
+// newMiningServer creates a server mining to a fresh wallet on a regtest chain
+// where owner has the coinbase outputs of the first count blocks
+func newMiningServer(t *testing.T, owner *wallet.Wallet, count int) *Server {
+	t.Helper()
+
+	cfg := &config.Config{DataDir: t.TempDir(), Params: &params.RegTest}
+	chain, err := blockchain.InitBlockChain(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { chain.Database.Close() })
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	if err := UTXOSet.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+
+	for height := 1; height <= count; height++ {
+		cbTx, err := blockchain.CoinbaseTx(string(owner.Address(cfg.Params)), "", height, 0, cfg.Params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := chain.AddBlock([]*blockchain.Transaction{cbTx}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	miner, err := wallet.MakeWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Server{
+		MinerAddress: string(miner.Address(cfg.Params)),
+		Chain:        chain,
+		Mempool:      blockchain.NewMempool(&UTXOSet),
+	}
+}
+
+func TestMineBlockPacksTheHighestFees(t *testing.T) {
+	alice, err := wallet.MakeWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := wallet.MakeWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// five more transactions than fit in a block, the five paying the least
+	// arrive first so only sorting by fee leaves them out
+	const value, left = 4, 5
+	count := maxBlockTransactions + left
+	subsidy := params.RegTest.Subsidy
+	s := newMiningServer(t, alice, (count*value+subsidy-1)/subsidy)
+	p := s.Chain.Params
+	keys := signer.NewKeySigner(alice.PrivateKey)
+
+	// one transaction splits the coinbases of alice into an output per spend
+	UTXOSet := blockchain.UTXOSet{Blockchain: s.Chain}
+	split, err := blockchain.NewTransaction(keys, alice.PublicKey, string(alice.Address(p)), count*value, 0, 0, &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := blockchain.NewTXOutput(value, string(alice.Address(p)), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs := make([]blockchain.TxOutput, count)
+	for i := range outputs {
+		outputs[i] = *out
+	}
+	split.Outputs = append(outputs, split.Outputs[1:]...)
+	if err := s.Chain.SignTransaction(split, keys, alice.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+	height, err := s.Chain.GetBestHeight()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cbTx, err := blockchain.CoinbaseTx(s.MinerAddress, "", height+1, 0, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Chain.AddBlock([]*blockchain.Transaction{cbTx, split}); err != nil {
+		t.Fatal(err)
+	}
+
+	fees := make(map[string]int)
+	for i := 0; i < count; i++ {
+		fee := 2 + i%2
+		if i < left {
+			fee = 1
+		}
+		payment, err := blockchain.NewTXOutput(value-fee, string(bob.Address(p)), p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx := &blockchain.Transaction{
+			Inputs:  []blockchain.TxInput{{ID: split.ID, Out: i, Sequence: blockchain.MaxSequence}},
+			Outputs: []blockchain.TxOutput{*payment},
+		}
+		if err := s.Chain.SignTransaction(tx, keys, alice.PublicKey); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Mempool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+		fees[string(tx.ID)] = fee
+	}
+
+	s.mineBlock()
+
+	block, err := s.Chain.GetBlock(s.Chain.LastHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(block.Transactions) != maxBlockTransactions+1 {
+		t.Fatalf("mined %d transactions, want the coinbase and %d", len(block.Transactions), maxBlockTransactions)
+	}
+
+	total := 0
+	for i, tx := range block.Transactions[1:] {
+		fee := fees[string(tx.ID)]
+		if fee == 1 {
+			t.Fatalf("transaction %x paying the lowest fee is mined", tx.ID)
+		}
+		if i > 0 && fee > fees[string(block.Transactions[i].ID)] {
+			t.Fatalf("transaction %d pays %d, more than the one before it", i+1, fee)
+		}
+		total += fee
+	}
+	if got, want := block.Transactions[0].OutputValue(), p.BlockSubsidy(block.Height)+total; got != want {
+		t.Fatalf("coinbase pays %d, want the subsidy and the fees %d", got, want)
+	}
+	if s.Mempool.Count() != left {
+		t.Fatalf("%d transactions are left in the mempool, want %d", s.Mempool.Count(), left)
+	}
+}
@@ -0,0 +1,200 @@
+package params
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+)
+
+// ChainParams structure that bundles everything that makes one network
+// different from another, nodes and wallets only talk to their own network
+type ChainParams struct {
+	// Name of the network, also the data subdirectory of non main networks
+	Name string
+	// Magic is written in front of every message between nodes
+	Magic [4]byte
+	// AddressVersion is the first byte of every address on the network
+	AddressVersion byte
+	// ScriptHashAddressVersion is the first byte of pay to script hash addresses
+	ScriptHashAddressVersion byte
+	// HDCoinType is the coin type level of the derivation path of HD wallets
+	HDCoinType uint32
+
+	// GenesisData is the coinbase data of the genesis block
+	GenesisData string
+	// GenesisTime is the timestamp of the genesis block
+	GenesisTime int64
+	// GenesisNonce is the nonce that makes the genesis block meet GenesisTarget
+	GenesisNonce int
+	// GenesisPubKeyHash is the public key hash the genesis coinbase pays the
+	// subsidy to, nobody has a key for it so the coins can never be spent
+	GenesisPubKeyHash []byte
+	// GenesisHash is the hash of the genesis block, every chain of the network
+	// starts from it
+	GenesisHash []byte
+	// Subsidy is the amount a coinbase pays to the miner of a block before the first halving
+	Subsidy int
+	// SubsidyHalvingInterval is the number of blocks after which the subsidy halves
+	SubsidyHalvingInterval int
+
+	// PowLimit is the easiest target a block may use
+	PowLimit *big.Int
+	// GenesisTarget is the target of the genesis block
+	GenesisTarget *big.Int
+	// RetargetInterval is the number of blocks between two difficulty adjustments
+	RetargetInterval int
+	// TargetBlockTime is the expected number of seconds between two blocks
+	TargetBlockTime int64
+	// MaxRetargetFactor limits how much a single adjustment can change the target
+	MaxRetargetFactor int64
+	// NoRetargeting keeps the genesis target for every block
+	NoRetargeting bool
+}
+
+// target returns the target that needs zeroBits leading zero bits
+func target(zeroBits uint) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), 256-zeroBits)
+}
+
+// mustDecodeHex returns the bytes of a hex constant
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+// MainNet parameters, the network a node runs on unless told otherwise
+var MainNet = ChainParams{
+	Name:                     "mainnet",
+	Magic:                    [4]byte{0xc7, 0x4b, 0x1d, 0xe2},
+	AddressVersion:           0x26,
+	ScriptHashAddressVersion: 0x3f,
+	HDCoinType:               0,
+
+	GenesisData:            "First Transaction from Genesis",
+	GenesisTime:            1735689600,
+	GenesisNonce:           2377,
+	GenesisPubKeyHash:      make([]byte, 20),
+	GenesisHash:            mustDecodeHex("000f5b316023012cc2d0f4313ae386386819aaa2f19a7f95f87b3c54fd90f39a"),
+	Subsidy:                100,
+	SubsidyHalvingInterval: 210000,
+
+	PowLimit:          target(8),
+	GenesisTarget:     target(12),
+	RetargetInterval:  10,
+	TargetBlockTime:   10,
+	MaxRetargetFactor: 4,
+}
+
+// TestNet parameters, a public network with easier proof of work
+var TestNet = ChainParams{
+	Name:                     "testnet",
+	Magic:                    [4]byte{0xd3, 0x5a, 0x2e, 0x91},
+	AddressVersion:           0x41,
+	ScriptHashAddressVersion: 0x7f,
+	HDCoinType:               1,
+
+	GenesisData:            "First Transaction from Testnet Genesis",
+	GenesisTime:            1735689600,
+	GenesisNonce:           227,
+	GenesisPubKeyHash:      make([]byte, 20),
+	GenesisHash:            mustDecodeHex("0000f4134eb1b3e3f650b0e26b521866dda03b6ed191bdf49a45c26cb186a2df"),
+	Subsidy:                100,
+	SubsidyHalvingInterval: 210000,
+
+	PowLimit:          target(4),
+	GenesisTarget:     target(8),
+	RetargetInterval:  10,
+	TargetBlockTime:   10,
+	MaxRetargetFactor: 4,
+}
+
+// RegTest parameters, a local network for testing where blocks are mined
+// almost instantly and the difficulty never changes
+var RegTest = ChainParams{
+	Name:                     "regtest",
+	Magic:                    [4]byte{0xe8, 0x6c, 0x3f, 0xa4},
+	AddressVersion:           0x7a,
+	ScriptHashAddressVersion: 0x3a,
+	HDCoinType:               1,
+
+	GenesisData:            "First Transaction from Regtest Genesis",
+	GenesisTime:            1735689600,
+	GenesisNonce:           0,
+	GenesisPubKeyHash:      make([]byte, 20),
+	GenesisHash:            mustDecodeHex("69acd8a8f43ac63b41f8420682e766b19009c608774002ba6bb9890a867dd84b"),
+	Subsidy:                100,
+	SubsidyHalvingInterval: 150,
+
+	PowLimit:          target(1),
+	GenesisTarget:     target(1),
+	RetargetInterval:  10,
+	TargetBlockTime:   10,
+	MaxRetargetFactor: 4,
+	NoRetargeting:     true,
+}
+
+// Networks lists the built in networks by name
+var Networks = map[string]*ChainParams{
+	MainNet.Name: &MainNet,
+	TestNet.Name: &TestNet,
+	RegTest.Name: &RegTest,
+}
+
+// ByName function that returns the parameters of a built in network
+func ByName(name string) (*ChainParams, error) {
+	p, ok := Networks[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown network %q", name)
+	}
+
+	return p, nil
+}
+
+// BlockSubsidy method that returns the amount the coinbase of the block at
+// height may pay out on top of the fees, it halves every SubsidyHalvingInterval
+// blocks until it is 0
+func (p *ChainParams) BlockSubsidy(height int) int {
+	halvings := height / p.SubsidyHalvingInterval
+	if halvings >= 63 {
+		return 0
+	}
+
+	return p.Subsidy >> uint(halvings)
+}
+
+// Emission method that returns the sum of the subsidies of the blocks from
+// genesis up to and including the block at height
+func (p *ChainParams) Emission(height int) int {
+	total := 0
+
+	for start := 0; start <= height; start += p.SubsidyHalvingInterval {
+		subsidy := p.BlockSubsidy(start)
+		if subsidy == 0 {
+			break
+		}
+
+		blocks := p.SubsidyHalvingInterval
+		if height-start+1 < blocks {
+			blocks = height - start + 1
+		}
+		total += blocks * subsidy
+	}
+
+	return total
+}
+
+// MaxSupply method that returns the most coins there can ever be, the
+// emission once the subsidy has halved to 0
+func (p *ChainParams) MaxSupply() int {
+	total := 0
+
+	for subsidy := p.Subsidy; subsidy > 0; subsidy >>= 1 {
+		total += p.SubsidyHalvingInterval * subsidy
+	}
+
+	return total
+}
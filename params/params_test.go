@@ -0,0 +1,95 @@
+package params
+
+import "testing"
+
+func TestAddressVersionsAreUnique(t *testing.T) {
+	seen := make(map[byte]string)
+
+	for name, p := range Networks {
+		for _, version := range []byte{p.AddressVersion, p.ScriptHashAddressVersion} {
+			if other, ok := seen[version]; ok {
+				t.Errorf("%s and %s both use address version 0x%02x", name, other, version)
+			}
+			seen[version] = name
+		}
+	}
+}
+
+func TestMagicsAreUnique(t *testing.T) {
+	seen := make(map[[4]byte]string)
+
+	for name, p := range Networks {
+		if other, ok := seen[p.Magic]; ok {
+			t.Errorf("%s and %s both use magic %x", name, other, p.Magic)
+		}
+		seen[p.Magic] = name
+	}
+}
+
+func TestNetworksDoNotReuseBitcoinBytes(t *testing.T) {
+	bitcoinMagics := [][4]byte{
+		{0xf9, 0xbe, 0xb4, 0xd9},
+		{0x0b, 0x11, 0x09, 0x07},
+		{0xfa, 0xbf, 0xb5, 0xda},
+		{0x0a, 0x03, 0xcf, 0x40},
+	}
+	bitcoinVersions := []byte{0x00, 0x05, 0x6f, 0xc4}
+
+	for name, p := range Networks {
+		for _, magic := range bitcoinMagics {
+			if p.Magic == magic {
+				t.Errorf("%s uses the Bitcoin magic %x", name, magic)
+			}
+		}
+		for _, version := range bitcoinVersions {
+			if p.AddressVersion == version || p.ScriptHashAddressVersion == version {
+				t.Errorf("%s uses the Bitcoin address version 0x%02x", name, version)
+			}
+		}
+	}
+}
+
+func TestBlockSubsidy(t *testing.T) {
+	p := &ChainParams{Subsidy: 20, SubsidyHalvingInterval: 10}
+
+	tests := []struct {
+		height   int
+		subsidy  int
+		emission int
+	}{
+		{0, 20, 20},
+		{9, 20, 200},
+		{10, 10, 210},
+		{19, 10, 300},
+		{29, 5, 350},
+		{39, 2, 370},
+		{49, 1, 380},
+		{50, 0, 380},
+		{63 * 10, 0, 380},
+	}
+
+	for _, test := range tests {
+		if subsidy := p.BlockSubsidy(test.height); subsidy != test.subsidy {
+			t.Errorf("subsidy at height %d is %d, want %d", test.height, subsidy, test.subsidy)
+		}
+		if emission := p.Emission(test.height); emission != test.emission {
+			t.Errorf("emission up to height %d is %d, want %d", test.height, emission, test.emission)
+		}
+	}
+
+	if supply := p.MaxSupply(); supply != 380 {
+		t.Errorf("max supply is %d, want 380", supply)
+	}
+}
+
+func TestEmissionReachesMaxSupply(t *testing.T) {
+	for name, p := range Networks {
+		end := 64 * p.SubsidyHalvingInterval
+		if p.BlockSubsidy(end) != 0 {
+			t.Errorf("%s still pays a subsidy at height %d", name, end)
+		}
+		if emission, supply := p.Emission(end), p.MaxSupply(); emission != supply {
+			t.Errorf("%s emits %d in total, its max supply is %d", name, emission, supply)
+		}
+	}
+}
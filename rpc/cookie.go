@@ -0,0 +1,46 @@
+package rpc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// cookieUser is the user name of the credentials in the cookie file
+const cookieUser = "__cookie__"
+
+// WriteCookie function to make new random credentials and write them to the
+// file at path that only its owner can read, it returns them as "user:password"
+func WriteCookie(path string) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	auth := cookieUser + ":" + hex.EncodeToString(secret)
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.WriteString(auth); err != nil {
+		file.Close()
+		return "", err
+	}
+
+	return auth, file.Close()
+}
+
+// ReadCookie function that returns the credentials of the cookie file at path
+func ReadCookie(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
@@ -0,0 +1,389 @@
+package rpc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/shortdaddy0711/golang-blockchain/blockchain"
+	"github.com/shortdaddy0711/golang-blockchain/script"
+	"github.com/shortdaddy0711/golang-blockchain/signer"
+	"github.com/shortdaddy0711/golang-blockchain/wallet"
+)
+
+// handlers maps the method names to their implementation
+var handlers = map[string]handler{
+	"getblockcount":  getBlockCount,
+	"getblock":       getBlock,
+	"getbalance":     getBalance,
+	"sendtoaddress":  sendToAddress,
+	"getnewaddress":  getNewAddress,
+	"listaddresses":  listAddresses,
+	"gettransaction": getTransaction,
+
+	"encryptwallet":    encryptWallet,
+	"walletpassphrase": walletPassphrase,
+	"walletlock":       walletLock,
+}
+
+// BlockResult structure that getblock returns
+type BlockResult struct {
+	Hash              string   `json:"hash"`
+	Height            int      `json:"height"`
+	Version           int      `json:"version"`
+	Time              int64    `json:"time"`
+	PreviousBlockHash string   `json:"previousblockhash,omitempty"`
+	MerkleRoot        string   `json:"merkleroot"`
+	Bits              string   `json:"bits"`
+	Nonce             int      `json:"nonce"`
+	Tx                []string `json:"tx"`
+}
+
+// TxInputResult structure for an input of a transaction gettransaction returns
+type TxInputResult struct {
+	TxID      string `json:"txid,omitempty"`
+	Vout      int    `json:"vout"`
+	ScriptSig string `json:"scriptsig,omitempty"`
+	Coinbase  string `json:"coinbase,omitempty"`
+	Sequence  uint32 `json:"sequence"`
+}
+
+// TxOutputResult structure for an output of a transaction gettransaction returns,
+// the address is only known for pay to pubkey hash and pay to script hash scripts
+type TxOutputResult struct {
+	N            int    `json:"n"`
+	Value        int    `json:"value"`
+	Address      string `json:"address,omitempty"`
+	ScriptPubKey string `json:"scriptpubkey"`
+}
+
+// TransactionResult structure that gettransaction returns
+type TransactionResult struct {
+	TxID     string           `json:"txid"`
+	LockTime uint32           `json:"locktime"`
+	Vin      []TxInputResult  `json:"vin"`
+	Vout     []TxOutputResult `json:"vout"`
+}
+
+func invalidParams(format string, a ...interface{}) *Error {
+	return &Error{CodeInvalidParams, fmt.Sprintf(format, a...)}
+}
+
+func checkParams(params []json.RawMessage, n int) error {
+	if len(params) != n {
+		return invalidParams("Expected %d params, got %d", n, len(params))
+	}
+
+	return nil
+}
+
+func stringParam(params []json.RawMessage, i int) (string, error) {
+	var value string
+	if err := json.Unmarshal(params[i], &value); err != nil {
+		return "", invalidParams("Param %d must be a string", i)
+	}
+
+	return value, nil
+}
+
+func intParam(params []json.RawMessage, i int) (int, error) {
+	var value int
+	if err := json.Unmarshal(params[i], &value); err != nil {
+		return 0, invalidParams("Param %d must be an integer", i)
+	}
+
+	return value, nil
+}
+
+func hashParam(params []json.RawMessage, i int) ([]byte, error) {
+	value, err := stringParam(params, i)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, invalidParams("Param %d must be a hex encoded hash", i)
+	}
+
+	return hash, nil
+}
+
+// getblockcount returns the height of the tip
+func getBlockCount(s *Server, params []json.RawMessage) (interface{}, error) {
+	if err := checkParams(params, 0); err != nil {
+		return nil, err
+	}
+
+	return s.Chain.GetBestHeight()
+}
+
+// getblock "hash" returns the header and transaction ids of a block
+func getBlock(s *Server, params []json.RawMessage) (interface{}, error) {
+	if err := checkParams(params, 1); err != nil {
+		return nil, err
+	}
+	hash, err := hashParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := s.Chain.GetBlock(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	result := BlockResult{
+		Hash:       hex.EncodeToString(block.Hash),
+		Height:     block.Height,
+		Version:    block.Version,
+		Time:       block.Timestamp,
+		MerkleRoot: hex.EncodeToString(block.MerkleRoot),
+		Bits:       fmt.Sprintf("%08x", block.Bits),
+		Nonce:      block.Nonce,
+		Tx:         []string{},
+	}
+	if len(block.PrevHash) != 0 {
+		result.PreviousBlockHash = hex.EncodeToString(block.PrevHash)
+	}
+	for _, tx := range block.Transactions {
+		result.Tx = append(result.Tx, hex.EncodeToString(tx.ID))
+	}
+
+	return result, nil
+}
+
+// getbalance "address" returns the sum of the unspent outputs of an address
+func getBalance(s *Server, params []json.RawMessage) (interface{}, error) {
+	if err := checkParams(params, 1); err != nil {
+		return nil, err
+	}
+	address, err := stringParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	pkScript, err := wallet.AddressScript(address, s.Config.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: s.Chain}
+	UTXOs, err := UTXOSet.FindUTXO(pkScript)
+	if err != nil {
+		return nil, err
+	}
+
+	balance := 0
+	for _, out := range UTXOs {
+		balance += out.Value
+	}
+
+	return balance, nil
+}
+
+// sendtoaddress "address" amount "fromaddress" ( fee ) signs a transaction with
+// the wallet of fromaddress, relays it and returns its id, the fee defaults to
+// the minimum relay fee
+func sendToAddress(s *Server, params []json.RawMessage) (interface{}, error) {
+	fee := blockchain.MinRelayFee
+	if len(params) == 4 {
+		var err error
+		if fee, err = intParam(params, 3); err != nil {
+			return nil, err
+		}
+		params = params[:3]
+	}
+	if err := checkParams(params, 3); err != nil {
+		return nil, err
+	}
+	to, err := stringParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := intParam(params, 1)
+	if err != nil {
+		return nil, err
+	}
+	from, err := stringParam(params, 2)
+	if err != nil {
+		return nil, err
+	}
+	if amount <= 0 {
+		return nil, invalidParams("Amount must be positive")
+	}
+	if fee < 0 {
+		return nil, invalidParams("Fee must not be negative")
+	}
+
+	if err := wallet.ValidateAddress(to, s.Config.Params); err != nil {
+		return nil, err
+	}
+	w, err := s.Wallets.GetWallet(from)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys signer.Signer = s.Signer
+	if keys == nil {
+		if keys, err = s.Wallets.Signer(); err != nil {
+			return nil, err
+		}
+	}
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: s.Chain}
+	tx, err := blockchain.NewTransaction(keys, w.PublicKey, to, amount, fee, 0, &UTXOSet)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Relay(tx); err != nil {
+		return nil, err
+	}
+
+	return hex.EncodeToString(tx.ID), nil
+}
+
+// getnewaddress creates a wallet, saves it and returns its address
+func getNewAddress(s *Server, params []json.RawMessage) (interface{}, error) {
+	if err := checkParams(params, 0); err != nil {
+		return nil, err
+	}
+
+	address, err := s.Wallets.AddWallet()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Wallets.SaveFile(s.Config); err != nil {
+		return nil, err
+	}
+
+	return address, nil
+}
+
+// listaddresses returns the addresses of the wallets
+func listAddresses(s *Server, params []json.RawMessage) (interface{}, error) {
+	if err := checkParams(params, 0); err != nil {
+		return nil, err
+	}
+
+	addresses := s.Wallets.GetAllAddresses()
+	if addresses == nil {
+		addresses = []string{}
+	}
+
+	return addresses, nil
+}
+
+// gettransaction "txid" returns the inputs and outputs of a transaction on the chain
+func getTransaction(s *Server, params []json.RawMessage) (interface{}, error) {
+	if err := checkParams(params, 1); err != nil {
+		return nil, err
+	}
+	txID, err := hashParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.Chain.FindTransaction(txID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := TransactionResult{TxID: hex.EncodeToString(tx.ID), LockTime: tx.LockTime}
+	for _, in := range tx.Inputs {
+		if tx.IsCoinbase() {
+			result.Vin = append(result.Vin, TxInputResult{
+				Vout:     in.Out,
+				Coinbase: hex.EncodeToString(in.ScriptSig),
+				Sequence: in.Sequence,
+			})
+			continue
+		}
+		result.Vin = append(result.Vin, TxInputResult{
+			TxID:      hex.EncodeToString(in.ID),
+			Vout:      in.Out,
+			ScriptSig: script.Disassemble(in.ScriptSig),
+			Sequence:  in.Sequence,
+		})
+	}
+	for n, out := range tx.Outputs {
+		output := TxOutputResult{N: n, Value: out.Value, ScriptPubKey: script.Disassemble(out.ScriptPubKey)}
+		if pubKeyHash, ok := script.ExtractPubKeyHash(out.ScriptPubKey); ok {
+			output.Address = string(wallet.PubKeyHashAddress(pubKeyHash, s.Config.Params))
+		} else if scriptHash, ok := script.ExtractScriptHash(out.ScriptPubKey); ok {
+			output.Address = string(wallet.ScriptHashAddress(scriptHash, s.Config.Params))
+		}
+		result.Vout = append(result.Vout, output)
+	}
+
+	return result, nil
+}
+
+// encryptwallet "passphrase" encrypts the private keys of the wallets and locks them
+func encryptWallet(s *Server, params []json.RawMessage) (interface{}, error) {
+	if err := checkParams(params, 1); err != nil {
+		return nil, err
+	}
+	passphrase, err := stringParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Wallets.Encrypt(passphrase); err != nil {
+		return nil, err
+	}
+	if err := s.Wallets.SaveFile(s.Config); err != nil {
+		return nil, err
+	}
+
+	return "Wallet encrypted, unlock it with walletpassphrase to send", nil
+}
+
+// walletpassphrase "passphrase" timeout unlocks the wallets for timeout seconds
+func walletPassphrase(s *Server, params []json.RawMessage) (interface{}, error) {
+	if err := checkParams(params, 2); err != nil {
+		return nil, err
+	}
+	passphrase, err := stringParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := intParam(params, 1)
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		return nil, invalidParams("Timeout must be positive")
+	}
+
+	if err := s.Wallets.Unlock(passphrase); err != nil {
+		return nil, err
+	}
+
+	if s.lockTimer != nil {
+		s.lockTimer.Stop()
+	}
+	s.lockTimer = time.AfterFunc(time.Duration(timeout)*time.Second, func() {
+		s.Locker.Lock()
+		defer s.Locker.Unlock()
+
+		s.Wallets.Lock()
+	})
+
+	return nil, nil
+}
+
+// walletlock locks the wallets before their unlock timeout runs out
+func walletLock(s *Server, params []json.RawMessage) (interface{}, error) {
+	if err := checkParams(params, 0); err != nil {
+		return nil, err
+	}
+
+	if s.lockTimer != nil {
+		s.lockTimer.Stop()
+		s.lockTimer = nil
+	}
+
+	return nil, s.Wallets.Lock()
+}
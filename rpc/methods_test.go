@@ -0,0 +1,219 @@
+package rpc
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/shortdaddy0711/golang-blockchain/blockchain"
+	"github.com/shortdaddy0711/golang-blockchain/config"
+	"github.com/shortdaddy0711/golang-blockchain/params"
+	"github.com/shortdaddy0711/golang-blockchain/signer"
+	"github.com/shortdaddy0711/golang-blockchain/wallet"
+)
+
+// newTestServer creates a server on a regtest chain holding only the genesis
+// block, the transactions it relays are collected in relayed
+func newTestServer(t *testing.T) (*Server, *[]*blockchain.Transaction) {
+	t.Helper()
+
+	cfg := &config.Config{DataDir: t.TempDir(), Params: &params.RegTest}
+	chain, err := blockchain.InitBlockChain(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { chain.Database.Close() })
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	if err := UTXOSet.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+
+	wallets, err := wallet.CreateWallets(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var relayed []*blockchain.Transaction
+	relay := func(tx *blockchain.Transaction) error {
+		relayed = append(relayed, tx)
+		return nil
+	}
+
+	return NewServer(cfg, chain, wallets, relay), &relayed
+}
+
+// callMethod runs a call with the params given as a JSON array
+func callMethod(t *testing.T, s *Server, method, params string) *Response {
+	t.Helper()
+
+	raw := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":%q,"params":%s}`, method, params)
+	response := s.call([]byte(raw))
+	if response == nil {
+		t.Fatalf("%s %s got no response", method, params)
+	}
+
+	return response
+}
+
+func TestSendToAddress(t *testing.T) {
+	s, relayed := newTestServer(t)
+
+	from, err := s.Wallets.AddWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := s.Wallets.AddWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase, err := blockchain.CoinbaseTx(from, "", 1, 0, s.Config.Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Chain.AddBlock([]*blockchain.Transaction{coinbase}); err != nil {
+		t.Fatal(err)
+	}
+	funds := coinbase.OutputValue()
+
+	invalid := []struct {
+		name   string
+		params string
+		code   int
+	}{
+		{"too few params", fmt.Sprintf(`[%q, 10]`, to), CodeInvalidParams},
+		{"too many params", fmt.Sprintf(`[%q, 10, %q, 1, 2]`, to, from), CodeInvalidParams},
+		{"amount as a string", fmt.Sprintf(`[%q, "10", %q]`, to, from), CodeInvalidParams},
+		{"zero amount", fmt.Sprintf(`[%q, 0, %q]`, to, from), CodeInvalidParams},
+		{"negative fee", fmt.Sprintf(`[%q, 10, %q, -1]`, to, from), CodeInvalidParams},
+		{"fee as a string", fmt.Sprintf(`[%q, 10, %q, "1"]`, to, from), CodeInvalidParams},
+		{"invalid address", fmt.Sprintf(`["nowhere", 10, %q]`, from), CodeInvalidAddressOrKey},
+		{"unknown wallet", fmt.Sprintf(`[%q, 10, %q]`, to, to[:len(to)-1]), CodeInvalidAddressOrKey},
+		{"more than the funds", fmt.Sprintf(`[%q, %d, %q]`, to, funds, from), CodeInsufficientFunds},
+	}
+	for _, test := range invalid {
+		response := callMethod(t, s, "sendtoaddress", test.params)
+		if response.Error == nil || response.Error.Code != test.code {
+			t.Errorf("%s: got error %v, want code %d", test.name, response.Error, test.code)
+		}
+	}
+	if len(*relayed) != 0 {
+		t.Fatalf("relayed %d transactions of invalid calls", len(*relayed))
+	}
+
+	fees := []struct {
+		params string
+		fee    int
+	}{
+		{fmt.Sprintf(`[%q, 10, %q]`, to, from), blockchain.MinRelayFee},
+		{fmt.Sprintf(`[%q, 10, %q, 7]`, to, from), 7},
+	}
+	for _, test := range fees {
+		response := callMethod(t, s, "sendtoaddress", test.params)
+		if response.Error != nil {
+			t.Fatalf("%s: %v", test.params, response.Error)
+		}
+
+		tx := (*relayed)[len(*relayed)-1]
+		if response.Result != hex.EncodeToString(tx.ID) {
+			t.Fatalf("%s returned %v, relayed %x", test.params, response.Result, tx.ID)
+		}
+		// the only input is the coinbase
+		if fee := funds - tx.OutputValue(); fee != test.fee {
+			t.Errorf("%s paid a fee of %d, want %d", test.params, fee, test.fee)
+		}
+		if _, err := s.Chain.ValidateTransaction(tx); err != nil {
+			t.Errorf("%s relayed an invalid transaction: %v", test.params, err)
+		}
+	}
+}
+
+func TestWalletPassphrase(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	if _, err := s.Wallets.AddWallet(); err != nil {
+		t.Fatal(err)
+	}
+
+	if response := callMethod(t, s, "walletlock", `[]`); response.Error == nil || response.Error.Code != CodeWrongEncState {
+		t.Fatalf("locking unencrypted wallets returned %v", response.Error)
+	}
+	if response := callMethod(t, s, "encryptwallet", `["secret"]`); response.Error != nil {
+		t.Fatal(response.Error)
+	}
+	if response := callMethod(t, s, "getnewaddress", `[]`); response.Error == nil || response.Error.Code != CodeWalletUnlockNeeded {
+		t.Fatalf("getnewaddress on locked wallets returned %v", response.Error)
+	}
+	if response := callMethod(t, s, "walletpassphrase", `["wrong", 60]`); response.Error == nil || response.Error.Code != CodeWrongPassphrase {
+		t.Fatalf("walletpassphrase with a wrong passphrase returned %v", response.Error)
+	}
+	if response := callMethod(t, s, "walletpassphrase", `["secret", 0]`); response.Error == nil || response.Error.Code != CodeInvalidParams {
+		t.Fatalf("walletpassphrase without a timeout returned %v", response.Error)
+	}
+
+	// walletlock locks before the timeout and stops its timer
+	if response := callMethod(t, s, "walletpassphrase", `["secret", 60]`); response.Error != nil {
+		t.Fatal(response.Error)
+	}
+	if s.Wallets.IsLocked() {
+		t.Fatal("wallets are still locked after walletpassphrase")
+	}
+	if response := callMethod(t, s, "walletlock", `[]`); response.Error != nil {
+		t.Fatal(response.Error)
+	}
+	if !s.Wallets.IsLocked() || s.lockTimer != nil {
+		t.Fatal("walletlock left the wallets unlocked or the timer running")
+	}
+
+	// the timer locks the wallets again once the timeout runs out
+	if response := callMethod(t, s, "walletpassphrase", `["secret", 1]`); response.Error != nil {
+		t.Fatal(response.Error)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.Locker.Lock()
+		locked := s.Wallets.IsLocked()
+		s.Locker.Unlock()
+		if locked {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("wallets are still unlocked after the timeout")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestToError(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{&Error{CodeInvalidParams, "bad"}, CodeInvalidParams},
+		{fmt.Errorf("wrapped: %w", &Error{CodeMethodNotFound, "gone"}), CodeMethodNotFound},
+		{wallet.ErrInvalidAddress, CodeInvalidAddressOrKey},
+		{wallet.ErrWrongNetwork, CodeInvalidAddressOrKey},
+		{wallet.ErrWalletNotFound, CodeInvalidAddressOrKey},
+		{fmt.Errorf("%w: 00", blockchain.ErrBlockNotFound), CodeInvalidAddressOrKey},
+		{blockchain.ErrTxNotFound, CodeInvalidAddressOrKey},
+		{signer.ErrUnknownKey, CodeInvalidAddressOrKey},
+		{fmt.Errorf("%w: 10 of 5", blockchain.ErrNotEnoughFunds), CodeInsufficientFunds},
+		{wallet.ErrWalletLocked, CodeWalletUnlockNeeded},
+		{wallet.ErrWrongPassphrase, CodeWrongPassphrase},
+		{wallet.ErrWalletEncrypted, CodeWrongEncState},
+		{wallet.ErrWalletNotEncrypted, CodeWrongEncState},
+		{errors.New("disk full"), CodeInternalError},
+	}
+
+	for _, test := range tests {
+		got := toError(test.err)
+		if got.Code != test.code {
+			t.Errorf("%v: got code %d, want %d", test.err, got.Code, test.code)
+		}
+		if got.Message != test.err.Error() && !errors.As(test.err, new(*Error)) {
+			t.Errorf("%v: got message %q", test.err, got.Message)
+		}
+	}
+}
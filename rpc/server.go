@@ -0,0 +1,259 @@
+package rpc
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/shortdaddy0711/golang-blockchain/blockchain"
+	"github.com/shortdaddy0711/golang-blockchain/config"
+	"github.com/shortdaddy0711/golang-blockchain/signer"
+	"github.com/shortdaddy0711/golang-blockchain/wallet"
+)
+
+const jsonrpcVersion = "2.0"
+
+// Error codes of the JSON-RPC 2.0 specification and of the chain and wallet
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+
+	CodeInvalidAddressOrKey = -5
+	CodeInsufficientFunds   = -6
+	CodeWalletUnlockNeeded  = -13
+	CodeWrongPassphrase     = -14
+	CodeWrongEncState       = -15
+)
+
+// Request structure for a JSON-RPC 2.0 call, params are positional
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// Response structure for the answer to a call, only one of Result and Error is set
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// MarshalJSON method for Response, a success always has a result even when it
+// is null and an error never has one
+func (r Response) MarshalJSON() ([]byte, error) {
+	if r.Error != nil {
+		return json.Marshal(struct {
+			JSONRPC string          `json:"jsonrpc"`
+			Error   *Error          `json:"error"`
+			ID      json.RawMessage `json:"id"`
+		}{r.JSONRPC, r.Error, r.ID})
+	}
+
+	type response Response
+	return json.Marshal(response(r))
+}
+
+// Error structure for a failed call
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
+type handler func(s *Server, params []json.RawMessage) (interface{}, error)
+
+// Server structure that answers JSON-RPC calls over HTTP from the chain and
+// wallets of a config, Relay hands the transactions it creates to the network.
+// Signer signs them when set, otherwise the unlocked wallets do. Every call
+// holds Locker, a node shares its own lock so calls and peers take turns.
+// Callers must send Auth, "user:password", as basic auth
+type Server struct {
+	Config    *config.Config
+	Chain     *blockchain.BlockChain
+	Wallets   *wallet.Wallets
+	Relay     func(tx *blockchain.Transaction) error
+	Signer    signer.Signer
+	Locker    sync.Locker
+	Auth      string
+	lockTimer *time.Timer
+}
+
+// NewServer function to create a server on top of an open chain and loaded wallets
+func NewServer(cfg *config.Config, chain *blockchain.BlockChain, wallets *wallet.Wallets,
+	relay func(tx *blockchain.Transaction) error) *Server {
+	return &Server{Config: cfg, Chain: chain, Wallets: wallets, Relay: relay, Locker: &sync.Mutex{}}
+}
+
+// ServeHTTP method to answer a single call or a batch of calls posted as JSON,
+// requests without the credentials or of another content type are refused so
+// web pages cannot make calls from the browser
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="jsonrpc"`)
+		http.Error(w, "JSON-RPC requests need the credentials of the cookie file", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "JSON-RPC requests must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		http.Error(w, "JSON-RPC requests must be sent as application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var result interface{}
+
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil || len(batch) == 0 {
+			result = errorResponse(nil, &Error{CodeInvalidRequest, "Invalid batch"})
+		} else {
+			var responses []*Response
+			for _, raw := range batch {
+				if res := s.call(raw); res != nil {
+					responses = append(responses, res)
+				}
+			}
+			if len(responses) > 0 {
+				result = responses
+			}
+		}
+	} else if res := s.call(body); res != nil {
+		result = res
+	}
+
+	if result == nil {
+		// only notifications, they get no answer
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Println(err)
+	}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	user, password, ok := r.BasicAuth()
+	if !ok || s.Auth == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(user+":"+password), []byte(s.Auth)) == 1
+}
+
+// call runs one request, it returns nil for a notification
+func (s *Server) call(raw []byte) *Response {
+	var req Request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return errorResponse(nil, &Error{CodeParseError, err.Error()})
+	}
+	if req.JSONRPC != jsonrpcVersion || req.Method == "" {
+		return errorResponse(req.ID, &Error{CodeInvalidRequest, "Invalid request"})
+	}
+
+	var params []json.RawMessage
+	if len(req.Params) > 0 && string(req.Params) != "null" {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return errorResponse(req.ID, &Error{CodeInvalidParams, "Params must be an array"})
+		}
+	}
+
+	var result interface{}
+	var err error
+
+	h, ok := handlers[req.Method]
+	if ok {
+		s.Locker.Lock()
+		result, err = h(s, params)
+		s.Locker.Unlock()
+	} else {
+		err = &Error{CodeMethodNotFound, fmt.Sprintf("Method %q is not found", req.Method)}
+	}
+
+	if len(req.ID) == 0 {
+		return nil
+	}
+	if err != nil {
+		return errorResponse(req.ID, toError(err))
+	}
+
+	return &Response{JSONRPC: jsonrpcVersion, Result: result, ID: req.ID}
+}
+
+func errorResponse(id json.RawMessage, err *Error) *Response {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+
+	return &Response{JSONRPC: jsonrpcVersion, Error: err, ID: id}
+}
+
+// toError maps the errors of the chain and the wallet to JSON-RPC error codes
+func toError(err error) *Error {
+	var rpcErr *Error
+	switch {
+	case errors.As(err, &rpcErr):
+		return rpcErr
+	case errors.Is(err, wallet.ErrInvalidAddress), errors.Is(err, wallet.ErrWrongNetwork),
+		errors.Is(err, wallet.ErrWalletNotFound), errors.Is(err, blockchain.ErrBlockNotFound),
+		errors.Is(err, blockchain.ErrTxNotFound), errors.Is(err, signer.ErrUnknownKey):
+		return &Error{CodeInvalidAddressOrKey, err.Error()}
+	case errors.Is(err, blockchain.ErrNotEnoughFunds):
+		return &Error{CodeInsufficientFunds, err.Error()}
+	case errors.Is(err, wallet.ErrWalletLocked):
+		return &Error{CodeWalletUnlockNeeded, err.Error()}
+	case errors.Is(err, wallet.ErrWrongPassphrase):
+		return &Error{CodeWrongPassphrase, err.Error()}
+	case errors.Is(err, wallet.ErrWalletEncrypted), errors.Is(err, wallet.ErrWalletNotEncrypted):
+		return &Error{CodeWrongEncState, err.Error()}
+	default:
+		return &Error{CodeInternalError, err.Error()}
+	}
+}
+
+// Listen function to answer calls on addr in the background, the caller shuts
+// the returned server down
+func Listen(addr string, s *Server) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	httpServer := &http.Server{Handler: s}
+	go func() {
+		if err := httpServer.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			log.Println(err)
+		}
+	}()
+
+	return httpServer, nil
+}
@@ -0,0 +1,77 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseResult(t *testing.T) {
+	tests := []struct {
+		response *Response
+		want     string
+	}{
+		{&Response{JSONRPC: jsonrpcVersion, ID: json.RawMessage("1")}, `{"jsonrpc":"2.0","result":null,"id":1}`},
+		{&Response{JSONRPC: jsonrpcVersion, Result: 0, ID: json.RawMessage("2")}, `{"jsonrpc":"2.0","result":0,"id":2}`},
+		{errorResponse(json.RawMessage("3"), &Error{CodeInternalError, "failed"}), `{"jsonrpc":"2.0","error":{"code":-32603,"message":"failed"},"id":3}`},
+		{errorResponse(nil, &Error{CodeParseError, "bad"}), `{"jsonrpc":"2.0","error":{"code":-32700,"message":"bad"},"id":null}`},
+	}
+
+	for _, test := range tests {
+		got, err := json.Marshal(test.response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != test.want {
+			t.Errorf("got %s, want %s", got, test.want)
+		}
+	}
+}
+
+func TestServeHTTPRefusesRequests(t *testing.T) {
+	s := NewServer(nil, nil, nil, nil)
+	s.Auth = "__cookie__:secret"
+
+	tests := []struct {
+		name        string
+		user        string
+		password    string
+		contentType string
+		want        int
+	}{
+		{"no credentials", "", "", "application/json", http.StatusUnauthorized},
+		{"wrong password", "__cookie__", "guess", "application/json", http.StatusUnauthorized},
+		{"form post", "__cookie__", "secret", "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"plain text", "__cookie__", "secret", "text/plain", http.StatusUnsupportedMediaType},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"getblockcount"}`))
+		r.Header.Set("Content-Type", test.contentType)
+		if test.user != "" {
+			r.SetBasicAuth(test.user, test.password)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+
+		if w.Code != test.want {
+			t.Errorf("%s: got status %d, want %d", test.name, w.Code, test.want)
+		}
+	}
+}
+
+func TestServeHTTPWithoutAuth(t *testing.T) {
+	s := NewServer(nil, nil, nil, nil)
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.SetBasicAuth("", "")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("a server without credentials answered with status %d", w.Code)
+	}
+}
@@ -0,0 +1,387 @@
+package script
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ripemd160"
+)
+
+const (
+	// MaxStackSize is the largest number of elements on the stack
+	MaxStackSize = 1000
+	// MaxOps is the largest number of opcodes other than pushes in a script
+	MaxOps = 201
+	// MaxMultiSigKeys is the largest number of public keys of OP_CHECKMULTISIG
+	MaxMultiSigKeys = 16
+)
+
+var (
+	// ErrScriptFailed error when a script ends without true on top of the stack
+	ErrScriptFailed = errors.New("Script evaluated to false")
+	// ErrNotPushOnly error when an unlocking script does more than push data
+	ErrNotPushOnly = errors.New("Unlocking script is not push only")
+	// ErrVerifyFailed error when a VERIFY opcode finds false on the stack
+	ErrVerifyFailed = errors.New("Script verification failed")
+	// ErrStackUnderflow error when an opcode needs more elements than the stack has
+	ErrStackUnderflow = errors.New("Stack has too few elements")
+	// ErrScriptLimits error when a script or its stack grows past the limits
+	ErrScriptLimits = errors.New("Script exceeds the limits")
+	// ErrBadOpcode error when a script runs an unknown opcode or OP_RETURN
+	ErrBadOpcode = errors.New("Script runs an invalid opcode")
+	// ErrUnsatisfiedLockTime error when the transaction does not meet the timelock of a script
+	ErrUnsatisfiedLockTime = errors.New("Script timelock is not satisfied")
+)
+
+// Checker interface for what the engine needs to know about the transaction
+// spending an output
+type Checker interface {
+	// CheckSig tells whether sig signs the transaction for pubKey, subScript
+	// is the script that runs the signature check
+	CheckSig(sig, pubKey, subScript []byte) bool
+	// CheckLockTime tells whether the lock time of the transaction is at
+	// least lockTime, as a height or a time alike
+	CheckLockTime(lockTime int64) bool
+	// CheckSequence tells whether the relative timelock of the input is at
+	// least sequence, in blocks or in time alike
+	CheckSequence(sequence int64) bool
+}
+
+// engine structure of a running script
+type engine struct {
+	stack   [][]byte
+	checker Checker
+}
+
+// Execute function to run an unlocking script and then the locking script of
+// the output it spends on the same stack, the output is spent when neither
+// fails and true is left on top of the stack. A pay to script hash output
+// then runs the redeem script, the last push of the unlocking script, on
+// the rest of what the unlocking script pushed
+func Execute(sigScript, pkScript []byte, checker Checker) error {
+	if !IsPushOnly(sigScript) {
+		return ErrNotPushOnly
+	}
+
+	vm := &engine{checker: checker}
+	if err := vm.run(sigScript); err != nil {
+		return err
+	}
+	pushed := append([][]byte{}, vm.stack...)
+
+	if err := vm.run(pkScript); err != nil {
+		return err
+	}
+	if err := vm.checkResult(); err != nil {
+		return err
+	}
+
+	if !IsPayToScriptHash(pkScript) {
+		return nil
+	}
+
+	vm.stack = pushed
+	redeemScript, err := vm.pop()
+	if err != nil {
+		return err
+	}
+	if err := vm.run(redeemScript); err != nil {
+		return err
+	}
+
+	return vm.checkResult()
+}
+
+func (vm *engine) checkResult() error {
+	if len(vm.stack) == 0 || !asBool(vm.stack[len(vm.stack)-1]) {
+		return ErrScriptFailed
+	}
+
+	return nil
+}
+
+func (vm *engine) run(script []byte) error {
+	if len(script) > MaxScriptSize {
+		return fmt.Errorf("%w: script of %d bytes", ErrScriptLimits, len(script))
+	}
+
+	tokens, err := parse(script)
+	if err != nil {
+		return err
+	}
+
+	ops := 0
+	for _, t := range tokens {
+		if !t.isPush() {
+			ops++
+			if ops > MaxOps {
+				return fmt.Errorf("%w: more than %d opcodes", ErrScriptLimits, MaxOps)
+			}
+		}
+
+		if err := vm.step(t, script); err != nil {
+			return err
+		}
+		if len(vm.stack) > MaxStackSize {
+			return fmt.Errorf("%w: more than %d stack elements", ErrScriptLimits, MaxStackSize)
+		}
+	}
+
+	return nil
+}
+
+// step runs a single opcode, script is the whole script the opcode is part of
+func (vm *engine) step(t token, script []byte) error {
+	if t.isPush() {
+		data := pushValue(t)
+		if len(data) > MaxPushSize {
+			return fmt.Errorf("%w: push of %d bytes", ErrScriptLimits, len(data))
+		}
+		vm.push(data)
+
+		return nil
+	}
+
+	switch t.op {
+	case OP_NOP:
+
+	case OP_VERIFY:
+		return vm.verify()
+
+	case OP_DROP:
+		if _, err := vm.pop(); err != nil {
+			return err
+		}
+
+	case OP_DUP:
+		top, err := vm.peek()
+		if err != nil {
+			return err
+		}
+		vm.push(top)
+
+	case OP_EQUAL, OP_EQUALVERIFY:
+		a, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		b, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		vm.pushBool(bytes.Equal(a, b))
+		if t.op == OP_EQUALVERIFY {
+			return vm.verify()
+		}
+
+	case OP_SHA256:
+		data, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(data)
+		vm.push(hash[:])
+
+	case OP_HASH160:
+		data, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		vm.push(Hash160(data))
+
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		pubKey, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		sig, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		if err := checkSigEncoding(sig); err != nil {
+			return err
+		}
+		if err := checkPubKeyEncoding(pubKey); err != nil {
+			return err
+		}
+		vm.pushBool(len(sig) > 0 && vm.checker.CheckSig(sig, pubKey, script))
+		if t.op == OP_CHECKSIGVERIFY {
+			return vm.verify()
+		}
+
+	case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+		valid, err := vm.checkMultiSig(script)
+		if err != nil {
+			return err
+		}
+		vm.pushBool(valid)
+		if t.op == OP_CHECKMULTISIGVERIFY {
+			return vm.verify()
+		}
+
+	case OP_CHECKLOCKTIMEVERIFY, OP_CHECKSEQUENCEVERIFY:
+		return vm.checkTimeLock(t.op)
+
+	default:
+		return fmt.Errorf("%w: %s", ErrBadOpcode, opcodeName(t.op))
+	}
+
+	return nil
+}
+
+// checkMultiSig pops <sig>... m <pubKey>... n and tells whether the m signatures
+// are made by m of the n keys, in the same order as the keys
+func (vm *engine) checkMultiSig(script []byte) (bool, error) {
+	n, err := vm.popNum()
+	if err != nil {
+		return false, err
+	}
+	if n < 1 || n > MaxMultiSigKeys {
+		return false, fmt.Errorf("%w: %d public keys", ErrScriptLimits, n)
+	}
+	pubKeys := make([][]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		if pubKeys[i], err = vm.pop(); err != nil {
+			return false, err
+		}
+		if err := checkPubKeyEncoding(pubKeys[i]); err != nil {
+			return false, err
+		}
+	}
+
+	m, err := vm.popNum()
+	if err != nil {
+		return false, err
+	}
+	if m < 1 || m > n {
+		return false, fmt.Errorf("%w: %d of %d signatures", ErrScriptLimits, m, n)
+	}
+	sigs := make([][]byte, m)
+	for i := m - 1; i >= 0; i-- {
+		if sigs[i], err = vm.pop(); err != nil {
+			return false, err
+		}
+		if err := checkSigEncoding(sigs[i]); err != nil {
+			return false, err
+		}
+	}
+
+	key := 0
+	for _, sig := range sigs {
+		for key < len(pubKeys) && !(len(sig) > 0 && vm.checker.CheckSig(sig, pubKeys[key], script)) {
+			key++
+		}
+		if key == len(pubKeys) {
+			return false, nil
+		}
+		key++
+	}
+
+	return true, nil
+}
+
+// checkTimeLock fails unless the transaction meets the timelock on top of the
+// stack, which stays there like the NOP the opcode once was in Bitcoin
+func (vm *engine) checkTimeLock(op byte) error {
+	top, err := vm.peek()
+	if err != nil {
+		return err
+	}
+	n, err := decodeNum(top, lockTimeNumSize)
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return fmt.Errorf("%w: negative %s", ErrUnsatisfiedLockTime, opcodeName(op))
+	}
+
+	var ok bool
+	if op == OP_CHECKLOCKTIMEVERIFY {
+		ok = vm.checker.CheckLockTime(n)
+	} else {
+		ok = vm.checker.CheckSequence(n)
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s %d", ErrUnsatisfiedLockTime, opcodeName(op), n)
+	}
+
+	return nil
+}
+
+func (vm *engine) push(data []byte) {
+	vm.stack = append(vm.stack, data)
+}
+
+func (vm *engine) pushBool(value bool) {
+	if value {
+		vm.push([]byte{1})
+	} else {
+		vm.push(nil)
+	}
+}
+
+func (vm *engine) pop() ([]byte, error) {
+	top, err := vm.peek()
+	if err != nil {
+		return nil, err
+	}
+	vm.stack = vm.stack[:len(vm.stack)-1]
+
+	return top, nil
+}
+
+func (vm *engine) popNum() (int64, error) {
+	data, err := vm.pop()
+	if err != nil {
+		return 0, err
+	}
+
+	return decodeNum(data, maxNumSize)
+}
+
+func (vm *engine) peek() ([]byte, error) {
+	if len(vm.stack) == 0 {
+		return nil, ErrStackUnderflow
+	}
+
+	return vm.stack[len(vm.stack)-1], nil
+}
+
+// verify pops the result of a VERIFY opcode and fails when it is false
+func (vm *engine) verify() error {
+	top, err := vm.pop()
+	if err != nil {
+		return err
+	}
+	if !asBool(top) {
+		return ErrVerifyFailed
+	}
+
+	return nil
+}
+
+// Hash160 function that returns RIPEMD160(SHA256(data)), the hash of public
+// keys and redeem scripts in locking scripts
+func Hash160(data []byte) []byte {
+	hash := sha256.Sum256(data)
+
+	hasher := ripemd160.New()
+	hasher.Write(hash[:]) // writing to a hash never returns an error
+
+	return hasher.Sum(nil)
+}
+
+// asBool tells whether a stack element is true, any non zero value other
+// than negative zero is
+func asBool(data []byte) bool {
+	for i, b := range data {
+		if b != 0 {
+			// negative zero is the sign bit alone in the last byte
+			return !(i == len(data)-1 && b == 0x80)
+		}
+	}
+
+	return false
+}
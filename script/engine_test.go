@@ -0,0 +1,278 @@
+package script
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// testChecker checks signatures of the SHA-256 of msg and timelocks against
+// fixed values
+type testChecker struct {
+	msg      []byte
+	lockTime int64
+	sequence int64
+}
+
+func (c testChecker) CheckSig(sig, pubKey, subScript []byte) bool {
+	r, s, err := ParseSignature(sig)
+	if err != nil {
+		return false
+	}
+	key, err := ParsePubKey(pubKey)
+	if err != nil {
+		return false
+	}
+	digest := sha256.Sum256(c.msg)
+
+	return ecdsa.Verify(key, digest[:], r, s)
+}
+
+func (c testChecker) CheckLockTime(lockTime int64) bool {
+	return lockTime <= c.lockTime
+}
+
+func (c testChecker) CheckSequence(sequence int64) bool {
+	return sequence <= c.sequence
+}
+
+var checker = testChecker{msg: []byte("spending transaction")}
+
+type testKey struct {
+	private *ecdsa.PrivateKey
+	pubKey  []byte
+}
+
+func newTestKey(t *testing.T) testKey {
+	t.Helper()
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testKey{private, EncodePubKey(&private.PublicKey)}
+}
+
+func (k testKey) sign(t *testing.T, msg []byte) []byte {
+	t.Helper()
+
+	digest := sha256.Sum256(msg)
+	r, s, err := ecdsa.Sign(rand.Reader, k.private, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return EncodeSignature(r, s)
+}
+
+func TestHash160(t *testing.T) {
+	want := "b472a266d0bd89c13706a4132ccfb16f7c3b9fcb"
+	if got := hex.EncodeToString(Hash160(nil)); got != want {
+		t.Fatalf("Hash160 of nothing is %s, want %s", got, want)
+	}
+}
+
+func TestPayToPubKeyHash(t *testing.T) {
+	key, other := newTestKey(t), newTestKey(t)
+	pkScript := PayToPubKeyHash(Hash160(key.pubKey))
+
+	if hash, ok := ExtractPubKeyHash(pkScript); !ok || !bytes.Equal(hash, Hash160(key.pubKey)) {
+		t.Fatalf("pay to pubkey hash script %s does not give back its hash", Disassemble(pkScript))
+	}
+
+	sig := key.sign(t, checker.msg)
+	if err := Execute(SignatureScript(sig, key.pubKey), pkScript, checker); err != nil {
+		t.Fatalf("signed spend failed: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		sigScript []byte
+		err       error
+	}{
+		{"another key", SignatureScript(other.sign(t, checker.msg), other.pubKey), ErrVerifyFailed},
+		{"signature of another message", SignatureScript(key.sign(t, []byte("other")), key.pubKey), ErrScriptFailed},
+		{"signature of another key", SignatureScript(other.sign(t, checker.msg), key.pubKey), ErrScriptFailed},
+		{"empty signature", SignatureScript(nil, key.pubKey), ErrScriptFailed},
+		{"truncated signature", SignatureScript(sig[:SignatureSize-1], key.pubKey), ErrSignatureEncoding},
+		{"uncompressed public key", SignatureScript(sig,
+			elliptic.Marshal(elliptic.P256(), key.private.X, key.private.Y)), ErrVerifyFailed},
+		{"no public key", NewBuilder().AddData(sig).Script(), ErrVerifyFailed},
+		{"nothing", nil, ErrStackUnderflow},
+		{"not push only", append(SignatureScript(sig, key.pubKey), OP_DROP), ErrNotPushOnly},
+	}
+	for _, test := range tests {
+		if err := Execute(test.sigScript, pkScript, checker); !errors.Is(err, test.err) {
+			t.Errorf("%s: Execute returned %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestPayToScriptHash(t *testing.T) {
+	secret := []byte("preimage")
+	hash := sha256.Sum256(secret)
+	redeemScript := NewBuilder().AddOp(OP_SHA256).AddData(hash[:]).AddOp(OP_EQUAL).Script()
+	pkScript := PayToScriptHash(Hash160(redeemScript))
+
+	if scriptHash, ok := ExtractScriptHash(pkScript); !ok || !bytes.Equal(scriptHash, Hash160(redeemScript)) {
+		t.Fatalf("pay to script hash script %s does not give back its hash", Disassemble(pkScript))
+	}
+	if IsPayToScriptHash(PayToPubKeyHash(Hash160(redeemScript))) {
+		t.Fatal("pay to pubkey hash script is taken for pay to script hash")
+	}
+
+	spend := NewBuilder().AddData(secret).AddData(redeemScript).Script()
+	if err := Execute(spend, pkScript, checker); err != nil {
+		t.Fatalf("spend with the preimage failed: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		sigScript []byte
+		err       error
+	}{
+		// the hash matches, so only running the redeem script catches it
+		{"wrong preimage", NewBuilder().AddData([]byte("guess")).AddData(redeemScript).Script(), ErrScriptFailed},
+		{"another redeem script", NewBuilder().AddData(secret).AddData([]byte{OP_1}).Script(), ErrScriptFailed},
+		{"no redeem script", nil, ErrStackUnderflow},
+	}
+	for _, test := range tests {
+		if err := Execute(test.sigScript, pkScript, checker); !errors.Is(err, test.err) {
+			t.Errorf("%s: Execute returned %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestExecuteOpcodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		pkScript []byte
+		err      error
+	}{
+		{"true", []byte{OP_1}, nil},
+		{"false", []byte{OP_0}, ErrScriptFailed},
+		{"empty", nil, ErrScriptFailed},
+		{"negative zero", NewBuilder().AddData([]byte{0x80}).Script(), ErrScriptFailed},
+		{"negative one", []byte{OP_1NEGATE}, nil},
+		{"nop", []byte{OP_1, OP_NOP}, nil},
+		{"dup equal", []byte{OP_16, OP_DUP, OP_EQUAL}, nil},
+		{"not equal", []byte{OP_16, OP_1, OP_EQUAL}, ErrScriptFailed},
+		{"equal verify", []byte{OP_16, OP_1, OP_EQUALVERIFY, OP_1}, ErrVerifyFailed},
+		{"verify", []byte{OP_1, OP_VERIFY}, ErrScriptFailed},
+		{"verify false", []byte{OP_0, OP_VERIFY, OP_1}, ErrVerifyFailed},
+		{"drop", []byte{OP_1, OP_0, OP_DROP}, nil},
+		{"drop underflow", []byte{OP_DROP}, ErrStackUnderflow},
+		{"dup underflow", []byte{OP_DUP}, ErrStackUnderflow},
+		{"return", []byte{OP_1, OP_RETURN}, ErrBadOpcode},
+		{"unknown opcode", []byte{OP_1, 0xff}, ErrBadOpcode},
+		{"push past the end", []byte{5, 1, 2}, ErrMalformed},
+		{"pushdata1 past the end", []byte{OP_PUSHDATA1}, ErrMalformed},
+		{"push too large", NewBuilder().AddData(make([]byte, MaxPushSize+1)).Script(), ErrScriptLimits},
+		{"script too large", append(bytes.Repeat([]byte{OP_NOP}, MaxScriptSize), OP_1), ErrScriptLimits},
+		{"too many opcodes", append([]byte{OP_1}, bytes.Repeat([]byte{OP_NOP}, MaxOps+1)...), ErrScriptLimits},
+		{"stack too large", bytes.Repeat([]byte{OP_1}, MaxStackSize+1), ErrScriptLimits},
+	}
+
+	for _, test := range tests {
+		if err := Execute(nil, test.pkScript, checker); !errors.Is(err, test.err) {
+			t.Errorf("%s: Execute(%s) returned %v, want %v", test.name, Disassemble(test.pkScript), err, test.err)
+		}
+	}
+}
+
+func TestNumEncoding(t *testing.T) {
+	tests := []struct {
+		n       int64
+		encoded string
+	}{
+		{0, ""},
+		{1, "01"},
+		{-1, "81"},
+		{127, "7f"},
+		{128, "8000"},
+		{-128, "8080"},
+		{255, "ff00"},
+		{256, "0001"},
+		{-256, "0081"},
+		{0x7fffffff, "ffffff7f"},
+		{0xffffffff, "ffffffff00"},
+	}
+
+	for _, test := range tests {
+		encoded := encodeNum(test.n)
+		if hex.EncodeToString(encoded) != test.encoded {
+			t.Errorf("encodeNum(%d) = %x, want %s", test.n, encoded, test.encoded)
+		}
+		n, err := decodeNum(encoded, lockTimeNumSize)
+		if err != nil || n != test.n {
+			t.Errorf("decodeNum(%x) = %d, %v, want %d", encoded, n, err, test.n)
+		}
+	}
+
+	if _, err := decodeNum(encodeNum(0xffffffff), maxNumSize); !errors.Is(err, ErrMalformed) {
+		t.Errorf("decoding a 5 byte number as at most 4 bytes returned %v", err)
+	}
+}
+
+func TestBuilderPushes(t *testing.T) {
+	for _, size := range []int{0, 1, int(OP_PUSHDATA1) - 1, int(OP_PUSHDATA1), 0xff, 0x100, MaxPushSize} {
+		data := bytes.Repeat([]byte{0xab}, size)
+		pushed, err := PushedData(NewBuilder().AddData(data).Script())
+		if err != nil {
+			t.Fatalf("push of %d bytes: %v", size, err)
+		}
+		if len(pushed) != 1 || !bytes.Equal(pushed[0], data) {
+			t.Errorf("push of %d bytes gives back %d bytes", size, len(pushed[0]))
+		}
+	}
+
+	for _, n := range []int64{-1, 0, 1, 16, 17, 1000} {
+		pushed, err := PushedData(NewBuilder().AddInt64(n).Script())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := decodeNum(pushed[0], maxNumSize); err != nil || got != n {
+			t.Errorf("push of %d gives back %d, %v", n, got, err)
+		}
+	}
+
+	if IsPushOnly([]byte{OP_1, OP_DUP}) {
+		t.Error("script with OP_DUP is taken for push only")
+	}
+	if _, err := PushedData([]byte{OP_1, OP_DUP}); !errors.Is(err, ErrMalformed) {
+		t.Errorf("PushedData of a script with OP_DUP returned %v", err)
+	}
+}
+
+func TestTimeLockOpcodes(t *testing.T) {
+	c := testChecker{lockTime: 100, sequence: 5}
+
+	tests := []struct {
+		name     string
+		pkScript []byte
+		err      error
+	}{
+		{"lock time reached", NewBuilder().AddInt64(100).AddOp(OP_CHECKLOCKTIMEVERIFY).Script(), nil},
+		{"lock time ahead", NewBuilder().AddInt64(101).AddOp(OP_CHECKLOCKTIMEVERIFY).Script(), ErrUnsatisfiedLockTime},
+		{"negative lock time", NewBuilder().AddInt64(-1).AddOp(OP_CHECKLOCKTIMEVERIFY).Script(), ErrUnsatisfiedLockTime},
+		{"lock time of 5 bytes", NewBuilder().AddInt64(0xffffffff).AddOp(OP_CHECKLOCKTIMEVERIFY).Script(), ErrUnsatisfiedLockTime},
+		{"lock time of 6 bytes", NewBuilder().AddInt64(0xffffffffff).AddOp(OP_CHECKLOCKTIMEVERIFY).Script(), ErrMalformed},
+		{"no lock time", []byte{OP_CHECKLOCKTIMEVERIFY}, ErrStackUnderflow},
+		{"sequence reached", NewBuilder().AddInt64(5).AddOp(OP_CHECKSEQUENCEVERIFY).Script(), nil},
+		{"sequence ahead", NewBuilder().AddInt64(6).AddOp(OP_CHECKSEQUENCEVERIFY).Script(), ErrUnsatisfiedLockTime},
+		// the lock stays on the stack for the rest of the script
+		{"lock dropped", NewBuilder().AddInt64(5).AddOp(OP_CHECKSEQUENCEVERIFY).AddOp(OP_DROP).Script(), ErrScriptFailed},
+	}
+
+	for _, test := range tests {
+		if err := Execute(nil, test.pkScript, c); !errors.Is(err, test.err) {
+			t.Errorf("%s: Execute(%s) returned %v, want %v", test.name, Disassemble(test.pkScript), err, test.err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package script
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"math/big"
+)
+
+const (
+	// SignatureSize is the size of a signature, r and s as 32 byte big endian numbers
+	SignatureSize = 64
+	// PubKeySize is the size of a public key in SEC1 compressed form
+	PubKeySize = 33
+)
+
+var (
+	// ErrSignatureEncoding error when a signature is not 64 bytes with a low s
+	ErrSignatureEncoding = errors.New("Signature is not canonically encoded")
+	// ErrPubKeyEncoding error when a public key is not a compressed point on the curve
+	ErrPubKeyEncoding = errors.New("Public key is not canonically encoded")
+)
+
+// curve is P256, the curve of every key
+var curve = elliptic.P256()
+
+// halfOrder is the largest s of a canonical signature, (r, s) and (r, N-s)
+// are both valid so only the lower one is accepted
+var halfOrder = new(big.Int).Rsh(curve.Params().N, 1)
+
+// EncodeSignature function that returns the canonical encoding of the
+// signature r and s, an s above half the order is replaced by N-s
+func EncodeSignature(r, s *big.Int) []byte {
+	if s.Cmp(halfOrder) > 0 {
+		s = new(big.Int).Sub(curve.Params().N, s)
+	}
+
+	sig := make([]byte, SignatureSize)
+	r.FillBytes(sig[:SignatureSize/2])
+	s.FillBytes(sig[SignatureSize/2:])
+
+	return sig
+}
+
+// ParseSignature function that returns r and s of a canonically encoded signature
+func ParseSignature(sig []byte) (r, s *big.Int, err error) {
+	if len(sig) != SignatureSize {
+		return nil, nil, ErrSignatureEncoding
+	}
+
+	r = new(big.Int).SetBytes(sig[:SignatureSize/2])
+	s = new(big.Int).SetBytes(sig[SignatureSize/2:])
+	if r.Sign() == 0 || r.Cmp(curve.Params().N) >= 0 || s.Sign() == 0 || s.Cmp(halfOrder) > 0 {
+		return nil, nil, ErrSignatureEncoding
+	}
+
+	return r, s, nil
+}
+
+// EncodePubKey function that returns the SEC1 compressed form of a public key
+func EncodePubKey(pubKey *ecdsa.PublicKey) []byte {
+	return elliptic.MarshalCompressed(curve, pubKey.X, pubKey.Y)
+}
+
+// ParsePubKey function that returns the public key of its SEC1 compressed
+// form, the point must be on the curve
+func ParsePubKey(data []byte) (*ecdsa.PublicKey, error) {
+	if len(data) != PubKeySize {
+		return nil, ErrPubKeyEncoding
+	}
+
+	x, y := elliptic.UnmarshalCompressed(curve, data)
+	if x == nil {
+		return nil, ErrPubKeyEncoding
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// checkSigEncoding fails for a signature that is neither empty, which makes
+// a signature check false, nor canonical
+func checkSigEncoding(sig []byte) error {
+	if len(sig) == 0 {
+		return nil
+	}
+	_, _, err := ParseSignature(sig)
+
+	return err
+}
+
+func checkPubKeyEncoding(pubKey []byte) error {
+	_, err := ParsePubKey(pubKey)
+
+	return err
+}
@@ -0,0 +1,121 @@
+package script
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestEncodeSignature(t *testing.T) {
+	n := curve.Params().N
+	highS := new(big.Int).Sub(n, big.NewInt(5))
+
+	sig := EncodeSignature(big.NewInt(1), highS)
+	if len(sig) != SignatureSize {
+		t.Fatalf("signature of a small r has %d bytes, want %d", len(sig), SignatureSize)
+	}
+	want := append(append(make([]byte, 31), 1), append(make([]byte, 31), 5)...)
+	if !bytes.Equal(sig, want) {
+		t.Fatalf("signature is %x, want %x with s replaced by n-s", sig, want)
+	}
+
+	r, s, err := ParseSignature(sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Int64() != 1 || s.Int64() != 5 {
+		t.Fatalf("signature parses to (%v, %v)", r, s)
+	}
+
+	// half the order is the largest s kept as it is
+	if _, s, err := ParseSignature(EncodeSignature(big.NewInt(1), halfOrder)); err != nil || s.Cmp(halfOrder) != 0 {
+		t.Fatalf("s of half the order parses to %v, %v", s, err)
+	}
+}
+
+func TestParseSignatureRejects(t *testing.T) {
+	n := curve.Params().N
+	encode := func(r, s *big.Int) []byte {
+		sig := make([]byte, SignatureSize)
+		r.FillBytes(sig[:SignatureSize/2])
+		s.FillBytes(sig[SignatureSize/2:])
+		return sig
+	}
+	one := big.NewInt(1)
+
+	tests := []struct {
+		name string
+		sig  []byte
+	}{
+		{"empty", nil},
+		{"short", make([]byte, SignatureSize-1)},
+		{"long", append(encode(one, one), 0)},
+		{"high s", encode(one, new(big.Int).Add(halfOrder, one))},
+		{"zero r", encode(new(big.Int), one)},
+		{"zero s", encode(one, new(big.Int))},
+		{"r of the order", encode(n, one)},
+	}
+	for _, test := range tests {
+		if _, _, err := ParseSignature(test.sig); !errors.Is(err, ErrSignatureEncoding) {
+			t.Errorf("%s: ParseSignature returned %v", test.name, err)
+		}
+	}
+}
+
+func TestHighSSignatureFails(t *testing.T) {
+	key := newTestKey(t)
+	pkScript := PayToPubKeyHash(Hash160(key.pubKey))
+
+	sig := key.sign(t, checker.msg)
+	r, s, err := ParseSignature(sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the other valid form of the same signature
+	highS := make([]byte, SignatureSize)
+	r.FillBytes(highS[:SignatureSize/2])
+	new(big.Int).Sub(curve.Params().N, s).FillBytes(highS[SignatureSize/2:])
+	digest := sha256.Sum256(checker.msg)
+	if !ecdsa.Verify(&key.private.PublicKey, digest[:], r, new(big.Int).SetBytes(highS[SignatureSize/2:])) {
+		t.Fatal("high s form does not verify")
+	}
+
+	if err := Execute(SignatureScript(highS, key.pubKey), pkScript, checker); !errors.Is(err, ErrSignatureEncoding) {
+		t.Fatalf("spend with a high s signature returned %v", err)
+	}
+}
+
+func TestPubKeyEncoding(t *testing.T) {
+	key := newTestKey(t)
+	if len(key.pubKey) != PubKeySize {
+		t.Fatalf("public key has %d bytes, want %d", len(key.pubKey), PubKeySize)
+	}
+
+	parsed, err := ParsePubKey(key.pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.X.Cmp(key.private.X) != 0 || parsed.Y.Cmp(key.private.Y) != 0 {
+		t.Fatal("public key does not parse to the same point")
+	}
+
+	tests := []struct {
+		name   string
+		pubKey []byte
+	}{
+		{"empty", nil},
+		{"uncompressed", elliptic.Marshal(curve, key.private.X, key.private.Y)},
+		{"bad prefix", append([]byte{0x04}, key.pubKey[1:]...)},
+		{"truncated", key.pubKey[:PubKeySize-1]},
+	}
+	for _, test := range tests {
+		if _, err := ParsePubKey(test.pubKey); !errors.Is(err, ErrPubKeyEncoding) {
+			t.Errorf("%s: ParsePubKey returned %v", test.name, err)
+		}
+	}
+}
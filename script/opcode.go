@@ -0,0 +1,69 @@
+package script
+
+import "fmt"
+
+// Opcodes of the script language, the values follow Bitcoin script so
+// disassembled scripts read the same, opcodes 0x01 to 0x4b push that many bytes
+const (
+	OP_0         byte = 0x00
+	OP_PUSHDATA1 byte = 0x4c
+	OP_PUSHDATA2 byte = 0x4d
+	OP_1NEGATE   byte = 0x4f
+	OP_1         byte = 0x51
+	OP_16        byte = 0x60
+
+	OP_NOP    byte = 0x61
+	OP_VERIFY byte = 0x69
+	OP_RETURN byte = 0x6a
+
+	OP_DROP byte = 0x75
+	OP_DUP  byte = 0x76
+
+	OP_EQUAL       byte = 0x87
+	OP_EQUALVERIFY byte = 0x88
+
+	OP_SHA256         byte = 0xa8
+	OP_HASH160        byte = 0xa9
+	OP_CHECKSIG       byte = 0xac
+	OP_CHECKSIGVERIFY byte = 0xad
+
+	OP_CHECKMULTISIG       byte = 0xae
+	OP_CHECKMULTISIGVERIFY byte = 0xaf
+
+	OP_CHECKLOCKTIMEVERIFY byte = 0xb1
+	OP_CHECKSEQUENCEVERIFY byte = 0xb2
+)
+
+var opcodeNames = map[byte]string{
+	OP_0:         "OP_0",
+	OP_PUSHDATA1: "OP_PUSHDATA1",
+	OP_PUSHDATA2: "OP_PUSHDATA2",
+	OP_1NEGATE:   "OP_1NEGATE",
+
+	OP_NOP:    "OP_NOP",
+	OP_VERIFY: "OP_VERIFY",
+	OP_RETURN: "OP_RETURN",
+
+	OP_DROP: "OP_DROP",
+	OP_DUP:  "OP_DUP",
+
+	OP_EQUAL:       "OP_EQUAL",
+	OP_EQUALVERIFY: "OP_EQUALVERIFY",
+
+	OP_SHA256:         "OP_SHA256",
+	OP_HASH160:        "OP_HASH160",
+	OP_CHECKSIG:       "OP_CHECKSIG",
+	OP_CHECKSIGVERIFY: "OP_CHECKSIGVERIFY",
+
+	OP_CHECKMULTISIG:       "OP_CHECKMULTISIG",
+	OP_CHECKMULTISIGVERIFY: "OP_CHECKMULTISIGVERIFY",
+
+	OP_CHECKLOCKTIMEVERIFY: "OP_CHECKLOCKTIMEVERIFY",
+	OP_CHECKSEQUENCEVERIFY: "OP_CHECKSEQUENCEVERIFY",
+}
+
+func init() {
+	for op := OP_1; op <= OP_16; op++ {
+		opcodeNames[op] = fmt.Sprintf("OP_%d", op-OP_1+1)
+	}
+}
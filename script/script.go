@@ -0,0 +1,257 @@
+package script
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// MaxScriptSize is the largest script the engine runs
+	MaxScriptSize = 10000
+	// MaxPushSize is the largest element a script may push
+	MaxPushSize = 520
+	// maxNumSize is the largest number in bytes that opcodes taking a number accept
+	maxNumSize = 4
+	// lockTimeNumSize is the largest number in bytes of the timelock opcodes,
+	// lock times and sequences use all 32 bits without a sign
+	lockTimeNumSize = 5
+)
+
+// ErrMalformed error when a push runs past the end of a script
+var ErrMalformed = errors.New("Script is malformed")
+
+// token is an opcode of a parsed script with the data it pushes
+type token struct {
+	op   byte
+	data []byte
+}
+
+// parse function to split a script into its opcodes
+func parse(script []byte) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(script); {
+		op := script[i]
+		i++
+
+		var size int
+		switch {
+		case op > OP_0 && op < OP_PUSHDATA1:
+			size = int(op)
+		case op == OP_PUSHDATA1:
+			if i+1 > len(script) {
+				return nil, ErrMalformed
+			}
+			size = int(script[i])
+			i++
+		case op == OP_PUSHDATA2:
+			if i+2 > len(script) {
+				return nil, ErrMalformed
+			}
+			size = int(binary.LittleEndian.Uint16(script[i:]))
+			i += 2
+		default:
+			tokens = append(tokens, token{op, nil})
+			continue
+		}
+
+		if i+size > len(script) {
+			return nil, ErrMalformed
+		}
+		tokens = append(tokens, token{op, script[i : i+size]})
+		i += size
+	}
+
+	return tokens, nil
+}
+
+// isPush tells whether the opcode only pushes onto the stack
+func (t token) isPush() bool {
+	return t.op <= OP_PUSHDATA2 || t.op == OP_1NEGATE || (t.op >= OP_1 && t.op <= OP_16)
+}
+
+// IsPushOnly function that tells whether a script does nothing but push data,
+// unlocking scripts must be push only
+func IsPushOnly(script []byte) bool {
+	tokens, err := parse(script)
+	if err != nil {
+		return false
+	}
+
+	for _, t := range tokens {
+		if !t.isPush() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// PushedData function that returns the data a push only script pushes
+func PushedData(script []byte) ([][]byte, error) {
+	tokens, err := parse(script)
+	if err != nil {
+		return nil, err
+	}
+
+	var data [][]byte
+	for _, t := range tokens {
+		if !t.isPush() {
+			return nil, fmt.Errorf("%w: %s is not a push", ErrMalformed, opcodeName(t.op))
+		}
+		data = append(data, pushValue(t))
+	}
+
+	return data, nil
+}
+
+func pushValue(t token) []byte {
+	switch {
+	case t.op == OP_1NEGATE:
+		return encodeNum(-1)
+	case t.op >= OP_1 && t.op <= OP_16:
+		return encodeNum(int64(t.op - OP_1 + 1))
+	default:
+		return t.data
+	}
+}
+
+func opcodeName(op byte) string {
+	if name, ok := opcodeNames[op]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("OP_UNKNOWN%d", op)
+}
+
+// Disassemble function that returns a script as readable opcodes, pushed
+// data is shown in hex
+func Disassemble(script []byte) string {
+	tokens, err := parse(script)
+
+	var parts []string
+	for _, t := range tokens {
+		if t.op > OP_0 && t.op <= OP_PUSHDATA2 {
+			parts = append(parts, hex.EncodeToString(t.data))
+			continue
+		}
+		parts = append(parts, opcodeName(t.op))
+	}
+	if err != nil {
+		parts = append(parts, "[error]")
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Builder structure to write a script opcode by opcode
+type Builder struct {
+	script []byte
+}
+
+// NewBuilder function to start an empty script
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// AddOp method to append an opcode
+func (b *Builder) AddOp(op byte) *Builder {
+	b.script = append(b.script, op)
+
+	return b
+}
+
+// AddData method to append the smallest push of data
+func (b *Builder) AddData(data []byte) *Builder {
+	size := len(data)
+	switch {
+	case size == 0:
+		b.script = append(b.script, OP_0)
+	case size < int(OP_PUSHDATA1):
+		b.script = append(b.script, byte(size))
+	case size <= 0xff:
+		b.script = append(b.script, OP_PUSHDATA1, byte(size))
+	default:
+		var buf [2]byte
+		binary.LittleEndian.PutUint16(buf[:], uint16(size))
+		b.script = append(b.script, OP_PUSHDATA2, buf[0], buf[1])
+	}
+	b.script = append(b.script, data...)
+
+	return b
+}
+
+// AddInt64 method to append the push of a number, small numbers use their own opcode
+func (b *Builder) AddInt64(n int64) *Builder {
+	switch {
+	case n == 0:
+		return b.AddOp(OP_0)
+	case n == -1:
+		return b.AddOp(OP_1NEGATE)
+	case n >= 1 && n <= 16:
+		return b.AddOp(OP_1 + byte(n-1))
+	default:
+		return b.AddData(encodeNum(n))
+	}
+}
+
+// Script method that returns the script built so far
+func (b *Builder) Script() []byte {
+	return b.script
+}
+
+// encodeNum encodes a number as script does, little endian with the sign in
+// the highest bit of the last byte
+func encodeNum(n int64) []byte {
+	if n == 0 {
+		return nil
+	}
+
+	negative := n < 0
+	if negative {
+		n = -n
+	}
+
+	var result []byte
+	for n > 0 {
+		result = append(result, byte(n&0xff))
+		n >>= 8
+	}
+
+	if result[len(result)-1]&0x80 != 0 {
+		extra := byte(0x00)
+		if negative {
+			extra = 0x80
+		}
+		result = append(result, extra)
+	} else if negative {
+		result[len(result)-1] |= 0x80
+	}
+
+	return result
+}
+
+// decodeNum decodes a number pushed by a script, it must fit in size bytes
+func decodeNum(data []byte, size int) (int64, error) {
+	if len(data) > size {
+		return 0, fmt.Errorf("%w: number of %d bytes is too long", ErrMalformed, len(data))
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	var n int64
+	for i, b := range data {
+		n |= int64(b) << uint(8*i)
+	}
+
+	if data[len(data)-1]&0x80 != 0 {
+		n &= ^(int64(0x80) << uint(8*(len(data)-1)))
+		n = -n
+	}
+
+	return n, nil
+}
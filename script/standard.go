@@ -0,0 +1,145 @@
+package script
+
+import "fmt"
+
+// pubKeyHashLength is the size of the hashes pay to pubkey hash and pay to
+// script hash scripts lock to
+const pubKeyHashLength = 20
+
+// PayToPubKeyHash function that returns the standard locking script paying
+// to the owner of the public key with the hash pubKeyHash:
+// OP_DUP OP_HASH160 <pubKeyHash> OP_EQUALVERIFY OP_CHECKSIG
+func PayToPubKeyHash(pubKeyHash []byte) []byte {
+	return NewBuilder().
+		AddOp(OP_DUP).
+		AddOp(OP_HASH160).
+		AddData(pubKeyHash).
+		AddOp(OP_EQUALVERIFY).
+		AddOp(OP_CHECKSIG).
+		Script()
+}
+
+// ExtractPubKeyHash function that returns the hash a pay to pubkey hash
+// script locks to, ok is false for any other script
+func ExtractPubKeyHash(pkScript []byte) (pubKeyHash []byte, ok bool) {
+	tokens, err := parse(pkScript)
+	if err != nil || len(tokens) != 5 {
+		return nil, false
+	}
+
+	if tokens[0].op != OP_DUP || tokens[1].op != OP_HASH160 ||
+		tokens[2].op != pubKeyHashLength || tokens[3].op != OP_EQUALVERIFY ||
+		tokens[4].op != OP_CHECKSIG {
+		return nil, false
+	}
+
+	return tokens[2].data, true
+}
+
+// SignatureScript function that returns the unlocking script of a pay to
+// pubkey hash output: <sig> <pubKey>
+func SignatureScript(sig, pubKey []byte) []byte {
+	return NewBuilder().AddData(sig).AddData(pubKey).Script()
+}
+
+// PayToScriptHash function that returns the locking script paying to whoever
+// reveals the redeem script with the hash scriptHash and satisfies it:
+// OP_HASH160 <scriptHash> OP_EQUAL
+func PayToScriptHash(scriptHash []byte) []byte {
+	return NewBuilder().
+		AddOp(OP_HASH160).
+		AddData(scriptHash).
+		AddOp(OP_EQUAL).
+		Script()
+}
+
+// ExtractScriptHash function that returns the hash a pay to script hash
+// script locks to, ok is false for any other script
+func ExtractScriptHash(pkScript []byte) (scriptHash []byte, ok bool) {
+	tokens, err := parse(pkScript)
+	if err != nil || len(tokens) != 3 {
+		return nil, false
+	}
+
+	if tokens[0].op != OP_HASH160 || tokens[1].op != pubKeyHashLength || tokens[2].op != OP_EQUAL {
+		return nil, false
+	}
+
+	return tokens[1].data, true
+}
+
+// IsPayToScriptHash function that tells whether a script is a pay to script hash script
+func IsPayToScriptHash(pkScript []byte) bool {
+	_, ok := ExtractScriptHash(pkScript)
+
+	return ok
+}
+
+// MultiSigScript function that returns the redeem script that needs
+// signatures of m of the public keys: m <pubKey>... n OP_CHECKMULTISIG
+func MultiSigScript(m int, pubKeys [][]byte) ([]byte, error) {
+	if len(pubKeys) < 1 || len(pubKeys) > MaxMultiSigKeys {
+		return nil, fmt.Errorf("A multisig script takes 1 to %d public keys, got %d", MaxMultiSigKeys, len(pubKeys))
+	}
+	if m < 1 || m > len(pubKeys) {
+		return nil, fmt.Errorf("A multisig script needs 1 to %d signatures, got %d", len(pubKeys), m)
+	}
+	for _, pubKey := range pubKeys {
+		if err := checkPubKeyEncoding(pubKey); err != nil {
+			return nil, fmt.Errorf("%w: %x", err, pubKey)
+		}
+	}
+
+	b := NewBuilder().AddInt64(int64(m))
+	for _, pubKey := range pubKeys {
+		b.AddData(pubKey)
+	}
+
+	redeemScript := b.AddInt64(int64(len(pubKeys))).AddOp(OP_CHECKMULTISIG).Script()
+	// the unlocking script has to push the whole redeem script
+	if len(redeemScript) > MaxPushSize {
+		return nil, fmt.Errorf("%w: redeem script of %d bytes", ErrScriptLimits, len(redeemScript))
+	}
+
+	return redeemScript, nil
+}
+
+// ExtractMultiSig function that returns the number of signatures and the
+// public keys of a multisig script, ok is false for any other script
+func ExtractMultiSig(redeemScript []byte) (m int, pubKeys [][]byte, ok bool) {
+	tokens, err := parse(redeemScript)
+	if err != nil || len(tokens) < 4 || tokens[len(tokens)-1].op != OP_CHECKMULTISIG {
+		return 0, nil, false
+	}
+
+	first, last := tokens[0], tokens[len(tokens)-2]
+	if first.op < OP_1 || first.op > OP_16 || last.op < OP_1 || last.op > OP_16 {
+		return 0, nil, false
+	}
+	m, n := int(first.op-OP_1+1), int(last.op-OP_1+1)
+
+	keys := tokens[1 : len(tokens)-2]
+	if n != len(keys) || m > n {
+		return 0, nil, false
+	}
+	for _, key := range keys {
+		if key.op == OP_0 || key.op > OP_PUSHDATA2 {
+			return 0, nil, false
+		}
+		pubKeys = append(pubKeys, key.data)
+	}
+
+	return m, pubKeys, true
+}
+
+// MultiSigSignatureScript function that returns the unlocking script of a pay to
+// script hash output with a multisig redeem script: <sig>... <redeemScript>,
+// the signatures must be in the order of their public keys
+func MultiSigSignatureScript(sigs [][]byte, redeemScript []byte) []byte {
+	b := NewBuilder()
+	for _, sig := range sigs {
+		b.AddData(sig)
+	}
+
+	return b.AddData(redeemScript).Script()
+}
@@ -0,0 +1,80 @@
+package script
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestMultiSig(t *testing.T) {
+	keys := []testKey{newTestKey(t), newTestKey(t), newTestKey(t)}
+	pubKeys := [][]byte{keys[0].pubKey, keys[1].pubKey, keys[2].pubKey}
+
+	redeemScript, err := MultiSigScript(2, pubKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, extracted, ok := ExtractMultiSig(redeemScript)
+	if !ok || m != 2 || len(extracted) != 3 {
+		t.Fatalf("multisig script %s gives back %d of %d keys", Disassemble(redeemScript), m, len(extracted))
+	}
+	for i := range pubKeys {
+		if !bytes.Equal(extracted[i], pubKeys[i]) {
+			t.Errorf("key %d is %x, want %x", i, extracted[i], pubKeys[i])
+		}
+	}
+
+	pkScript := PayToScriptHash(Hash160(redeemScript))
+	sigs := make([][]byte, len(keys))
+	for i, key := range keys {
+		sigs[i] = key.sign(t, checker.msg)
+	}
+
+	tests := []struct {
+		name string
+		sigs [][]byte
+		err  error
+	}{
+		{"first and second", [][]byte{sigs[0], sigs[1]}, nil},
+		{"first and last", [][]byte{sigs[0], sigs[2]}, nil},
+		{"out of key order", [][]byte{sigs[2], sigs[0]}, ErrScriptFailed},
+		{"same signature twice", [][]byte{sigs[1], sigs[1]}, ErrScriptFailed},
+		{"one signature", [][]byte{sigs[1]}, ErrStackUnderflow},
+		{"one signature and an empty one", [][]byte{nil, sigs[1]}, ErrScriptFailed},
+	}
+	for _, test := range tests {
+		err := Execute(MultiSigSignatureScript(test.sigs, redeemScript), pkScript, checker)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: Execute returned %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestMultiSigScriptRejects(t *testing.T) {
+	key := newTestKey(t)
+	var tooMany [][]byte
+	for i := 0; i <= MaxMultiSigKeys; i++ {
+		tooMany = append(tooMany, key.pubKey)
+	}
+
+	tests := []struct {
+		name    string
+		m       int
+		pubKeys [][]byte
+	}{
+		{"no keys", 1, nil},
+		{"no signatures", 0, [][]byte{key.pubKey}},
+		{"more signatures than keys", 2, [][]byte{key.pubKey}},
+		{"too many keys", 1, tooMany},
+		{"bad key", 1, [][]byte{key.pubKey[1:]}},
+	}
+	for _, test := range tests {
+		if _, err := MultiSigScript(test.m, test.pubKeys); err == nil {
+			t.Errorf("%s: multisig script was built", test.name)
+		}
+	}
+
+	if _, _, ok := ExtractMultiSig(PayToPubKeyHash(Hash160(key.pubKey))); ok {
+		t.Error("pay to pubkey hash script is taken for a multisig script")
+	}
+}
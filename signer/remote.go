@@ -0,0 +1,241 @@
+package signer
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/shortdaddy0711/golang-blockchain/script"
+)
+
+// The external signer listens on a unix socket. Every request is a line of
+// JSON {"pubkey": hex, "digest": hex} and is answered with a line of JSON
+// {"signature": hex} or {"error": message, "unknownkey": bool}
+
+// remoteTimeout is how long a RemoteSigner waits for an answer
+const remoteTimeout = 30 * time.Second
+
+type signRequest struct {
+	PubKey string `json:"pubkey"`
+	Digest string `json:"digest"`
+}
+
+type signResponse struct {
+	Signature  string `json:"signature,omitempty"`
+	Error      string `json:"error,omitempty"`
+	UnknownKey bool   `json:"unknownkey,omitempty"`
+}
+
+// RemoteSigner structure that asks the signer listening on the unix socket
+// at Path for signatures, so the keys stay in that process
+type RemoteSigner struct {
+	Path string
+}
+
+// NewRemoteSigner function to create a signer talking to the socket at path
+func NewRemoteSigner(path string) *RemoteSigner {
+	return &RemoteSigner{path}
+}
+
+// Sign method to ask the external signer to sign digest with the key of
+// pubKey, the signature it returns must verify
+func (rs *RemoteSigner) Sign(pubKey, digest []byte) ([]byte, error) {
+	key, err := script.ParsePubKey(pubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialTimeout("unix", rs.Path, remoteTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(remoteTimeout)); err != nil {
+		return nil, err
+	}
+
+	request := signRequest{hex.EncodeToString(pubKey), hex.EncodeToString(digest)}
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		return nil, err
+	}
+
+	var response signResponse
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return nil, fmt.Errorf("Reading the answer of the signer: %w", err)
+	}
+	if response.UnknownKey {
+		return nil, fmt.Errorf("%w: %x", ErrUnknownKey, pubKey)
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("Signer at %s: %s", rs.Path, response.Error)
+	}
+
+	sig, err := hex.DecodeString(response.Signature)
+	if err != nil {
+		return nil, err
+	}
+	r, s, err := script.ParseSignature(sig)
+	if err != nil {
+		return nil, err
+	}
+	if !ecdsa.Verify(key, digest, r, s) {
+		return nil, fmt.Errorf("Signer at %s returned a wrong signature", rs.Path)
+	}
+
+	return sig, nil
+}
+
+// ListenAndServe function to answer sign requests with s on the unix socket at
+// path until the process is interrupted, the socket is removed on the way out
+func ListenAndServe(path string, s Signer) error {
+	ln, err := listen(path)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+
+		ln.Close()
+	}()
+
+	return Serve(ln, s)
+}
+
+// listen creates the unix socket at path, only its owner may connect. The
+// socket is bound inside a new directory only the owner can enter and moved to
+// path once its mode is set, so nobody else can reach it in between. A socket
+// left behind by a signer that is gone is replaced, a live one is an error
+func listen(path string) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".signer")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	bound := filepath.Join(dir, "socket")
+	ln, err := net.Listen("unix", bound)
+	if err != nil {
+		return nil, err
+	}
+	// the socket moves, socketListener removes it under its new name
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	if err := os.Chmod(bound, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if err := os.Rename(bound, path); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	return &socketListener{ln, path}, nil
+}
+
+// removeStaleSocket removes the socket at path when no signer answers on it
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("A signer is already listening on %s", path)
+	}
+
+	return os.Remove(path)
+}
+
+// socketListener removes its socket file when it is closed, before the
+// listener so the file is gone once Serve returns
+type socketListener struct {
+	net.Listener
+	path string
+}
+
+func (l *socketListener) Close() error {
+	err := os.Remove(l.path)
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	if closeErr := l.Listener.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Serve function to answer sign requests on ln with s until ln is closed
+func Serve(ln net.Listener, s Signer) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go serveConn(conn, s)
+	}
+}
+
+func serveConn(conn net.Conn, s Signer) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		if err := encoder.Encode(answer(scanner.Bytes(), s)); err != nil {
+			return
+		}
+	}
+}
+
+func answer(line []byte, s Signer) signResponse {
+	var request signRequest
+	if err := json.Unmarshal(line, &request); err != nil {
+		return signResponse{Error: err.Error()}
+	}
+	pubKey, err := hex.DecodeString(request.PubKey)
+	if err != nil {
+		return signResponse{Error: "Public key is not hex encoded"}
+	}
+	digest, err := hex.DecodeString(request.Digest)
+	if err != nil {
+		return signResponse{Error: "Digest is not hex encoded"}
+	}
+
+	sig, err := s.Sign(pubKey, digest)
+	if errors.Is(err, ErrUnknownKey) {
+		return signResponse{Error: err.Error(), UnknownKey: true}
+	}
+	if err != nil {
+		return signResponse{Error: err.Error()}
+	}
+
+	return signResponse{Signature: hex.EncodeToString(sig)}
+}
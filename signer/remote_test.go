@@ -0,0 +1,147 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shortdaddy0711/golang-blockchain/script"
+)
+
+// socketPath returns a socket path in a directory removed after the test,
+// short enough for the limit on unix socket paths
+func socketPath(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return filepath.Join(dir, "sock")
+}
+
+func TestRemoteSigner(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := socketPath(t)
+	ln, err := listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go Serve(ln, NewKeySigner(*key))
+
+	digest := sha256.Sum256([]byte("transaction"))
+	remote := NewRemoteSigner(path)
+
+	sig, err := remote.Sign(script.EncodePubKey(&key.PublicKey), digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := NewKeySigner(*key).Sign(script.EncodePubKey(&key.PublicKey), digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(sig) != string(want) {
+		t.Fatalf("remote signature %x differs from the local one %x", sig, want)
+	}
+
+	_, err = remote.Sign(script.EncodePubKey(&other.PublicKey), digest[:])
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("signing with a key the signer does not hold returned %v", err)
+	}
+}
+
+func TestListenSocketMode(t *testing.T) {
+	path := socketPath(t)
+
+	ln, err := listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0600 {
+		t.Fatalf("socket has mode %v", info.Mode())
+	}
+	entries, err := ioutil.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("listening left %d files next to the socket", len(entries)-1)
+	}
+
+	if err := ln.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Fatalf("socket is still there after closing: %v", err)
+	}
+}
+
+func TestListenReplacesStaleSocket(t *testing.T) {
+	path := socketPath(t)
+
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listen(path)
+	if err != nil {
+		t.Fatalf("listening over a stale socket: %v", err)
+	}
+	ln.Close()
+}
+
+func TestListenRefusesLiveSocket(t *testing.T) {
+	path := socketPath(t)
+
+	ln, err := listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	if second, err := listen(path); err == nil {
+		second.Close()
+		t.Fatal("a second signer took over the socket of a running one")
+	}
+}
+
+func TestListenRefusesOtherFiles(t *testing.T) {
+	path := socketPath(t)
+	if err := ioutil.WriteFile(path, []byte("keep me"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if ln, err := listen(path); err == nil {
+		ln.Close()
+		t.Fatal("listening replaced a regular file")
+	}
+	if content, err := ioutil.ReadFile(path); err != nil || string(content) != "keep me" {
+		t.Fatalf("the file was changed: %q, %v", content, err)
+	}
+}
@@ -0,0 +1,165 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+
+	"github.com/shortdaddy0711/golang-blockchain/script"
+)
+
+// ErrUnknownKey error when a signer does not hold the key of a public key
+var ErrUnknownKey = errors.New("Signer does not hold the key")
+
+// Signer interface for whatever holds the private keys, in this process or
+// in another one, so transactions can be signed without seeing the keys
+type Signer interface {
+	// Sign returns the canonical signature of digest by the key of pubKey, a
+	// compressed public key, or ErrUnknownKey when it does not hold that key
+	Sign(pubKey, digest []byte) ([]byte, error)
+}
+
+// KeySigner structure that signs with private keys in memory, signatures are
+// deterministic as in RFC 6979 so signing needs no randomness
+type KeySigner struct {
+	keys map[string]*ecdsa.PrivateKey
+}
+
+// NewKeySigner function to create a signer holding the given keys
+func NewKeySigner(keys ...ecdsa.PrivateKey) *KeySigner {
+	s := &KeySigner{make(map[string]*ecdsa.PrivateKey)}
+	for i := range keys {
+		key := &keys[i]
+		s.keys[hex.EncodeToString(script.EncodePubKey(&key.PublicKey))] = key
+	}
+
+	return s
+}
+
+// Sign method to sign digest with the key of pubKey
+func (s *KeySigner) Sign(pubKey, digest []byte) ([]byte, error) {
+	key, ok := s.keys[hex.EncodeToString(pubKey)]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	r, sig := signRFC6979(key, digest)
+
+	return script.EncodeSignature(r, sig), nil
+}
+
+// signRFC6979 signs digest with the nonce RFC 6979 derives from the key and
+// the digest, trying the next nonce in the rare case r or s is 0
+func signRFC6979(key *ecdsa.PrivateKey, digest []byte) (r, s *big.Int) {
+	n := key.Curve.Params().N
+	e := hashToInt(digest, n)
+	nonces := newNonceGenerator(key.D, digest, n)
+
+	for {
+		k := nonces.next()
+
+		x, _ := key.Curve.ScalarBaseMult(k.Bytes())
+		r = new(big.Int).Mod(x, n)
+		if r.Sign() == 0 {
+			continue
+		}
+
+		// s = k^-1 * (e + r*d) mod n
+		s = new(big.Int).Mul(r, key.D)
+		s.Add(s, e)
+		s.Mul(s, new(big.Int).ModInverse(k, n))
+		s.Mod(s, n)
+		if s.Sign() != 0 {
+			return r, s
+		}
+	}
+}
+
+// hashToInt returns the leftmost bits of hash, as many as the order n has
+func hashToInt(hash []byte, n *big.Int) *big.Int {
+	orderBits := n.BitLen()
+	orderBytes := (orderBits + 7) / 8
+	if len(hash) > orderBytes {
+		hash = hash[:orderBytes]
+	}
+
+	value := new(big.Int).SetBytes(hash)
+	if excess := len(hash)*8 - orderBits; excess > 0 {
+		value.Rsh(value, uint(excess))
+	}
+
+	return value
+}
+
+// nonceGenerator structure of the HMAC_DRBG state of RFC 6979 section 3.2
+type nonceGenerator struct {
+	k, v  []byte
+	n     *big.Int
+	first bool
+}
+
+func newNonceGenerator(d *big.Int, digest []byte, n *big.Int) *nonceGenerator {
+	size := (n.BitLen() + 7) / 8
+
+	// int2octets of the key and bits2octets of the digest
+	seed := make([]byte, 2*size)
+	d.FillBytes(seed[:size])
+	z := hashToInt(digest, n)
+	if z.Cmp(n) >= 0 {
+		z.Sub(z, n)
+	}
+	z.FillBytes(seed[size:])
+
+	g := &nonceGenerator{
+		k:     make([]byte, sha256.Size),
+		v:     make([]byte, sha256.Size),
+		n:     n,
+		first: true,
+	}
+	for i := range g.v {
+		g.v[i] = 0x01
+	}
+
+	g.k = g.mac(g.k, g.v, []byte{0x00}, seed)
+	g.v = g.mac(g.k, g.v)
+	g.k = g.mac(g.k, g.v, []byte{0x01}, seed)
+	g.v = g.mac(g.k, g.v)
+
+	return g
+}
+
+func (g *nonceGenerator) mac(key []byte, data ...[]byte) []byte {
+	h := hmac.New(sha256.New, key)
+	for _, d := range data {
+		h.Write(d)
+	}
+
+	return h.Sum(nil)
+}
+
+// next returns the next nonce in [1, n-1]
+func (g *nonceGenerator) next() *big.Int {
+	size := (g.n.BitLen() + 7) / 8
+
+	for {
+		if !g.first {
+			g.k = g.mac(g.k, g.v, []byte{0x00})
+			g.v = g.mac(g.k, g.v)
+		}
+		g.first = false
+
+		var t []byte
+		for len(t) < size {
+			g.v = g.mac(g.k, g.v)
+			t = append(t, g.v...)
+		}
+
+		k := hashToInt(t, g.n)
+		if k.Sign() > 0 && k.Cmp(g.n) < 0 {
+			return k
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/shortdaddy0711/golang-blockchain/script"
+)
+
+func mustParseInt(t *testing.T, s string) *big.Int {
+	t.Helper()
+
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatalf("%s is not a hex number", s)
+	}
+
+	return n
+}
+
+// rfc6979Key is the P-256 key of RFC 6979 appendix A.2.5
+func rfc6979Key(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	curve := elliptic.P256()
+	key := &ecdsa.PrivateKey{D: mustParseInt(t, "C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721")}
+	key.PublicKey.Curve = curve
+	key.PublicKey.X, key.PublicKey.Y = curve.ScalarBaseMult(key.D.Bytes())
+
+	want := "60FED4BA255A9D31C961EB74C6356D68C049B8923B61FA6CE669622E60F29FB6"
+	if key.PublicKey.X.Cmp(mustParseInt(t, want)) != 0 {
+		t.Fatalf("public key x is %X, want %s", key.PublicKey.X, want)
+	}
+
+	return key
+}
+
+// RFC 6979 appendix A.2.5, ECDSA on P-256 with SHA-256
+var rfc6979Vectors = []struct {
+	msg  string
+	k    string
+	r    string
+	s    string
+	lowS string
+}{
+	{"sample",
+		"A6E3C57DD01ABE90086538398355DD4C3B17AA873382B0F24D6129493D8AAD60",
+		"EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716",
+		"F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8",
+		// n-s, the published s is above half the order
+		"0834E36AD29A83BF2BC9385E491D6099C8FDF9D1ED67AA7EA5F51F93782857A9"},
+	{"test",
+		"D16B6AE827F17175E040871A1C7EC3500192C4C92677336EC2537ACAEE0008E0",
+		"F1ABB023518351CD71D881567B1EA663ED3EFCF6C5132B354F28D3B0B7D38367",
+		"019F4113742A2B14BD25926B49C649155F267E60D3814B4C0CC84250E46F0083",
+		"019F4113742A2B14BD25926B49C649155F267E60D3814B4C0CC84250E46F0083"},
+}
+
+func TestRFC6979Vectors(t *testing.T) {
+	key := rfc6979Key(t)
+	n := key.Curve.Params().N
+
+	for _, v := range rfc6979Vectors {
+		digest := sha256.Sum256([]byte(v.msg))
+
+		if k := newNonceGenerator(key.D, digest[:], n).next(); k.Cmp(mustParseInt(t, v.k)) != 0 {
+			t.Errorf("%s: nonce is %X, want %s", v.msg, k, v.k)
+		}
+
+		r, s := signRFC6979(key, digest[:])
+		if r.Cmp(mustParseInt(t, v.r)) != 0 || s.Cmp(mustParseInt(t, v.s)) != 0 {
+			t.Errorf("%s: signature is (%X, %X), want (%s, %s)", v.msg, r, s, v.r, v.s)
+		}
+	}
+}
+
+func TestKeySigner(t *testing.T) {
+	key := rfc6979Key(t)
+	pubKey := script.EncodePubKey(&key.PublicKey)
+	s := NewKeySigner(*key)
+
+	for _, v := range rfc6979Vectors {
+		digest := sha256.Sum256([]byte(v.msg))
+
+		sig, err := s.Sign(pubKey, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := v.r + v.lowS; hex.EncodeToString(sig) != strings.ToLower(want) {
+			t.Errorf("%s: signature is %x, want %s", v.msg, sig, strings.ToLower(want))
+		}
+
+		// the same digest always gets the same signature
+		again, err := s.Sign(pubKey, digest[:])
+		if err != nil || hex.EncodeToString(again) != hex.EncodeToString(sig) {
+			t.Errorf("%s: signing again gives %x, %v", v.msg, again, err)
+		}
+
+		r, lowS, err := script.ParseSignature(sig)
+		if err != nil {
+			t.Fatalf("%s: signature is not canonical: %v", v.msg, err)
+		}
+		if !ecdsa.Verify(&key.PublicKey, digest[:], r, lowS) {
+			t.Errorf("%s: signature does not verify", v.msg)
+		}
+	}
+
+	other := rfc6979Key(t)
+	other.PublicKey.Y = new(big.Int).Sub(other.Curve.Params().P, other.PublicKey.Y)
+	if _, err := s.Sign(script.EncodePubKey(&other.PublicKey), make([]byte, 32)); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("signing for a key the signer does not hold returned %v", err)
+	}
+}
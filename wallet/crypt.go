@@ -0,0 +1,197 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/gob"
+	"errors"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// scrypt parameters for new encrypted wallets, the ones a wallet was
+// encrypted with are kept in its file
+const (
+	scryptN    = 1 << 15
+	scryptR    = 8
+	scryptP    = 1
+	keyLength  = 32
+	saltLength = 16
+)
+
+var (
+	// ErrWalletLocked error when a private key is needed while the wallets are locked
+	ErrWalletLocked = errors.New("Wallet is locked, unlock it with the passphrase first")
+	// ErrWalletEncrypted error when encrypting wallets that are already encrypted
+	ErrWalletEncrypted = errors.New("Wallet is already encrypted")
+	// ErrWalletNotEncrypted error when locking or unlocking wallets that are not encrypted
+	ErrWalletNotEncrypted = errors.New("Wallet is not encrypted")
+	// ErrWrongPassphrase error when the passphrase does not decrypt the wallets
+	ErrWrongPassphrase = errors.New("The wallet passphrase is incorrect")
+)
+
+// EncryptedKeys structure that keeps the private keys of encrypted wallets,
+// the key is derived from the passphrase with scrypt and the private keys
+// are sealed with AES-GCM
+type EncryptedKeys struct {
+	Salt       []byte
+	N          int
+	R          int
+	P          int
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+// sealedKeys structure of the plaintext of EncryptedKeys
+type sealedKeys struct {
+	Keys map[string][]byte
+	Seed []byte
+}
+
+func (ek *EncryptedKeys) deriveKey(passphrase string) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), ek.Salt, ek.N, ek.R, ek.P, keyLength)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// IsEncrypted method that tells whether the private keys are kept encrypted
+func (ws *Wallets) IsEncrypted() bool {
+	return ws.encrypted != nil
+}
+
+// IsLocked method that tells whether the private keys are unavailable
+func (ws *Wallets) IsLocked() bool {
+	return ws.encrypted != nil && ws.key == nil
+}
+
+// Encrypt method to protect the private keys with a passphrase, the wallets
+// are locked afterwards and have to be saved for the encryption to reach the file
+func (ws *Wallets) Encrypt(passphrase string) error {
+	if ws.IsEncrypted() {
+		return ErrWalletEncrypted
+	}
+	if passphrase == "" {
+		return errors.New("Passphrase must not be empty")
+	}
+
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+
+	encrypted := &EncryptedKeys{Salt: salt, N: scryptN, R: scryptR, P: scryptP}
+	key, err := encrypted.deriveKey(passphrase)
+	if err != nil {
+		return err
+	}
+
+	ws.encrypted = encrypted
+	ws.key = key
+
+	return ws.Lock()
+}
+
+// Unlock method to decrypt the private keys with the passphrase
+func (ws *Wallets) Unlock(passphrase string) error {
+	if !ws.IsEncrypted() {
+		return ErrWalletNotEncrypted
+	}
+
+	key, err := ws.encrypted.deriveKey(passphrase)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	plaintext, err := gcm.Open(nil, ws.encrypted.Nonce, ws.encrypted.Ciphertext, nil)
+	if err != nil {
+		return ErrWrongPassphrase
+	}
+
+	var sealed sealedKeys
+	if err := gob.NewDecoder(bytes.NewReader(plaintext)).Decode(&sealed); err != nil {
+		return err
+	}
+
+	for address, w := range ws.Wallets {
+		if d, ok := sealed.Keys[address]; ok {
+			w.PrivateKey = privateKeyFromD(d)
+		}
+	}
+	if ws.HasSeed() {
+		ws.seed.Seed = sealed.Seed
+	}
+	ws.key = key
+
+	return nil
+}
+
+// Lock method to forget the private keys and the key derived from the passphrase
+func (ws *Wallets) Lock() error {
+	if !ws.IsEncrypted() {
+		return ErrWalletNotEncrypted
+	}
+	if ws.key == nil {
+		return nil
+	}
+
+	// keys added while unlocked only exist in memory, seal them first
+	if err := ws.sealKeys(); err != nil {
+		return err
+	}
+
+	for _, w := range ws.Wallets {
+		w.PrivateKey = ecdsa.PrivateKey{}
+	}
+	if ws.HasSeed() {
+		ws.seed.Seed = nil
+	}
+	ws.key = nil
+
+	return nil
+}
+
+// sealKeys encrypts the private keys of the unlocked wallets and the seed with a fresh nonce
+func (ws *Wallets) sealKeys() error {
+	sealed := sealedKeys{Keys: make(map[string][]byte)}
+	for address, w := range ws.Wallets {
+		if !w.IsLocked() {
+			sealed.Keys[address] = w.PrivateKey.D.Bytes()
+		}
+	}
+	if ws.HasSeed() {
+		sealed.Seed = ws.seed.Seed
+	}
+
+	var plaintext bytes.Buffer
+	if err := gob.NewEncoder(&plaintext).Encode(sealed); err != nil {
+		return err
+	}
+
+	gcm, err := newGCM(ws.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	ws.encrypted.Nonce = nonce
+	ws.encrypted.Ciphertext = gcm.Seal(nil, nonce, plaintext.Bytes(), nil)
+
+	return nil
+}
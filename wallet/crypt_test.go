@@ -0,0 +1,134 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/shortdaddy0711/golang-blockchain/config"
+	"github.com/shortdaddy0711/golang-blockchain/params"
+)
+
+func TestEncryptLockUnlock(t *testing.T) {
+	cfg := &config.Config{DataDir: t.TempDir(), Params: &params.RegTest}
+
+	wallets, err := CreateWallets(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wallets.SetMnemonic(testMnemonic); err != nil {
+		t.Fatal(err)
+	}
+	address, err := wallets.AddWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := wallets.Wallets[address].PrivateKey.D.Bytes()
+
+	if err := wallets.Encrypt("secret"); err != nil {
+		t.Fatal(err)
+	}
+	if !wallets.IsEncrypted() || !wallets.IsLocked() {
+		t.Fatal("wallets are not locked after encrypting them")
+	}
+	if !wallets.Wallets[address].IsLocked() || wallets.seed.Seed != nil {
+		t.Fatal("private key or seed is kept after encrypting the wallets")
+	}
+	if err := wallets.Encrypt("secret"); !errors.Is(err, ErrWalletEncrypted) {
+		t.Fatalf("encrypting twice returned %v", err)
+	}
+	if _, err := wallets.AddWallet(); !errors.Is(err, ErrWalletLocked) {
+		t.Fatalf("adding a wallet while locked returned %v", err)
+	}
+
+	if err := wallets.Unlock("wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("unlocking with a wrong passphrase returned %v", err)
+	}
+	if !wallets.IsLocked() {
+		t.Fatal("a wrong passphrase unlocked the wallets")
+	}
+
+	if err := wallets.Unlock("secret"); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(wallets.Wallets[address].PrivateKey.D.Bytes(), d) {
+		t.Fatal("unlocking did not restore the private key")
+	}
+
+	// a key added while unlocked is only in memory until the wallets are locked
+	added, err := wallets.AddWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addedD := wallets.Wallets[added].PrivateKey.D.Bytes()
+	if err := wallets.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if !wallets.Wallets[added].IsLocked() {
+		t.Fatal("private key added while unlocked is kept after locking")
+	}
+	if err := wallets.Unlock("secret"); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(wallets.Wallets[added].PrivateKey.D.Bytes(), addedD) {
+		t.Fatal("private key added while unlocked is lost after locking")
+	}
+}
+
+func TestEncryptedFileHasNoPrivateKeys(t *testing.T) {
+	cfg := &config.Config{DataDir: t.TempDir(), Params: &params.RegTest}
+
+	wallets, err := CreateWallets(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wallets.SetMnemonic(testMnemonic); err != nil {
+		t.Fatal(err)
+	}
+	seed := wallets.seed.Seed
+	var secrets [][]byte
+	for i := 0; i < 2; i++ {
+		address, err := wallets.AddWallet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		secrets = append(secrets, wallets.Wallets[address].PrivateKey.D.Bytes())
+	}
+	secrets = append(secrets, seed)
+
+	if err := wallets.Encrypt("secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := wallets.Unlock("secret"); err != nil {
+		t.Fatal(err)
+	}
+	// saving unlocked wallets must not write the keys they hold in memory
+	if err := wallets.SaveFile(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(cfg.WalletPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range secrets {
+		if bytes.Contains(content, secret) {
+			t.Fatalf("wallet file holds %x in the clear", secret)
+		}
+	}
+
+	loaded, err := CreateWallets(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.IsLocked() {
+		t.Fatal("encrypted wallet file is loaded unlocked")
+	}
+	if err := loaded.Unlock("secret"); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded.seed.Seed, seed) {
+		t.Fatal("seed is not restored from the file")
+	}
+}
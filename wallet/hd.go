@@ -0,0 +1,190 @@
+package wallet
+
+import (
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/shortdaddy0711/golang-blockchain/script"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// Keys are derived as in SLIP-0010, the variant of BIP32 for the NIST P-256
+// curve that NewKeyPair uses, from a BIP39 seed along the path
+// m/44'/coin type'/0'/0/index so the mnemonic restores every address
+const (
+	// HardenedKeyStart is the first index of a hardened child key
+	HardenedKeyStart uint32 = 0x80000000
+
+	masterKeySalt = "Nist256p1 seed"
+	entropyBits   = 256
+	purpose       = 44
+)
+
+var (
+	// ErrInvalidMnemonic error when the words are not a BIP39 mnemonic
+	ErrInvalidMnemonic = errors.New("Mnemonic is not valid")
+	// ErrSeedExists error when the wallets already derive their keys from a seed
+	ErrSeedExists = errors.New("Wallet already has a mnemonic seed")
+)
+
+// ExtendedKey structure of a private key and the chain code to derive its children
+type ExtendedKey struct {
+	Key       []byte
+	ChainCode []byte
+}
+
+// hdSeed structure of the seed the wallets derive their keys from, Next is
+// the index of the next address, the seed is empty while the wallets are locked
+type hdSeed struct {
+	Seed []byte
+	Next uint32
+}
+
+// NewMnemonic function to generate the words of a new seed
+func NewMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(entropyBits)
+	if err != nil {
+		return "", err
+	}
+
+	return bip39.NewMnemonic(entropy)
+}
+
+// MnemonicToSeed function that returns the seed of the words of a mnemonic
+func MnemonicToSeed(mnemonic string) ([]byte, error) {
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, "")
+	if err != nil {
+		return nil, ErrInvalidMnemonic
+	}
+
+	return seed, nil
+}
+
+// NewMasterKey function to derive the root key of a seed
+func NewMasterKey(seed []byte) *ExtendedKey {
+	data := seed
+	for {
+		mac := hmac.New(sha512.New, []byte(masterKeySalt))
+		mac.Write(data)
+		sum := mac.Sum(nil)
+
+		if validKey(new(big.Int).SetBytes(sum[:32])) {
+			return &ExtendedKey{sum[:32], sum[32:]}
+		}
+		// try again with the whole hash, a rare case the curve order rules out
+		data = sum
+	}
+}
+
+// Child method to derive the child key at index, indexes from
+// HardenedKeyStart up are hardened
+func (k *ExtendedKey) Child(index uint32) *ExtendedKey {
+	var data []byte
+	if index >= HardenedKeyStart {
+		data = append([]byte{0}, k.Key...)
+	} else {
+		curve := elliptic.P256()
+		x, y := curve.ScalarBaseMult(k.Key)
+		data = elliptic.MarshalCompressed(curve, x, y)
+	}
+	data = appendIndex(data, index)
+
+	n := elliptic.P256().Params().N
+	for {
+		mac := hmac.New(sha512.New, k.ChainCode)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+
+		tweak := new(big.Int).SetBytes(sum[:32])
+		child := new(big.Int).Add(tweak, new(big.Int).SetBytes(k.Key))
+		child.Mod(child, n)
+		if tweak.Cmp(n) < 0 && validKey(child) {
+			return &ExtendedKey{paddedKey(child), sum[32:]}
+		}
+		data = appendIndex(append([]byte{1}, sum[32:]...), index)
+	}
+}
+
+// Path method to derive the key at the end of a path of child indexes
+func (k *ExtendedKey) Path(indexes ...uint32) *ExtendedKey {
+	key := k
+	for _, index := range indexes {
+		key = key.Child(index)
+	}
+
+	return key
+}
+
+func appendIndex(data []byte, index uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], index)
+
+	return append(data, buf[:]...)
+}
+
+func validKey(key *big.Int) bool {
+	return key.Sign() > 0 && key.Cmp(elliptic.P256().Params().N) < 0
+}
+
+func paddedKey(key *big.Int) []byte {
+	padded := make([]byte, 32)
+	key.FillBytes(padded)
+
+	return padded
+}
+
+// HasSeed method that tells whether new addresses are derived from a mnemonic
+func (ws *Wallets) HasSeed() bool {
+	return ws.seed != nil
+}
+
+// NewSeed method to make the wallets derive their keys from a new mnemonic,
+// the words are returned once and are the only backup of the keys
+func (ws *Wallets) NewSeed() (string, error) {
+	mnemonic, err := NewMnemonic()
+	if err != nil {
+		return "", err
+	}
+
+	return mnemonic, ws.SetMnemonic(mnemonic)
+}
+
+// SetMnemonic method to make the wallets derive their keys from the seed of
+// the mnemonic, wallets made before keep their random keys
+func (ws *Wallets) SetMnemonic(mnemonic string) error {
+	if ws.HasSeed() {
+		return ErrSeedExists
+	}
+	if ws.IsLocked() {
+		return ErrWalletLocked
+	}
+
+	seed, err := MnemonicToSeed(mnemonic)
+	if err != nil {
+		return err
+	}
+	ws.seed = &hdSeed{Seed: seed}
+
+	return nil
+}
+
+// deriveWallet derives the wallet of the next address of the seed
+func (ws *Wallets) deriveWallet() *Wallet {
+	key := NewMasterKey(ws.seed.Seed).Path(
+		HardenedKeyStart+purpose,
+		HardenedKeyStart+ws.params.HDCoinType,
+		HardenedKeyStart,
+		0,
+		ws.seed.Next,
+	)
+	ws.seed.Next++
+
+	private := privateKeyFromD(key.Key)
+	public := script.EncodePubKey(&private.PublicKey)
+
+	return &Wallet{private, public}
+}
@@ -0,0 +1,142 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/shortdaddy0711/golang-blockchain/config"
+	"github.com/shortdaddy0711/golang-blockchain/params"
+	"github.com/shortdaddy0711/golang-blockchain/script"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestMnemonicToSeed(t *testing.T) {
+	// BIP39 vector of zero entropy, with the empty passphrase the wallets use
+	seed, err := MnemonicToSeed(testMnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := mustDecodeHex(t, "5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc1"+
+		"9a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4")
+	if !bytes.Equal(seed, want) {
+		t.Fatalf("seed is %x, want %x", seed, want)
+	}
+
+	for _, mnemonic := range []string{
+		"",
+		strings.Replace(testMnemonic, "about", "abandon", 1),
+		strings.Replace(testMnemonic, "about", "bitcoins", 1),
+		"abandon abandon about",
+	} {
+		if _, err := MnemonicToSeed(mnemonic); !errors.Is(err, ErrInvalidMnemonic) {
+			t.Errorf("MnemonicToSeed(%q) returned %v", mnemonic, err)
+		}
+	}
+}
+
+func TestNewMnemonic(t *testing.T) {
+	mnemonic, err := NewMnemonic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if words := strings.Fields(mnemonic); len(words) != 24 {
+		t.Fatalf("mnemonic has %d words, want 24", len(words))
+	}
+	if _, err := MnemonicToSeed(mnemonic); err != nil {
+		t.Fatalf("new mnemonic does not decode: %v", err)
+	}
+}
+
+// SLIP-0010 test vectors for the nist256p1 curve
+func TestExtendedKeyVectors(t *testing.T) {
+	tests := []struct {
+		seed      string
+		path      []uint32
+		chainCode string
+		key       string
+	}{
+		{"000102030405060708090a0b0c0d0e0f", nil,
+			"beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea",
+			"612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2"},
+		{"000102030405060708090a0b0c0d0e0f", []uint32{HardenedKeyStart},
+			"3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11",
+			"6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c"},
+		{"000102030405060708090a0b0c0d0e0f", []uint32{HardenedKeyStart, 1},
+			"4187afff1aafa8445010097fb99d23aee9f599450c7bd140b6826ac22ba21d0c",
+			"284e9d38d07d21e4e281b645089a94f4cf5a5a81369acf151a1c3a57f18b2129"},
+		{"000102030405060708090a0b0c0d0e0f", []uint32{HardenedKeyStart, 1, HardenedKeyStart + 2},
+			"98c7514f562e64e74170cc3cf304ee1ce54d6b6da4f880f313e8204c2a185318",
+			"694596e8a54f252c960eb771a3c41e7e32496d03b954aeb90f61635b8e092aa7"},
+		// the child key of 33941 is out of range on the first try
+		{"000102030405060708090a0b0c0d0e0f", []uint32{HardenedKeyStart + 28578, 33941},
+			"9e87fe95031f14736774cd82f25fd885065cb7c358c1edf813c72af535e83071",
+			"092154eed4af83e078ff9b84322015aefe5769e31270f62c3f66c33888335f3a"},
+		// the master key of this seed is out of range on the first try
+		{"a7305bc8df8d0951f0cb224c0e95d7707cbdf2c6ce7e8d481fec69c7ff5e9446", nil,
+			"7762f9729fed06121fd13f326884c82f59aa95c57ac492ce8c9654e60efd130c",
+			"3b8c18469a4634517d6d0b65448f8e6c62091b45540a1743c5846be55d47d88f"},
+	}
+
+	for _, test := range tests {
+		key := NewMasterKey(mustDecodeHex(t, test.seed)).Path(test.path...)
+
+		if chainCode := hex.EncodeToString(key.ChainCode); chainCode != test.chainCode {
+			t.Errorf("%s %v: chain code is %s, want %s", test.seed, test.path, chainCode, test.chainCode)
+		}
+		if k := hex.EncodeToString(key.Key); k != test.key {
+			t.Errorf("%s %v: key is %s, want %s", test.seed, test.path, k, test.key)
+		}
+	}
+}
+
+func TestSeedDerivesAddresses(t *testing.T) {
+	cfg := &config.Config{DataDir: t.TempDir(), Params: &params.RegTest}
+
+	wallets, err := CreateWallets(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wallets.SetMnemonic(testMnemonic); err != nil {
+		t.Fatal(err)
+	}
+	if err := wallets.SetMnemonic(testMnemonic); !errors.Is(err, ErrSeedExists) {
+		t.Fatalf("setting a second mnemonic returned %v", err)
+	}
+
+	// m/44'/1'/0'/0/0 and m/44'/1'/0'/0/1
+	for _, want := range []string{
+		"02ee1fbfd2bef9b58cbe8acae68e057f8d837f6a55d27cfbce23ef78b186c54d35",
+		"02de54d0934c5cfd75e938b99f8308c214ee3473b107a05b3563ef8f3973cebd91",
+	} {
+		address, err := wallets.AddWallet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := wallets.GetWallet(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if pubKey := hex.EncodeToString(w.PublicKey); pubKey != want {
+			t.Errorf("derived public key %s, want %s", pubKey, want)
+		}
+		if !bytes.Equal(w.PublicKey, script.EncodePubKey(&w.PrivateKey.PublicKey)) {
+			t.Errorf("public key of %s does not match its private key", address)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+
+	"github.com/shortdaddy0711/golang-blockchain/params"
+	"github.com/shortdaddy0711/golang-blockchain/script"
+	"github.com/shortdaddy0711/golang-blockchain/signer"
+)
+
+// MultiSigAddress function that returns the pay to script hash address of a
+// redeem script that needs m signatures of the public keys
+func MultiSigAddress(m int, pubKeys [][]byte, p *params.ChainParams) (string, []byte, error) {
+	redeemScript, err := script.MultiSigScript(m, pubKeys)
+	if err != nil {
+		return "", nil, err
+	}
+	address := ScriptHashAddress(script.Hash160(redeemScript), p)
+
+	return string(address), redeemScript, nil
+}
+
+// AddScript method to keep the redeem script of a pay to script hash address,
+// redeem scripts are not secret and stay readable in encrypted files
+func (ws *Wallets) AddScript(redeemScript []byte) string {
+	address := string(ScriptHashAddress(script.Hash160(redeemScript), ws.params))
+	ws.scripts[address] = redeemScript
+
+	return address
+}
+
+// GetScript method that returns the redeem script of a pay to script hash address
+func (ws *Wallets) GetScript(address string) ([]byte, error) {
+	redeemScript, ok := ws.scripts[address]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrWalletNotFound, address)
+	}
+
+	return redeemScript, nil
+}
+
+// PrivateKeys method that returns the private keys of every wallet, encrypted
+// wallets have to be unlocked
+func (ws *Wallets) PrivateKeys() ([]ecdsa.PrivateKey, error) {
+	if ws.IsLocked() {
+		return nil, ErrWalletLocked
+	}
+
+	var keys []ecdsa.PrivateKey
+	for _, w := range ws.Wallets {
+		keys = append(keys, w.PrivateKey)
+	}
+
+	return keys, nil
+}
+
+// Signer method that returns a signer holding the private keys of every
+// wallet, encrypted wallets have to be unlocked
+func (ws *Wallets) Signer() (*signer.KeySigner, error) {
+	keys, err := ws.PrivateKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	return signer.NewKeySigner(keys...), nil
+}
@@ -6,85 +6,209 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
-	"log"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math/big"
 
-	"golang.org/x/crypto/ripemd160"
+	"github.com/shortdaddy0711/golang-blockchain/params"
+	"github.com/shortdaddy0711/golang-blockchain/script"
 )
 
 const (
 	checksumLength = 4
-	version        = byte(0x00)
+	// hashLength is the length of the public key or script hash in an address
+	hashLength = 20
 )
 
-// Wallet structure to connect private key with publickey
+var (
+	// ErrInvalidAddress error when an address does not decode or its checksum is wrong
+	ErrInvalidAddress = errors.New("Address is not valid")
+	// ErrWrongNetwork error when an address belongs to another network
+	ErrWrongNetwork = errors.New("Address is for another network")
+)
+
+// Wallet structure to connect private key with publickey, the public key is
+// kept in SEC1 compressed form
 type Wallet struct {
 	PrivateKey ecdsa.PrivateKey
 	PublicKey []byte
 }
 
-// Address method that returns the address that generated with pub key, checksum, and version
-func (w Wallet) Address() []byte {
+// Address method that returns the address that generated with pub key, checksum,
+// and the address version of the network
+func (w Wallet) Address(p *params.ChainParams) []byte {
 	pubHash := PublicKeyHash(w.PublicKey)
 
-	versionedHash := append([]byte{version}, pubHash...)
+	// %x	hexadecimal notation (with decimal power of two exponent), e.g. -0x1.23abcp+20
+	// fmt.Printf("pub key: %x\n", w.PublicKey)
+	// fmt.Printf("pub hash: %x\n", pubHash)
+
+	return PubKeyHashAddress(pubHash, p)
+}
+
+// PubKeyHashAddress function that returns the address paying to a public key hash on the network
+func PubKeyHashAddress(pubKeyHash []byte, p *params.ChainParams) []byte {
+	return encodeAddress(p.AddressVersion, pubKeyHash)
+}
+
+// ScriptHashAddress function that returns the address paying to a script hash on the network
+func ScriptHashAddress(scriptHash []byte, p *params.ChainParams) []byte {
+	return encodeAddress(p.ScriptHashAddressVersion, scriptHash)
+}
+
+func encodeAddress(version byte, hash []byte) []byte {
+	versionedHash := append([]byte{version}, hash...)
 	checksum := Checksum(versionedHash)
 
 	fullHash := append(versionedHash, checksum...)
-	address := Base58Encode(fullHash)
 
-	// %x	hexadecimal notation (with decimal power of two exponent), e.g. -0x1.23abcp+20
-	// fmt.Printf("pub key: %x\n", w.PublicKey)
-	// fmt.Printf("pub hash: %x\n", pubHash)
-	// fmt.Printf("address: %x\n", address)
+	return Base58Encode(fullHash)
+}
 
-	return address
+// ValidateAddress function to validate checksum and network of an address
+func ValidateAddress(address string, p *params.ChainParams) error {
+	_, err := AddressScript(address, p)
+
+	return err
+}
+
+// AddressPubKeyHash function that returns the public key hash an address pays to
+func AddressPubKeyHash(address string, p *params.ChainParams) ([]byte, error) {
+	version, pubKeyHash, err := decodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if version == p.ScriptHashAddressVersion {
+		return nil, fmt.Errorf("%w: %s pays to a script", ErrInvalidAddress, address)
+	}
+	if version != p.AddressVersion {
+		return nil, fmt.Errorf("%w: %s is not a %s address", ErrWrongNetwork, address, p.Name)
+	}
+
+	return pubKeyHash, nil
 }
 
-// ValidateAddress function to validate checksum
-func ValidateAddress(address string) bool {
-	pubKeyHash := Base58Decode([]byte(address))
-	actualChecksum := pubKeyHash[len(pubKeyHash) - checksumLength:]
-	version := pubKeyHash[0]
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash) - checksumLength]
-	targetChecksum := Checksum(append([]byte{version}, pubKeyHash...))
+// AddressScript function that returns the locking script of the outputs paying
+// to an address, pay to pubkey hash or pay to script hash depending on its version
+func AddressScript(address string, p *params.ChainParams) ([]byte, error) {
+	version, hash, err := decodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	switch version {
+	case p.AddressVersion:
+		return script.PayToPubKeyHash(hash), nil
+	case p.ScriptHashAddressVersion:
+		return script.PayToScriptHash(hash), nil
+	default:
+		return nil, fmt.Errorf("%w: %s is not a %s address", ErrWrongNetwork, address, p.Name)
+	}
+}
+
+// decodeAddress returns the version and hash of an address with a valid
+// checksum and a hash of hashLength bytes
+func decodeAddress(address string) (byte, []byte, error) {
+	hash, err := Base58Decode([]byte(address))
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %s", ErrInvalidAddress, err)
+	}
+	if len(hash) != 1+hashLength+checksumLength {
+		return 0, nil, fmt.Errorf("%w: %s does not hold a hash of %d bytes", ErrInvalidAddress, address, hashLength)
+	}
+
+	actualChecksum := hash[len(hash)-checksumLength:]
+	version := hash[0]
+	hash = hash[1 : len(hash)-checksumLength]
+	targetChecksum := Checksum(append([]byte{version}, hash...))
+
+	if bytes.Compare(actualChecksum, targetChecksum) != 0 {
+		return 0, nil, ErrInvalidAddress
+	}
 
-	return bytes.Compare(actualChecksum, targetChecksum) == 0
+	return version, hash, nil
 }
 
 // NewKeyPair function to generate key pair of privatekey and publickey
-func NewKeyPair() (ecdsa.PrivateKey, []byte) {
+func NewKeyPair() (ecdsa.PrivateKey, []byte, error) {
 	curve := elliptic.P256()
 
 	private, err := ecdsa.GenerateKey(curve, rand.Reader)
 	if err != nil {
-		log.Panic(err)
+		return ecdsa.PrivateKey{}, nil, err
 	}
 
-	pub := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
-	return *private, pub
+	pub := script.EncodePubKey(&private.PublicKey)
+	return *private, pub, nil
 }
 
-// MakeWallet function to generate new wallet for an account
-func MakeWallet() *Wallet {
-	private, public := NewKeyPair()
-	wallet := Wallet{private, public}
+// walletData structure to serialize a wallet, the curve is always P256
+// so only the private scalar and the public key are stored, D is empty
+// for a locked wallet
+type walletData struct {
+	D         []byte
+	PublicKey []byte
+}
+
+// GobEncode method for Wallet to keep the curve out of the encoded data
+func (w Wallet) GobEncode() ([]byte, error) {
+	var content bytes.Buffer
+
+	data := walletData{nil, w.PublicKey}
+	if !w.IsLocked() {
+		data.D = w.PrivateKey.D.Bytes()
+	}
+	err := gob.NewEncoder(&content).Encode(data)
 
-	return &wallet
+	return content.Bytes(), err
 }
 
-// PublicKeyHash function that generate and return hash of public key
-func PublicKeyHash(pubKey []byte) []byte {
-	pubHash := sha256.Sum256(pubKey)
+// GobDecode method for Wallet to rebuild the private key on the P256 curve
+func (w *Wallet) GobDecode(content []byte) error {
+	var data walletData
+
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&data); err != nil {
+		return err
+	}
 
-	hasher := ripemd160.New()
-	_, err := hasher.Write(pubHash[:])
+	w.PrivateKey = ecdsa.PrivateKey{}
+	if len(data.D) > 0 {
+		w.PrivateKey = privateKeyFromD(data.D)
+	}
+	w.PublicKey = data.PublicKey
+
+	return nil
+}
+
+func privateKeyFromD(d []byte) ecdsa.PrivateKey {
+	curve := elliptic.P256()
+	private := ecdsa.PrivateKey{D: new(big.Int).SetBytes(d)}
+	private.PublicKey.Curve = curve
+	private.PublicKey.X, private.PublicKey.Y = curve.ScalarBaseMult(d)
+
+	return private
+}
+
+// IsLocked method that tells whether the private key of the wallet is unavailable
+func (w Wallet) IsLocked() bool {
+	return w.PrivateKey.D == nil
+}
+
+// MakeWallet function to generate new wallet for an account
+func MakeWallet() (*Wallet, error) {
+	private, public, err := NewKeyPair()
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
+	wallet := Wallet{private, public}
 
-	publicRipMD := hasher.Sum(nil)
+	return &wallet, nil
+}
 
-	return publicRipMD
+// PublicKeyHash function that generate and return hash of public key
+func PublicKeyHash(pubKey []byte) []byte {
+	return script.Hash160(pubKey)
 }
 
 // Checksum function that returns hashed slice as much as checksumLength variable
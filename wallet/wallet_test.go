@@ -0,0 +1,69 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/shortdaddy0711/golang-blockchain/params"
+	"github.com/shortdaddy0711/golang-blockchain/script"
+)
+
+func TestAddressRoundTrip(t *testing.T) {
+	w, err := MakeWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range params.Networks {
+		address := string(w.Address(p))
+		if err := ValidateAddress(address, p); err != nil {
+			t.Fatalf("%s address %s: %v", p.Name, address, err)
+		}
+
+		pubKeyHash, err := AddressPubKeyHash(address, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(pubKeyHash, script.Hash160(w.PublicKey)) {
+			t.Fatalf("%s address %s decodes to %x", p.Name, address, pubKeyHash)
+		}
+	}
+}
+
+func TestValidateAddressRejects(t *testing.T) {
+	hash := bytes.Repeat([]byte{0xab}, hashLength)
+	valid := string(PubKeyHashAddress(hash, &params.MainNet))
+	corrupted := []byte(valid)
+	corrupted[5]++
+
+	tests := []struct {
+		name    string
+		address string
+		want    error
+	}{
+		{"short hash", string(encodeAddress(params.MainNet.AddressVersion, hash[:19])), ErrInvalidAddress},
+		{"long hash", string(encodeAddress(params.MainNet.AddressVersion, append(hash, 0xab))), ErrInvalidAddress},
+		{"empty hash", string(encodeAddress(params.MainNet.AddressVersion, nil)), ErrInvalidAddress},
+		{"bad checksum", string(corrupted), ErrInvalidAddress},
+		{"not base58", "0OIl", ErrInvalidAddress},
+		{"other network", string(PubKeyHashAddress(hash, &params.TestNet)), ErrWrongNetwork},
+	}
+
+	for _, test := range tests {
+		if err := ValidateAddress(test.address, &params.MainNet); !errors.Is(err, test.want) {
+			t.Errorf("%s: %s returned %v, want %v", test.name, test.address, err, test.want)
+		}
+	}
+}
+
+func TestAddressPubKeyHashOfScriptAddress(t *testing.T) {
+	address := string(ScriptHashAddress(script.Hash160([]byte{0x51}), &params.RegTest))
+
+	if err := ValidateAddress(address, &params.RegTest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddressPubKeyHash(address, &params.RegTest); !errors.Is(err, ErrInvalidAddress) {
+		t.Fatalf("public key hash of a script address returned %v", err)
+	}
+}
@@ -2,39 +2,74 @@ package wallet
 
 import (
 	"bytes"
-	"crypto/elliptic"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
+
+	"github.com/shortdaddy0711/golang-blockchain/config"
+	"github.com/shortdaddy0711/golang-blockchain/params"
 )
 
-const walletFile = "./tmp/wallets.data"
+// ErrWalletNotFound error when the wallet file has no key for an address
+var ErrWalletNotFound = errors.New("Wallet is not found for the address")
 
-// Wallets structure
+// Wallets structure, the wallets are keyed by their address on the network
+// of the config they were created with
 type Wallets struct {
-	Wallets map[string]*Wallet
+	Wallets   map[string]*Wallet
+	params    *params.ChainParams
+	scripts   map[string][]byte
+	seed      *hdSeed
+	encrypted *EncryptedKeys
+	key       []byte
+}
+
+// storedWallets structure of the wallet file, the wallets and seed of an
+// encrypted file only have their public parts and the private keys are in
+// Encrypted, Scripts keeps the redeem scripts of multisig addresses
+type storedWallets struct {
+	Wallets   map[string]*Wallet
+	Scripts   map[string][]byte
+	Seed      *hdSeed
+	Encrypted *EncryptedKeys
 }
 
-// CreateWallets function to create wallets to save every wallet
-func CreateWallets() (*Wallets, error) {
+// CreateWallets function to create wallets to save every wallet,
+// the wallets are empty when the node has no wallet file yet
+func CreateWallets(cfg *config.Config) (*Wallets, error) {
 	wallets := Wallets{}
 	wallets.Wallets = make(map[string]*Wallet)
+	wallets.scripts = make(map[string][]byte)
+	wallets.params = cfg.Params
 
-	err := wallets.LoadFile()
+	err := wallets.LoadFile(cfg)
 
 	return &wallets, err
 }
 
-// AddWallet method
-func (ws *Wallets) AddWallet() string {
-	wallet := MakeWallet()
-	address := fmt.Sprintf("%s", wallet.Address())
+// AddWallet method, the key of the wallet is derived from the seed when the
+// wallets have one, encrypted wallets have to be unlocked to add a wallet
+func (ws *Wallets) AddWallet() (string, error) {
+	if ws.IsLocked() {
+		return "", ErrWalletLocked
+	}
+
+	var wallet *Wallet
+	if ws.HasSeed() {
+		wallet = ws.deriveWallet()
+	} else {
+		var err error
+		if wallet, err = MakeWallet(); err != nil {
+			return "", err
+		}
+	}
+	address := fmt.Sprintf("%s", wallet.Address(ws.params))
 
 	ws.Wallets[address] = wallet
 
-	return address
+	return address, nil
 }
 
 // GetAllAddresses method
@@ -49,50 +84,109 @@ func (ws *Wallets) GetAllAddresses() []string {
 }
 
 // GetWallet method
-func (ws Wallets) GetWallet(address string) Wallet {
-	return *ws.Wallets[address]
+func (ws Wallets) GetWallet(address string) (Wallet, error) {
+	wallet, ok := ws.Wallets[address]
+	if !ok {
+		return Wallet{}, fmt.Errorf("%w: %s", ErrWalletNotFound, address)
+	}
+
+	return *wallet, nil
 }
 
 // LoadFile method
-func (ws *Wallets) LoadFile() error {
-	// check if the file exist or not
+func (ws *Wallets) LoadFile(cfg *config.Config) error {
+	walletFile := cfg.WalletPath()
+
+	// a node without a wallet file simply has no wallets yet
 	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
-		return err
+		return nil
 	}
 
-	var wallets Wallets
+	var wallets storedWallets
 
 	fileContent, err := ioutil.ReadFile(walletFile)
 	if err != nil {
 		return err
 	}
 
-	gob.Register(elliptic.P256())
 	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
 	err = decoder.Decode(&wallets)
 	if err != nil {
 		return err
 	}
 
-	ws.Wallets = wallets.Wallets
+	if wallets.Wallets != nil {
+		ws.Wallets = wallets.Wallets
+	}
+	if wallets.Scripts != nil {
+		ws.scripts = wallets.Scripts
+	}
+	ws.seed = wallets.Seed
+	ws.encrypted = wallets.Encrypted
+	ws.key = nil
 
 	return nil
 }
 
-// SaveFile method
-func (ws *Wallets) SaveFile() {
+// SaveFile method, the file is only readable by its owner and never holds
+// the private keys of encrypted wallets in the clear
+func (ws *Wallets) SaveFile(cfg *config.Config) error {
 	var content bytes.Buffer
-
-	gob.Register(elliptic.P256())
+	walletFile := cfg.WalletPath()
+
+	file := storedWallets{ws.Wallets, ws.scripts, ws.seed, nil}
+	if ws.IsEncrypted() {
+		if !ws.IsLocked() {
+			if err := ws.sealKeys(); err != nil {
+				return err
+			}
+		}
+
+		file.Wallets = make(map[string]*Wallet)
+		for address, w := range ws.Wallets {
+			file.Wallets[address] = &Wallet{PublicKey: w.PublicKey}
+		}
+		if ws.HasSeed() {
+			file.Seed = &hdSeed{Next: ws.seed.Next}
+		}
+		file.Encrypted = ws.encrypted
+	}
 
 	encoder := gob.NewEncoder(&content)
-	err := encoder.Encode(ws)
+	err := encoder.Encode(file)
 	if err != nil {
-		log.Panic(err)
+		return err
+	}
+
+	if err := cfg.EnsureDataDir(); err != nil {
+		return err
 	}
 
-	err = ioutil.WriteFile(walletFile, content.Bytes(), 0644)
+	// write next to the file and rename, so a failed write leaves the old file.
+	// A tmp file left behind is removed first, the new one must be created
+	// here so nobody else can hold it open or have loosened its mode
+	tmpFile := walletFile + ".tmp"
+	if err := os.Remove(tmpFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.OpenFile(tmpFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
+	if _, err := f.Write(content.Bytes()); err != nil {
+		f.Close()
+		os.Remove(tmpFile)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmpFile)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+
+	return os.Rename(tmpFile, walletFile)
 }
\ No newline at end of file
@@ -0,0 +1,51 @@
+package wallet
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/shortdaddy0711/golang-blockchain/config"
+	"github.com/shortdaddy0711/golang-blockchain/params"
+)
+
+func TestSaveFileOverStaleTmpFile(t *testing.T) {
+	cfg := &config.Config{DataDir: t.TempDir(), Params: &params.RegTest}
+
+	// a tmp file left behind with a loose mode must not lend it to the wallets
+	tmpFile := cfg.WalletPath() + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	wallets, err := CreateWallets(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := wallets.AddWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wallets.SaveFile(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(cfg.WalletPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("wallet file has mode %v", info.Mode().Perm())
+	}
+	if _, err := os.Stat(tmpFile); !os.IsNotExist(err) {
+		t.Fatalf("tmp file is still there: %v", err)
+	}
+
+	loaded, err := CreateWallets(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loaded.GetWallet(address); err != nil {
+		t.Fatalf("saved wallet %s is not loaded again: %v", address, err)
+	}
+}